@@ -1,42 +1,12 @@
 package config
 
 import (
-	"log"
 	"os"
-	"path/filepath"
-	"sync"
 
 	"gopkg.in/yaml.v2"
 )
 
-var (
-	GlobalConfig Config
-	logger       *log.Logger
-	loggerOnce   sync.Once
-)
-
-// GetLogger 返回全局日志记录器
-func GetLogger() *log.Logger {
-	loggerOnce.Do(func() {
-		// 创建日志目录
-		logDir := "./log"
-		if err := os.MkdirAll(logDir, 0755); err != nil {
-			// 尝试使用临时目录
-			logDir = os.TempDir()
-		}
-
-		// 打开日志文件
-		logFile, err := os.OpenFile(filepath.Join(logDir, "panel.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-		if err != nil {
-			// 如果无法打开文件，仅使用标准输出
-			logger = log.New(os.Stdout, "[PANEL] ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
-		} else {
-			// 只输出到文件
-			logger = log.New(logFile, "[PANEL] ", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
-		}
-	})
-	return logger
-}
+var GlobalConfig Config
 
 // Config 配置结构
 type Config struct {
@@ -48,6 +18,68 @@ type Config struct {
 		Username string `yaml:"username"`
 		Password string `yaml:"password"`
 	} `yaml:"auth"`
+	System SystemConfig `yaml:"system,omitempty"`
+}
+
+// SystemConfig 系统设置
+type SystemConfig struct {
+	// 允许访问的目录，为空表示不限制
+	AllowedPaths []string `yaml:"allowed_paths,omitempty"`
+	// 禁止访问的目录
+	ForbiddenPaths []string `yaml:"forbidden_paths,omitempty"`
+	// 受保护的进程名，不允许发送信号或调整优先级；init、sshd 和面板自身始终受保护
+	ProtectedProcesses []string       `yaml:"protected_processes,omitempty"`
+	Log                LogConfig      `yaml:"log,omitempty"`
+	Metrics            MetricsConfig  `yaml:"metrics,omitempty"`
+	Tasks              TasksConfig    `yaml:"tasks,omitempty"`
+	Firewall           FirewallConfig `yaml:"firewall,omitempty"`
+}
+
+// LogConfig 面板日志设置
+type LogConfig struct {
+	// 日志目录，日志写入其中的 panel.log，默认 ./log
+	Path string `yaml:"path,omitempty"`
+	// debug、info、warn、error，默认 info
+	Level string `yaml:"level,omitempty"`
+	// json 或 text，默认 json
+	Format string `yaml:"format,omitempty"`
+	// 单个文件的最大大小（MB），默认 100
+	MaxSize int `yaml:"max_size,omitempty"`
+	// 保留的轮转文件数，默认 10
+	MaxBackups int `yaml:"max_backups,omitempty"`
+	// 轮转文件的保留天数，默认 30
+	MaxAge int `yaml:"max_age,omitempty"`
+	// 按时间轮转的间隔，如 24h，为空时只按大小轮转
+	RotateInterval string `yaml:"rotate_interval,omitempty"`
+	// 轮转后压缩为 .gz
+	Compress bool `yaml:"compress,omitempty"`
+	// 同时输出到标准输出
+	Stdout bool `yaml:"stdout,omitempty"`
+}
+
+// MetricsConfig Prometheus 指标导出设置
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 抓取使用的 Bearer token，与登录 token 无关
+	Token string `yaml:"token,omitempty"`
+	// 允许抓取的IP或网段；token 和白名单满足其一即可，都未设置时只允许本机访问
+	AllowedIPs []string `yaml:"allowed_ips,omitempty"`
+}
+
+// TasksConfig 面板计划任务设置
+type TasksConfig struct {
+	// 每个任务保留的运行记录数，默认 100
+	HistoryMaxRuns int `yaml:"history_max_runs,omitempty"`
+	// 运行记录的保留天数，默认 30
+	HistoryMaxAge int `yaml:"history_max_age,omitempty"`
+}
+
+// FirewallConfig 防火墙设置
+type FirewallConfig struct {
+	// firewalld、ufw、nftables 或 iptables，为空时自动检测
+	Backend string `yaml:"backend,omitempty"`
+	// 修改规则后等待确认的秒数，超时未确认自动回滚，默认 60
+	ConfirmTimeout int `yaml:"confirm_timeout,omitempty"`
 }
 
 // LoadConfig 加载配置文件
@@ -62,14 +94,6 @@ func LoadConfig(path string) error {
 		return err
 	}
 
-	// 记录配置加载信息
-	if logger != nil {
-		// logger.Printf("=== 配置文件加载完成 ===")
-		// logger.Printf("配置文件路径: %s", path)
-		// logger.Printf("用户名: %s", GlobalConfig.Auth.Username)
-		// logger.Printf("密码哈希: %s", GlobalConfig.Auth.Password)
-	}
-
 	return nil
 }
 
@@ -0,0 +1,765 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/process"
+)
+
+// 告警引擎
+//
+// 每次采样后用与历史数据相同的序列值评估所有规则。条件满足后告警进入 pending 状态，
+// 持续满足 for 时长后转为 firing 并记录事件；恢复时需要越过回差（hysteresis）才会解除，
+// 避免数值在阈值附近抖动时反复告警。静默只屏蔽通知，告警状态照常记录。
+// 触发和恢复事件会发送到匹配的通知渠道，见 notify.go。
+
+const (
+	alertDataDir = "data/alerts"
+	// 告警历史最多保留的事件数
+	maxAlertHistory = 5000
+)
+
+const (
+	alertStatePending  = "pending"
+	alertStateFiring   = "firing"
+	alertStateResolved = "resolved"
+)
+
+// 告警级别，数值越大越严重
+var alertSeverities = map[string]int{
+	"info":     0,
+	"warning":  1,
+	"critical": 2,
+}
+
+// AlertRule 告警规则
+type AlertRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// metric：按历史数据序列判断；process：按同名进程数量判断
+	Kind string `json:"kind"`
+	// 序列名，以 * 结尾时对每个匹配的序列分别告警，如 disk.used_percent:*
+	Metric string `json:"metric,omitempty"`
+	// 进程名，支持通配符
+	Process   string  `json:"process,omitempty"`
+	Operator  string  `json:"operator"` // >, >=, <, <=
+	Threshold float64 `json:"threshold"`
+	// 条件需要持续的时间，如 5m，为空表示立即触发
+	For string `json:"for,omitempty"`
+	// 回差：告警触发后，数值需要回到阈值另一侧超过该值才会恢复
+	Hysteresis  float64 `json:"hysteresis,omitempty"`
+	Severity    string  `json:"severity"`
+	Enabled     bool    `json:"enabled"`
+	Description string  `json:"description,omitempty"`
+
+	forDuration time.Duration
+}
+
+// Alert 当前处于 pending 或 firing 状态的告警
+type Alert struct {
+	RuleID      string     `json:"ruleId"`
+	RuleName    string     `json:"ruleName"`
+	Series      string     `json:"series"`
+	Severity    string     `json:"severity"`
+	State       string     `json:"state"`
+	Value       float64    `json:"value"`
+	Operator    string     `json:"operator"`
+	Threshold   float64    `json:"threshold"`
+	ActiveSince time.Time  `json:"activeSince"`
+	FiredAt     *time.Time `json:"firedAt,omitempty"`
+	LastEval    time.Time  `json:"lastEval"`
+	Silenced    bool       `json:"silenced"`
+}
+
+// AlertEvent 告警触发或恢复的记录
+type AlertEvent struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	RuleID    string    `json:"ruleId"`
+	RuleName  string    `json:"ruleName"`
+	Series    string    `json:"series"`
+	Severity  string    `json:"severity"`
+	State     string    `json:"state"` // firing 或 resolved
+	Value     float64   `json:"value"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	Silenced  bool      `json:"silenced"`
+}
+
+// AlertSilence 在一段时间内屏蔽匹配的告警通知
+type AlertSilence struct {
+	ID string `json:"id"`
+	// 为空表示匹配所有规则
+	RuleID string `json:"ruleId,omitempty"`
+	// 序列名，以 * 结尾表示前缀匹配，为空表示匹配所有序列
+	Series    string    `json:"series,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	EndsAt    time.Time `json:"endsAt"`
+}
+
+var (
+	alertMutex    sync.Mutex
+	alertRules    []*AlertRule
+	alertSilences []AlertSilence
+	// 以 规则ID|序列名 为键
+	activeAlerts = make(map[string]*Alert)
+
+	alertHistoryMutex sync.Mutex
+	alertHistory      []AlertEvent
+)
+
+// 没有规则文件时使用的默认规则
+func defaultAlertRules() []*AlertRule {
+	return []*AlertRule{
+		{ID: "cpu-high", Name: "CPU使用率过高", Kind: "metric", Metric: "cpu", Operator: ">", Threshold: 90, For: "5m", Hysteresis: 5, Severity: "critical", Enabled: true},
+		{ID: "memory-high", Name: "内存使用率过高", Kind: "metric", Metric: "memory", Operator: ">", Threshold: 90, For: "5m", Hysteresis: 5, Severity: "warning", Enabled: true},
+		{ID: "disk-full", Name: "磁盘空间不足", Kind: "metric", Metric: "disk.used_percent:*", Operator: ">", Threshold: 85, For: "1m", Hysteresis: 2, Severity: "critical", Enabled: true},
+		{ID: "inode-full", Name: "inode不足", Kind: "metric", Metric: "disk.inodes_percent:*", Operator: ">", Threshold: 90, For: "1m", Hysteresis: 2, Severity: "warning", Enabled: true},
+		{ID: "swap-used", Name: "交换分区使用中", Kind: "metric", Metric: "swap", Operator: ">", Threshold: 20, For: "10m", Hysteresis: 5, Severity: "warning", Enabled: true},
+		{ID: "sshd-missing", Name: "sshd进程不存在", Kind: "process", Process: "sshd", Operator: "<", Threshold: 1, For: "1m", Severity: "critical", Enabled: false},
+	}
+}
+
+// StartAlerts 加载告警规则、历史和通知渠道，需在启动采集之前调用
+func StartAlerts() {
+	if err := loadAlertConfig(); err != nil {
+		slog.Error("加载告警配置失败", "error", err)
+	}
+	loadAlertHistory()
+	if err := loadNotifyChannels(); err != nil {
+		slog.Error("加载通知渠道失败", "error", err)
+	}
+}
+
+// 检查并补全规则
+func (r *AlertRule) normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("规则名称不能为空")
+	}
+	if r.Kind == "" {
+		r.Kind = "metric"
+	}
+	switch r.Kind {
+	case "metric":
+		if r.Metric == "" {
+			return errors.New("必须指定序列名")
+		}
+	case "process":
+		if r.Process == "" {
+			return errors.New("必须指定进程名")
+		}
+		if _, err := filepath.Match(r.Process, ""); err != nil {
+			return errors.New("无效的进程名通配符")
+		}
+	default:
+		return errors.New("无效的规则类型")
+	}
+	switch r.Operator {
+	case ">", ">=", "<", "<=":
+	default:
+		return errors.New("无效的比较运算符")
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if _, ok := alertSeverities[r.Severity]; !ok {
+		return errors.New("无效的告警级别")
+	}
+	if r.Hysteresis < 0 {
+		return errors.New("回差不能为负数")
+	}
+	r.forDuration = 0
+	if r.For != "" {
+		d, err := time.ParseDuration(r.For)
+		if err != nil || d < 0 {
+			return errors.New("无效的持续时间")
+		}
+		r.forDuration = d
+	}
+	return nil
+}
+
+// 判断数值是否满足告警条件，已触发的告警按回差放宽阈值
+func (r *AlertRule) matches(value float64, firing bool) bool {
+	threshold := r.Threshold
+	if firing {
+		switch r.Operator {
+		case ">", ">=":
+			threshold -= r.Hysteresis
+		case "<", "<=":
+			threshold += r.Hysteresis
+		}
+	}
+	switch r.Operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+func (s *AlertSilence) matches(ruleID, series string, now time.Time) bool {
+	if now.After(s.EndsAt) {
+		return false
+	}
+	if s.RuleID != "" && s.RuleID != ruleID {
+		return false
+	}
+	if s.Series != "" && !seriesFilter([]string{s.Series})(series) {
+		return false
+	}
+	return true
+}
+
+func loadAlertConfig() error {
+	if err := os.MkdirAll(alertDataDir, 0755); err != nil {
+		return err
+	}
+
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(alertDataDir, "rules.json"))
+	if os.IsNotExist(err) {
+		alertRules = defaultAlertRules()
+		for _, r := range alertRules {
+			r.normalize()
+		}
+		if err := saveAlertRules(); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		var rules []*AlertRule
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return err
+		}
+		for _, r := range rules {
+			if err := r.normalize(); err != nil {
+				slog.Warn("忽略无效的告警规则", "rule", r.ID, "error", err)
+				continue
+			}
+			alertRules = append(alertRules, r)
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(alertDataDir, "silences.json"))
+	if err == nil {
+		json.Unmarshal(data, &alertSilences)
+	}
+	return nil
+}
+
+// 调用方需持有 alertMutex
+func saveAlertRules() error {
+	data, err := json.MarshalIndent(alertRules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(alertDataDir, "rules.json"), data, 0644)
+}
+
+// 调用方需持有 alertMutex，顺便清理已过期的静默
+func saveAlertSilences() error {
+	now := time.Now()
+	kept := alertSilences[:0]
+	for _, s := range alertSilences {
+		if now.Before(s.EndsAt) {
+			kept = append(kept, s)
+		}
+	}
+	alertSilences = kept
+
+	data, err := json.MarshalIndent(alertSilences, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(alertDataDir, "silences.json"), data, 0644)
+}
+
+func loadAlertHistory() {
+	f, err := os.Open(filepath.Join(alertDataDir, "history.jsonl"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	alertHistoryMutex.Lock()
+	defer alertHistoryMutex.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AlertEvent
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			alertHistory = append(alertHistory, e)
+		}
+	}
+	if len(alertHistory) > maxAlertHistory {
+		alertHistory = alertHistory[len(alertHistory)-maxAlertHistory:]
+	}
+}
+
+// 追加告警事件到历史记录，超出上限较多时重写文件
+func recordAlertEvents(events []AlertEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	alertHistoryMutex.Lock()
+	defer alertHistoryMutex.Unlock()
+
+	alertHistory = append(alertHistory, events...)
+	path := filepath.Join(alertDataDir, "history.jsonl")
+
+	if len(alertHistory) > maxAlertHistory+maxAlertHistory/10 {
+		alertHistory = append([]AlertEvent(nil), alertHistory[len(alertHistory)-maxAlertHistory:]...)
+		var buf strings.Builder
+		for _, e := range alertHistory {
+			line, _ := json.Marshal(e)
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err == nil {
+			os.Rename(tmp, path)
+		}
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		slog.Error("写入告警历史失败", "error", err)
+		return
+	}
+	defer f.Close()
+	for _, e := range events {
+		line, _ := json.Marshal(e)
+		f.Write(append(line, '\n'))
+	}
+}
+
+// 统计匹配各进程规则的进程数量
+func countProcesses(patterns []string) map[string]float64 {
+	counts := make(map[string]float64, len(patterns))
+	for _, p := range patterns {
+		counts[p] = 0
+	}
+	procs, err := process.Processes()
+	if err != nil {
+		return nil
+	}
+	for _, p := range procs {
+		name, err := p.Name()
+		if err != nil {
+			continue
+		}
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				counts[pattern]++
+			}
+		}
+	}
+	return counts
+}
+
+func newAlertEvent(a *Alert, state string, now time.Time, message string) AlertEvent {
+	return AlertEvent{
+		ID:        strconv.FormatInt(now.UnixNano(), 10) + "-" + a.RuleID + "-" + a.Series,
+		Time:      now,
+		RuleID:    a.RuleID,
+		RuleName:  a.RuleName,
+		Series:    a.Series,
+		Severity:  a.Severity,
+		State:     state,
+		Value:     a.Value,
+		Operator:  a.Operator,
+		Threshold: a.Threshold,
+		Message:   message,
+		Silenced:  a.Silenced,
+	}
+}
+
+// 用一次采样的序列值评估所有规则，由采集器调用
+func evaluateAlerts(now time.Time, values map[string]float64) {
+	alertMutex.Lock()
+
+	var processPatterns []string
+	for _, r := range alertRules {
+		if r.Enabled && r.Kind == "process" {
+			processPatterns = append(processPatterns, r.Process)
+		}
+	}
+	var processCounts map[string]float64
+	if len(processPatterns) > 0 {
+		processCounts = countProcesses(processPatterns)
+	}
+
+	var events []AlertEvent
+	seen := make(map[string]bool)
+	for _, rule := range alertRules {
+		if !rule.Enabled {
+			continue
+		}
+
+		samples := make(map[string]float64)
+		switch rule.Kind {
+		case "metric":
+			if strings.HasSuffix(rule.Metric, "*") {
+				match := seriesFilter([]string{rule.Metric})
+				for name, v := range values {
+					if match(name) {
+						samples[name] = v
+					}
+				}
+			} else if v, ok := values[rule.Metric]; ok {
+				samples[rule.Metric] = v
+			}
+		case "process":
+			// 进程列表读取失败时不评估，避免误报进程不存在
+			if processCounts != nil {
+				samples["process:"+rule.Process] = processCounts[rule.Process]
+			}
+		}
+
+		for series, v := range samples {
+			key := rule.ID + "|" + series
+			seen[key] = true
+
+			a := activeAlerts[key]
+			if !rule.matches(v, a != nil && a.State == alertStateFiring) {
+				if a != nil {
+					if a.State == alertStateFiring {
+						a.Value = v
+						events = append(events, newAlertEvent(a, alertStateResolved, now,
+							fmt.Sprintf("%s 已恢复：%s 当前值 %.2f", rule.Name, series, v)))
+					}
+					delete(activeAlerts, key)
+				}
+				continue
+			}
+
+			if a == nil {
+				a = &Alert{
+					RuleID:      rule.ID,
+					State:       alertStatePending,
+					Series:      series,
+					ActiveSince: now,
+				}
+				activeAlerts[key] = a
+			}
+			// 规则修改后立即使用新的名称、级别和阈值
+			a.RuleName = rule.Name
+			a.Severity = rule.Severity
+			a.Operator = rule.Operator
+			a.Threshold = rule.Threshold
+			a.Value = v
+			a.LastEval = now
+			a.Silenced = false
+			for i := range alertSilences {
+				if alertSilences[i].matches(rule.ID, series, now) {
+					a.Silenced = true
+					break
+				}
+			}
+
+			if a.State == alertStatePending && now.Sub(a.ActiveSince) >= rule.forDuration {
+				a.State = alertStateFiring
+				firedAt := now
+				a.FiredAt = &firedAt
+				events = append(events, newAlertEvent(a, alertStateFiring, now,
+					fmt.Sprintf("%s：%s 当前值 %.2f %s %.2f", rule.Name, series, v, rule.Operator, rule.Threshold)))
+			}
+		}
+	}
+
+	// 规则被删除或停用、序列消失（如磁盘被卸载）时结束告警
+	for key, a := range activeAlerts {
+		if seen[key] {
+			continue
+		}
+		if a.State == alertStateFiring {
+			events = append(events, newAlertEvent(a, alertStateResolved, now,
+				fmt.Sprintf("%s 已结束：规则已停用或 %s 无数据", a.RuleName, a.Series)))
+		}
+		delete(activeAlerts, key)
+	}
+
+	alertMutex.Unlock()
+
+	recordAlertEvents(events)
+	dispatchAlertNotifications(events)
+}
+
+// 处理当前告警列表请求
+func HandleAlertsList(c *gin.Context) {
+	alertMutex.Lock()
+	alerts := make([]Alert, 0, len(activeAlerts))
+	for _, a := range activeAlerts {
+		alerts = append(alerts, *a)
+	}
+	alertMutex.Unlock()
+
+	// firing 在前，其次按级别和开始时间排序
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.State != b.State {
+			return a.State == alertStateFiring
+		}
+		if alertSeverities[a.Severity] != alertSeverities[b.Severity] {
+			return alertSeverities[a.Severity] > alertSeverities[b.Severity]
+		}
+		return a.ActiveSince.Before(b.ActiveSince)
+	})
+
+	firing := 0
+	for _, a := range alerts {
+		if a.State == alertStateFiring {
+			firing++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"alerts":  alerts,
+		"firing":  firing,
+		"pending": len(alerts) - firing,
+	})
+}
+
+// 处理告警历史请求，按时间倒序返回
+//
+// 参数：ruleId、severity、state 过滤，since 为 Unix 秒或 RFC3339，limit 默认100
+func HandleAlertHistory(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数量限制"})
+			return
+		}
+		limit = n
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+			return
+		}
+		since = t
+	}
+	ruleID, severity, state := c.Query("ruleId"), c.Query("severity"), c.Query("state")
+
+	alertHistoryMutex.Lock()
+	events := []AlertEvent{}
+	for i := len(alertHistory) - 1; i >= 0 && len(events) < limit; i-- {
+		e := alertHistory[i]
+		if e.Time.Before(since) {
+			break
+		}
+		if (ruleID != "" && e.RuleID != ruleID) || (severity != "" && e.Severity != severity) ||
+			(state != "" && e.State != state) {
+			continue
+		}
+		events = append(events, e)
+	}
+	alertHistoryMutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// 处理告警规则列表请求
+func HandleAlertRulesList(c *gin.Context) {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"rules": alertRules})
+}
+
+// 处理告警规则保存请求，ID 为空时新建
+func HandleAlertRuleSave(c *gin.Context) {
+	var rule AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if err := rule.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	if rule.ID == "" {
+		rule.ID = strconv.FormatInt(time.Now().UnixNano(), 10)
+		alertRules = append(alertRules, &rule)
+	} else {
+		found := false
+		for i, r := range alertRules {
+			if r.ID == rule.ID {
+				alertRules[i] = &rule
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+			return
+		}
+	}
+
+	if err := saveAlertRules(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存告警规则失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "告警规则已保存", "rule": rule})
+}
+
+// 处理告警规则删除请求
+func HandleAlertRuleDelete(c *gin.Context) {
+	id := c.Query("id")
+
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	for i, r := range alertRules {
+		if r.ID != id {
+			continue
+		}
+		alertRules = append(alertRules[:i], alertRules[i+1:]...)
+		if err := saveAlertRules(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存告警规则失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "告警规则已删除"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+}
+
+// 处理静默列表请求，只返回未过期的静默
+func HandleAlertSilencesList(c *gin.Context) {
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	now := time.Now()
+	silences := []AlertSilence{}
+	for _, s := range alertSilences {
+		if now.Before(s.EndsAt) {
+			silences = append(silences, s)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"silences": silences})
+}
+
+// 处理新建静默请求，duration（如 2h）和 endsAt 二选一
+func HandleAlertSilenceCreate(c *gin.Context) {
+	var req struct {
+		RuleID   string `json:"ruleId"`
+		Series   string `json:"series"`
+		Comment  string `json:"comment"`
+		Duration string `json:"duration"`
+		EndsAt   string `json:"endsAt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	now := time.Now()
+	silence := AlertSilence{
+		ID:        strconv.FormatInt(now.UnixNano(), 10),
+		RuleID:    req.RuleID,
+		Series:    req.Series,
+		Comment:   req.Comment,
+		CreatedAt: now,
+	}
+	switch {
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的静默时长"})
+			return
+		}
+		silence.EndsAt = now.Add(d)
+	case req.EndsAt != "":
+		t, err := parseTimeParam(req.EndsAt)
+		if err != nil || !t.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+			return
+		}
+		silence.EndsAt = t
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须指定静默时长或结束时间"})
+		return
+	}
+
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	if silence.RuleID != "" {
+		found := false
+		for _, r := range alertRules {
+			if r.ID == silence.RuleID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+			return
+		}
+	}
+
+	alertSilences = append(alertSilences, silence)
+	if err := saveAlertSilences(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存静默失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "静默已创建", "silence": silence})
+}
+
+// 处理删除静默请求
+func HandleAlertSilenceDelete(c *gin.Context) {
+	id := c.Query("id")
+
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+
+	for i, s := range alertSilences {
+		if s.ID != id {
+			continue
+		}
+		alertSilences = append(alertSilences[:i], alertSilences[i+1:]...)
+		if err := saveAlertSilences(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存静默失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "静默已删除"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "静默不存在"})
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
+)
+
+const (
+	// 采集间隔
+	sampleInterval = 5 * time.Second
+	// 历史数据记录间隔，期间的采样取平均值
+	historyInterval = 1 * time.Minute
+)
+
+// SystemSnapshot 某一时刻的系统状态
+type SystemSnapshot struct {
+	Timestamp time.Time `json:"timestamp"`
+	CPU       CPUStats  `json:"cpu"`
+	Memory    struct {
+		Total uint64 `json:"total"`
+		Used  uint64 `json:"used"`
+		Free  uint64 `json:"free"`
+	} `json:"memory"`
+	Swap struct {
+		Total uint64 `json:"total"`
+		Used  uint64 `json:"used"`
+	} `json:"swap"`
+	Disk struct {
+		Total uint64 `json:"total"`
+		Used  uint64 `json:"used"`
+		Free  uint64 `json:"free"`
+	} `json:"disk"`
+	// 所有真实文件系统的挂载点
+	Mounts []MountStats `json:"mounts"`
+	// 块设备I/O
+	DiskIO  []DiskIOStats `json:"diskIO"`
+	Network struct {
+		Sent      uint64 `json:"sent"`
+		Recv      uint64 `json:"recv"`
+		SentSpeed uint64 `json:"sent_speed"`
+		RecvSpeed uint64 `json:"recv_speed"`
+	} `json:"network"`
+	Interfaces []InterfaceStats `json:"interfaces"`
+	TCPStates  map[string]int   `json:"tcpStates"`
+}
+
+var (
+	snapshotMutex  sync.RWMutex
+	currentSample  *SystemSnapshot
+	cpuModelName   string
+	cpuModelLoaded sync.Once
+)
+
+// 获取采集器的最新快照
+func latestSnapshot() (SystemSnapshot, bool) {
+	snapshotMutex.RLock()
+	defer snapshotMutex.RUnlock()
+
+	if currentSample == nil {
+		return SystemSnapshot{}, false
+	}
+	return *currentSample, true
+}
+
+// CPU 型号不会变化，只读取一次
+func getCPUModel() string {
+	cpuModelLoaded.Do(func() {
+		if info, err := cpu.Info(); err == nil && len(info) > 0 {
+			cpuModelName = info[0].ModelName
+		}
+	})
+	return cpuModelName
+}
+
+// 采集一次系统状态
+func collectSnapshot() (*SystemSnapshot, error) {
+	snapshot := &SystemSnapshot{Timestamp: time.Now()}
+
+	// 根据与上一次采样之间的差值计算CPU使用率，不会阻塞
+	cpuStats, err := cpuStatsSampler.sample()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.CPU = *cpuStats
+
+	memInfo, err := mem.VirtualMemory()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Memory.Total = memInfo.Total
+	snapshot.Memory.Used = memInfo.Used
+	snapshot.Memory.Free = memInfo.Free
+
+	if swapInfo, err := mem.SwapMemory(); err == nil {
+		snapshot.Swap.Total = swapInfo.Total
+		snapshot.Swap.Used = swapInfo.Used
+	}
+
+	diskInfo, err := disk.Usage("/")
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Disk.Total = diskInfo.Total
+	snapshot.Disk.Used = diskInfo.Used
+	snapshot.Disk.Free = diskInfo.Free
+
+	if mounts, err := collectMounts(); err == nil {
+		snapshot.Mounts = mounts
+	}
+	if io, err := diskStatsSampler.sample(); err == nil {
+		snapshot.DiskIO = io
+	}
+
+	// 汇总速率只统计物理网卡，避免回环和容器网桥重复计算
+	ifaces, err := netStatsSampler.sample()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Interfaces = ifaces
+	sentSpeed, recvSpeed, totalSent, totalRecv := aggregateNetwork(ifaces)
+	if tcp, err := tcpStateSummary(); err == nil {
+		snapshot.TCPStates = tcp
+	}
+	snapshot.Network.Sent = totalSent
+	snapshot.Network.Recv = totalRecv
+	snapshot.Network.SentSpeed = sentSpeed
+	snapshot.Network.RecvSpeed = recvSpeed
+
+	return snapshot, nil
+}
+
+// 将快照转换为历史数据序列
+func snapshotValues(s *SystemSnapshot) map[string]float64 {
+	values := map[string]float64{
+		"network": float64(s.Network.SentSpeed+s.Network.RecvSpeed) / (1024 * 1024), // MB/s
+	}
+	cpuStatsValues(&s.CPU, values)
+	diskStatsValues(s.Mounts, s.DiskIO, values)
+	netStatsValues(s.Interfaces, s.TCPStates, values)
+	if s.Memory.Total > 0 {
+		values["memory"] = float64(s.Memory.Used) / float64(s.Memory.Total) * 100
+	}
+	if s.Swap.Total > 0 {
+		values["swap"] = float64(s.Swap.Used) / float64(s.Swap.Total) * 100
+	} else {
+		values["swap"] = 0
+	}
+	if s.Disk.Total > 0 {
+		values["disk"] = float64(s.Disk.Used) / float64(s.Disk.Total) * 100
+	}
+	return values
+}
+
+// 后台采集任务：按固定间隔采样，并每分钟将平均值写入历史数据
+func runMetricsCollector() {
+	// 预热CPU和网络的基准值，第一次采样才有意义
+	cpuStatsSampler.sample()
+	diskStatsSampler.sample()
+	netStatsSampler.sample()
+	processStatsSampler.sample()
+	time.Sleep(time.Second)
+
+	var (
+		window      []MetricPoint
+		windowStart = time.Now()
+	)
+
+	sample := func() {
+		processStatsSampler.sample()
+		snapshot, err := collectSnapshot()
+		if err != nil {
+			return
+		}
+
+		snapshotMutex.Lock()
+		currentSample = snapshot
+		snapshotMutex.Unlock()
+		publishSnapshot(snapshot)
+
+		values := snapshotValues(snapshot)
+		evaluateAlerts(snapshot.Timestamp, values)
+
+		window = append(window, MetricPoint{Time: snapshot.Timestamp, Values: values})
+		if time.Since(windowStart) < historyInterval {
+			return
+		}
+
+		// 窗口内的平均值写入历史
+		recordMetrics(snapshot.Timestamp, averagePoints(window))
+
+		window = window[:0]
+		windowStart = time.Now()
+	}
+
+	sample()
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sample()
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+)
+
+// CPUBreakdown 各类CPU时间占比（百分比）
+type CPUBreakdown struct {
+	User    float64 `json:"user"`
+	System  float64 `json:"system"`
+	Nice    float64 `json:"nice"`
+	Iowait  float64 `json:"iowait"`
+	Irq     float64 `json:"irq"`
+	Softirq float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Idle    float64 `json:"idle"`
+}
+
+// CPUStats CPU详细状态
+type CPUStats struct {
+	Percent   float64      `json:"percent"`
+	Model     string       `json:"model"`
+	Cores     int          `json:"cores"`   // 物理核心数
+	Threads   int          `json:"threads"` // 逻辑CPU数
+	Mhz       float64      `json:"mhz"`     // 当前平均频率
+	PerCore   []float64    `json:"perCore"`
+	Breakdown CPUBreakdown `json:"breakdown"`
+	Load      struct {
+		Load1  float64 `json:"load1"`
+		Load5  float64 `json:"load5"`
+		Load15 float64 `json:"load15"`
+	} `json:"load"`
+	ContextSwitches float64 `json:"contextSwitches"` // 每秒上下文切换次数
+	Interrupts      float64 `json:"interrupts"`      // 每秒中断次数
+	ProcsRunning    int     `json:"procsRunning"`
+	ProcsBlocked    int     `json:"procsBlocked"`
+}
+
+// /proc/stat 中的计数器
+type kernelCounters struct {
+	ctxt         uint64
+	intr         uint64
+	procsRunning int
+	procsBlocked int
+}
+
+// CPU采样器，通过两次采样之间的差值计算使用率，只由采集器调用
+type cpuSampler struct {
+	lastTotal    cpu.TimesStat
+	lastPerCore  []cpu.TimesStat
+	lastCounters kernelCounters
+	lastTime     time.Time
+	cores        int
+	threads      int
+}
+
+var cpuStatsSampler = &cpuSampler{}
+
+// 读取 /proc/stat 中的上下文切换、中断和进程状态计数
+func readKernelCounters() (kernelCounters, error) {
+	var counters kernelCounters
+
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return counters, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "ctxt":
+			counters.ctxt, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "intr":
+			// 第一个值是所有中断的总数
+			counters.intr, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "procs_running":
+			counters.procsRunning, _ = strconv.Atoi(fields[1])
+		case "procs_blocked":
+			counters.procsBlocked, _ = strconv.Atoi(fields[1])
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// 读取当前CPU平均频率，优先使用 cpufreq，否则读取 /proc/cpuinfo
+func readCPUFrequency() float64 {
+	var total float64
+	var count int
+
+	for i := 0; ; i++ {
+		data, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/scaling_cur_freq", i))
+		if err != nil {
+			break
+		}
+		if khz, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64); err == nil {
+			total += khz / 1000
+			count++
+		}
+	}
+
+	if count == 0 {
+		data, err := os.ReadFile("/proc/cpuinfo")
+		if err != nil {
+			return 0
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(line, "cpu MHz") {
+				continue
+			}
+			if idx := strings.Index(line, ":"); idx >= 0 {
+				if mhz, err := strconv.ParseFloat(strings.TrimSpace(line[idx+1:]), 64); err == nil {
+					total += mhz
+					count++
+				}
+			}
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// 计算两次CPU时间之间的占比
+func cpuBreakdown(prev, cur cpu.TimesStat) (CPUBreakdown, float64) {
+	// guest 时间已计入 user/nice，不重复累加
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal + t.Idle
+	}
+	delta := total(cur) - total(prev)
+	if delta <= 0 {
+		return CPUBreakdown{Idle: 100}, 0
+	}
+
+	pct := func(a, b float64) float64 {
+		v := (b - a) / delta * 100
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	b := CPUBreakdown{
+		User:    pct(prev.User, cur.User),
+		System:  pct(prev.System, cur.System),
+		Nice:    pct(prev.Nice, cur.Nice),
+		Iowait:  pct(prev.Iowait, cur.Iowait),
+		Irq:     pct(prev.Irq, cur.Irq),
+		Softirq: pct(prev.Softirq, cur.Softirq),
+		Steal:   pct(prev.Steal, cur.Steal),
+		Idle:    pct(prev.Idle, cur.Idle),
+	}
+	// 与 top 一致，iowait 不计入使用率
+	busy := 100 - b.Idle - b.Iowait
+	if busy < 0 {
+		busy = 0
+	}
+	return b, busy
+}
+
+// 采集一次CPU状态，第一次调用只记录基准值
+func (s *cpuSampler) sample() (*CPUStats, error) {
+	now := time.Now()
+
+	totals, err := cpu.Times(false)
+	if err != nil {
+		return nil, err
+	}
+	perCore, err := cpu.Times(true)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := readKernelCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.threads == 0 {
+		s.threads, _ = cpu.Counts(true)
+		s.cores, _ = cpu.Counts(false)
+	}
+
+	stats := &CPUStats{
+		Model:        getCPUModel(),
+		Cores:        s.cores,
+		Threads:      s.threads,
+		Mhz:          readCPUFrequency(),
+		ProcsRunning: counters.procsRunning,
+		ProcsBlocked: counters.procsBlocked,
+		PerCore:      make([]float64, len(perCore)),
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		stats.Load.Load1 = avg.Load1
+		stats.Load.Load5 = avg.Load5
+		stats.Load.Load15 = avg.Load15
+	}
+
+	if !s.lastTime.IsZero() && len(totals) > 0 {
+		stats.Breakdown, stats.Percent = cpuBreakdown(s.lastTotal, totals[0])
+		for i := range perCore {
+			if i < len(s.lastPerCore) {
+				_, stats.PerCore[i] = cpuBreakdown(s.lastPerCore[i], perCore[i])
+			}
+		}
+
+		elapsed := now.Sub(s.lastTime).Seconds()
+		// 计数器回绕或重置时不计算速率
+		if elapsed > 0 && counters.ctxt >= s.lastCounters.ctxt {
+			stats.ContextSwitches = float64(counters.ctxt-s.lastCounters.ctxt) / elapsed
+		}
+		if elapsed > 0 && counters.intr >= s.lastCounters.intr {
+			stats.Interrupts = float64(counters.intr-s.lastCounters.intr) / elapsed
+		}
+	}
+
+	if len(totals) > 0 {
+		s.lastTotal = totals[0]
+	}
+	s.lastPerCore = perCore
+	s.lastCounters = counters
+	s.lastTime = now
+
+	return stats, nil
+}
+
+// CPU状态对应的历史数据序列
+func cpuStatsValues(stats *CPUStats, values map[string]float64) {
+	values["cpu"] = stats.Percent
+	values["cpu.user"] = stats.Breakdown.User
+	values["cpu.system"] = stats.Breakdown.System
+	values["cpu.nice"] = stats.Breakdown.Nice
+	values["cpu.iowait"] = stats.Breakdown.Iowait
+	values["cpu.irq"] = stats.Breakdown.Irq
+	values["cpu.softirq"] = stats.Breakdown.Softirq
+	values["cpu.steal"] = stats.Breakdown.Steal
+	values["cpu.mhz"] = stats.Mhz
+	values["cpu.ctx_switches"] = stats.ContextSwitches
+	values["cpu.interrupts"] = stats.Interrupts
+	values["cpu.procs_running"] = float64(stats.ProcsRunning)
+	values["cpu.procs_blocked"] = float64(stats.ProcsBlocked)
+	values["load.1"] = stats.Load.Load1
+	values["load.5"] = stats.Load.Load5
+	values["load.15"] = stats.Load.Load15
+	for i, pct := range stats.PerCore {
+		values["cpu.core."+strconv.Itoa(i)] = pct
+	}
+}
@@ -0,0 +1,870 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 计划任务管理：用户 crontab 以及 /etc/crontab、/etc/cron.d 下的系统任务
+//
+// 面板创建或修改的任务会在任务行前加一行标记注释，命令通过包装脚本执行，
+// 由包装脚本记录最近一次运行的输出和退出码。禁用的任务以注释形式保留。
+// 未由面板管理的任务修改后会转为面板管理。
+//
+// 包装脚本和运行记录放在固定的系统目录中，而不是面板的 data 目录：
+// 面板安装目录和 data 目录通常只有 root 可以进入，普通用户的任务无法执行其中的脚本。
+
+const (
+	cronLibDir      = "/var/lib/gegecp/cron"
+	cronWrapperName = "cron-run.sh"
+	systemCrontab   = "/etc/crontab"
+	cronDDir        = "/etc/cron.d"
+
+	// 面板管理的任务在任务行前加的标记注释
+	cronJobMarker = "# gegecp:job "
+	// 被禁用任务的行前缀
+	cronDisabledPrefix = "#disabled# "
+
+	// 保存的运行输出上限
+	cronOutputLimit    = 64 * 1024
+	cronCommandTimeout = 10 * time.Second
+	defaultCronRuns    = 5
+	maxCronRuns        = 50
+)
+
+var (
+	// 串行化 crontab 的读改写
+	cronMutex sync.Mutex
+
+	cronWrapperPath = filepath.Join(cronLibDir, cronWrapperName)
+	cronRunsDir     = filepath.Join(cronLibDir, "runs")
+	// 不同发行版用户 crontab 的存放目录
+	cronSpoolDirs = []string{"/var/spool/cron/crontabs", "/var/spool/cron"}
+
+	// cron.d 中文件名包含点等字符时会被 cron 忽略
+	cronFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	cronUserPattern     = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*\$?$`)
+	cronJobIDPattern    = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+	errCronJobNotFound = errors.New("任务不存在")
+)
+
+// 包装脚本：执行任务并记录输出和退出码，输出仍然写到标准输出以保留 cron 的邮件通知
+const cronWrapperScript = `#!/bin/sh
+# 由面板生成：执行计划任务并记录输出和退出码，请勿手动修改
+runs=%s
+job="$1"
+dir="$runs/$(id -un)"
+start=$(date +%%s)
+echo "$start" >"$dir/$job.running" 2>/dev/null
+"${SHELL:-/bin/sh}" -c "$2" >"$dir/$job.out.tmp" 2>&1
+code=$?
+end=$(date +%%s)
+tail -c %d "$dir/$job.out.tmp" >"$dir/$job.out" 2>/dev/null
+cat "$dir/$job.out.tmp" 2>/dev/null
+rm -f "$dir/$job.out.tmp" "$dir/$job.running"
+echo "$start $end $code" >"$dir/$job.status" 2>/dev/null
+exit $code
+`
+
+// CronRun 任务最近一次运行的结果
+type CronRun struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	ExitCode   int       `json:"exitCode"`
+	Output     string    `json:"output,omitempty"`
+}
+
+// CronJob 计划任务
+type CronJob struct {
+	ID string `json:"id"`
+	// user:<用户名> 或 crontab 文件路径
+	Source   string      `json:"source"`
+	User     string      `json:"user"`
+	Name     string      `json:"name"`
+	Schedule string      `json:"schedule"`
+	Command  string      `json:"command"`
+	Enabled  bool        `json:"enabled"`
+	Managed  bool        `json:"managed"`
+	Line     int         `json:"line,omitempty"`
+	Running  bool        `json:"running"`
+	NextRuns []time.Time `json:"nextRuns"`
+	LastRun  *CronRun    `json:"lastRun,omitempty"`
+}
+
+// crontab 的来源：用户 crontab 或系统 crontab 文件
+type cronSource struct {
+	user string
+	path string
+}
+
+func parseCronSource(s string) (cronSource, error) {
+	if name, ok := strings.CutPrefix(s, "user:"); ok {
+		if !cronUserPattern.MatchString(name) {
+			return cronSource{}, errors.New("无效的用户名")
+		}
+		if _, err := user.Lookup(name); err != nil {
+			return cronSource{}, fmt.Errorf("用户不存在: %s", name)
+		}
+		return cronSource{user: name}, nil
+	}
+
+	path := filepath.Clean(s)
+	if path == systemCrontab {
+		return cronSource{path: path}, nil
+	}
+	if filepath.Dir(path) == cronDDir && cronFileNamePattern.MatchString(filepath.Base(path)) {
+		return cronSource{path: path}, nil
+	}
+	return cronSource{}, errors.New("来源必须是 user:<用户名>、/etc/crontab 或 /etc/cron.d 下的文件（文件名只能包含字母、数字、下划线和横线）")
+}
+
+func (s cronSource) String() string {
+	if s.path != "" {
+		return s.path
+	}
+	return "user:" + s.user
+}
+
+// 系统 crontab 的任务行包含用户字段
+func (s cronSource) system() bool {
+	return s.path != ""
+}
+
+// 当前用户修改自己的 crontab 时不能使用 -u
+func crontabArgs(name string, args ...string) []string {
+	if current, err := user.Current(); err == nil && current.Username == name {
+		return args
+	}
+	return append([]string{"-u", name}, args...)
+}
+
+func requireCrontab() error {
+	if _, err := exec.LookPath("crontab"); err != nil {
+		return errors.New("未找到 crontab 命令，请先安装 cron")
+	}
+	return nil
+}
+
+func (s cronSource) read(ctx context.Context) (string, error) {
+	if s.system() {
+		data, err := os.ReadFile(s.path)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return string(data), err
+	}
+
+	if err := requireCrontab(); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cronCommandTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "crontab", crontabArgs(s.user, "-l")...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// 用户还没有 crontab
+		if strings.Contains(stderr.String(), "no crontab") {
+			return "", nil
+		}
+		return "", fmt.Errorf("读取 crontab 失败: %s", strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+func (s cronSource) write(ctx context.Context, content string) ([]ValidationResult, error) {
+	data := []byte(content)
+	if s.system() {
+		validation, err := validateFileContent(s.path, data)
+		if err != nil {
+			return validation, err
+		}
+		original, err := os.Stat(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return validation, err
+		}
+		if original != nil {
+			if _, err := snapshotFile(s.path, "面板修改计划任务前自动备份"); err != nil {
+				slog.WarnContext(ctx, "保存历史版本失败", "path", s.path, "error", err)
+			}
+		}
+		return validation, writeFileAtomic(s.path, data, original)
+	}
+
+	result := ValidationResult{Validator: "crontab", Passed: true}
+	if output, err := validateCrontab(data, false); err != nil {
+		result.Passed = false
+		result.Output = output
+		return []ValidationResult{result}, fmt.Errorf("crontab 校验失败")
+	}
+	validation := []ValidationResult{result}
+
+	if err := requireCrontab(); err != nil {
+		return validation, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cronCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "crontab", crontabArgs(s.user, "-")...)
+	cmd.Stdin = strings.NewReader(content)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return validation, fmt.Errorf("写入 crontab 失败: %s", strings.TrimSpace(string(out)))
+	}
+	return validation, nil
+}
+
+// 列出所有存在的 crontab 来源
+func listCronSources() []cronSource {
+	var sources []cronSource
+	if _, err := os.Stat(systemCrontab); err == nil {
+		sources = append(sources, cronSource{path: systemCrontab})
+	}
+	if entries, err := os.ReadDir(cronDDir); err == nil {
+		for _, e := range entries {
+			if e.Type().IsRegular() && cronFileNamePattern.MatchString(e.Name()) {
+				sources = append(sources, cronSource{path: filepath.Join(cronDDir, e.Name())})
+			}
+		}
+	}
+
+	users := map[string]bool{}
+	if current, err := user.Current(); err == nil {
+		users[current.Username] = true
+	}
+	for _, dir := range cronSpoolDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && cronUserPattern.MatchString(e.Name()) {
+				if _, err := user.Lookup(e.Name()); err == nil {
+					users[e.Name()] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sources = append(sources, cronSource{user: name})
+	}
+	return sources
+}
+
+// crontab 中的一行，面板管理的任务包含标记注释和任务行两行
+type cronLine struct {
+	text string
+	job  *CronJob
+}
+
+// 从行首截取 n 个空白分隔的字段，返回字段和剩余部分
+func cutCronFields(line string, n int) ([]string, string) {
+	var fields []string
+	rest := line
+	for len(fields) < n {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			break
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimLeft(rest, " \t")
+}
+
+// 解析任务行，注释、空行和环境变量返回 nil
+func parseCronJobLine(src cronSource, text string) *CronJob {
+	if text == "" || strings.HasPrefix(text, "#") {
+		return nil
+	}
+	first, _ := cutCronFields(text, 2)
+	if strings.Contains(first[0], "=") || (len(first) > 1 && strings.HasPrefix(first[1], "=")) {
+		return nil
+	}
+
+	n := 5
+	if strings.HasPrefix(first[0], "@") {
+		n = 1
+	}
+	if src.system() {
+		n++
+	}
+	fields, command := cutCronFields(text, n)
+	if len(fields) < n || command == "" {
+		return nil
+	}
+
+	job := &CronJob{Source: src.String(), User: src.user, Command: command}
+	if src.system() {
+		job.User = fields[n-1]
+		fields = fields[:n-1]
+	}
+	job.Schedule = strings.Join(fields, " ")
+	return job
+}
+
+// 未由面板管理的任务以行内容生成 ID
+func unmanagedCronID(text string) string {
+	sum := sha1.Sum([]byte(text))
+	return "line-" + hex.EncodeToString(sum[:5])
+}
+
+func newCronJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func parseCrontab(src cronSource, content string) []cronLine {
+	if content == "" {
+		return nil
+	}
+
+	var lines []cronLine
+	marker := ""
+	for i, text := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		trimmed := strings.TrimSpace(text)
+
+		if marker != "" {
+			prev := marker
+			marker = ""
+			body, enabled := trimmed, true
+			if rest, ok := strings.CutPrefix(body, cronDisabledPrefix); ok {
+				body, enabled = strings.TrimSpace(rest), false
+			}
+			if job := parseCronJobLine(src, body); job != nil {
+				job.ID, job.Name, _ = strings.Cut(strings.TrimPrefix(strings.TrimSpace(prev), cronJobMarker), " ")
+				job.Managed = true
+				job.Enabled = enabled
+				job.Line = i + 1
+				if id, command, ok := unwrapCronCommand(job.Command); ok && id == job.ID {
+					job.Command = command
+				}
+				lines = append(lines, cronLine{text: prev + "\n" + text, job: job})
+				continue
+			}
+			lines = append(lines, cronLine{text: prev})
+		}
+
+		if strings.HasPrefix(trimmed, cronJobMarker) {
+			marker = text
+			continue
+		}
+		job := parseCronJobLine(src, trimmed)
+		if job != nil {
+			job.ID = unmanagedCronID(trimmed)
+			job.Enabled = true
+			job.Line = i + 1
+		}
+		lines = append(lines, cronLine{text: text, job: job})
+	}
+	if marker != "" {
+		lines = append(lines, cronLine{text: marker})
+	}
+	return lines
+}
+
+func renderCrontab(lines []cronLine) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func findCronJob(lines []cronLine, id string) int {
+	for i, l := range lines {
+		if l.job != nil && l.job.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellUnquote(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", false
+	}
+	unquoted := strings.ReplaceAll(s[1:len(s)-1], `'\''`, "'")
+	return unquoted, shellQuote(unquoted) == s
+}
+
+// cron 会把命令中未转义的 % 替换为换行
+func wrapCronCommand(wrapper, id, command string) string {
+	return strings.ReplaceAll(shellQuote(wrapper)+" "+id+" "+shellQuote(command), "%", `\%`)
+}
+
+func unwrapCronCommand(command string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(strings.ReplaceAll(command, `\%`, "%"), shellQuote(cronWrapperPath)+" ")
+	if !ok {
+		return "", "", false
+	}
+	id, quoted, _ := strings.Cut(rest, " ")
+	original, ok := shellUnquote(quoted)
+	return id, original, ok
+}
+
+func (j *CronJob) render(src cronSource, wrapper string) string {
+	line := j.Schedule
+	if src.system() {
+		line += " " + j.User
+	}
+	line += " " + wrapCronCommand(wrapper, j.ID, j.Command)
+	if !j.Enabled {
+		line = cronDisabledPrefix + line
+	}
+	return strings.TrimSpace(cronJobMarker+j.ID+" "+j.Name) + "\n" + line
+}
+
+// 生成包装脚本，并为任务所属用户准备运行记录目录；确认该用户能执行包装脚本后才返回
+func prepareCronJob(username string) (string, error) {
+	// 逐级创建并设置权限，保证所有用户都能进入，不受 umask 影响
+	for _, dir := range []string{filepath.Dir(cronLibDir), cronLibDir, cronRunsDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		if err := os.Chmod(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	script := []byte(fmt.Sprintf(cronWrapperScript, shellQuote(cronRunsDir), cronOutputLimit))
+	if current, err := os.ReadFile(cronWrapperPath); err != nil || !bytes.Equal(current, script) {
+		if err := writeFileAtomic(cronWrapperPath, script, nil); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Chmod(cronWrapperPath, 0755); err != nil {
+		return "", err
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return "", fmt.Errorf("用户不存在: %s", username)
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	dir := filepath.Join(cronRunsDir, username)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return "", err
+	}
+	if err := checkCronWrapperAccess(uid, gid, dir); err != nil {
+		return "", fmt.Errorf("用户 %s 无法执行 %s 或写入 %s，请检查目录权限: %v", username, cronWrapperPath, dir, err)
+	}
+	return cronWrapperPath, nil
+}
+
+// 以任务所属用户的身份检查包装脚本可执行、运行记录目录可写
+func checkCronWrapperAccess(uid, gid int, dir string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cronCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", `test -x "$1" && test -w "$2"`, "sh", cronWrapperPath, dir)
+	if uid != os.Geteuid() {
+		if os.Geteuid() != 0 {
+			// 非 root 运行时无法切换用户，也无法修改其他用户的 crontab
+			return nil
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+		}
+	}
+	return cmd.Run()
+}
+
+// 读取任务最近一次的运行结果
+func readCronRun(username, id string, withOutput bool) (*CronRun, bool) {
+	if !cronUserPattern.MatchString(username) || !cronJobIDPattern.MatchString(id) {
+		return nil, false
+	}
+	dir := filepath.Join(cronRunsDir, username)
+	_, err := os.Stat(filepath.Join(dir, id+".running"))
+	running := err == nil
+
+	data, err := os.ReadFile(filepath.Join(dir, id+".status"))
+	if err != nil {
+		return nil, running
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return nil, running
+	}
+	start, err1 := strconv.ParseInt(fields[0], 10, 64)
+	end, err2 := strconv.ParseInt(fields[1], 10, 64)
+	code, err3 := strconv.Atoi(fields[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, running
+	}
+
+	run := &CronRun{StartedAt: time.Unix(start, 0), FinishedAt: time.Unix(end, 0), ExitCode: code}
+	if withOutput {
+		if out, err := os.ReadFile(filepath.Join(dir, id+".out")); err == nil {
+			run.Output = string(out)
+		}
+	}
+	return run, running
+}
+
+func removeCronRun(username, id string) {
+	if !cronUserPattern.MatchString(username) || !cronJobIDPattern.MatchString(id) {
+		return
+	}
+	for _, ext := range []string{".status", ".out", ".running"} {
+		os.Remove(filepath.Join(cronRunsDir, username, id+ext))
+	}
+}
+
+// 计算接下来的 n 次运行时间，@reboot 没有固定时间
+func cronNextRuns(schedule string, n int) ([]time.Time, error) {
+	if err := validateCronSchedule(schedule); err != nil {
+		return nil, err
+	}
+	runs := []time.Time{}
+	if schedule == "@reboot" {
+		return runs, nil
+	}
+	sched, err := cronScheduleParser.Parse(schedule)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	for len(runs) < n {
+		t = sched.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs, nil
+}
+
+func (j *CronJob) fill(runs int, withOutput bool) {
+	j.NextRuns, _ = cronNextRuns(j.Schedule, runs)
+	if j.NextRuns == nil {
+		j.NextRuns = []time.Time{}
+	}
+	if j.Managed {
+		j.LastRun, j.Running = readCronRun(j.User, j.ID, withOutput)
+	}
+}
+
+func cronRunsFromRequest(c *gin.Context) int {
+	runs, err := strconv.Atoi(c.DefaultQuery("runs", strconv.Itoa(defaultCronRuns)))
+	if err != nil || runs < 0 {
+		return defaultCronRuns
+	}
+	if runs > maxCronRuns {
+		return maxCronRuns
+	}
+	return runs
+}
+
+// 修改 crontab：读取、交给 fn 修改后写回
+func updateCrontab(ctx context.Context, src cronSource, fn func([]cronLine) ([]cronLine, error)) ([]ValidationResult, error) {
+	cronMutex.Lock()
+	defer cronMutex.Unlock()
+
+	content, err := src.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := fn(parseCrontab(src, content))
+	if err != nil {
+		return nil, err
+	}
+	return src.write(ctx, renderCrontab(lines))
+}
+
+// 写入失败时的响应：校验失败返回 422，任务不存在返回 404
+func cronWriteError(c *gin.Context, validation []ValidationResult, err error) {
+	switch {
+	case err == errCronJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case len(validation) > 0 && !validation[len(validation)-1].Passed:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "validation": validation})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "validation": validation})
+	}
+}
+
+// 处理计划任务列表请求
+//
+// 参数：source 为 user:<用户名> 或 crontab 文件路径，不指定时列出所有来源；
+// runs 为每个任务返回的后续运行次数
+func HandleCronList(c *gin.Context) {
+	var sources []cronSource
+	if s := c.Query("source"); s != "" {
+		src, err := parseCronSource(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sources = append(sources, src)
+	} else {
+		sources = listCronSources()
+	}
+
+	runs := cronRunsFromRequest(c)
+	jobs := []*CronJob{}
+	names := make([]string, 0, len(sources))
+	errs := gin.H{}
+	for _, src := range sources {
+		names = append(names, src.String())
+		content, err := src.read(c.Request.Context())
+		if err != nil {
+			errs[src.String()] = err.Error()
+			continue
+		}
+		for _, l := range parseCrontab(src, content) {
+			if l.job != nil {
+				l.job.fill(runs, false)
+				jobs = append(jobs, l.job)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":    jobs,
+		"total":   len(jobs),
+		"sources": names,
+		"errors":  errs,
+	})
+}
+
+// 处理计划任务详情请求，包含最近一次运行的输出
+func HandleCronJobGet(c *gin.Context) {
+	src, err := parseCronSource(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := src.read(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	lines := parseCrontab(src, content)
+	i := findCronJob(lines, c.Query("id"))
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": errCronJobNotFound.Error()})
+		return
+	}
+	job := lines[i].job
+	job.fill(cronRunsFromRequest(c), true)
+	c.JSON(http.StatusOK, job)
+}
+
+// 处理计划任务的创建和修改，id 为空时新建
+func HandleCronJobSave(c *gin.Context) {
+	var req struct {
+		Source   string `json:"source"`
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Schedule string `json:"schedule"`
+		Command  string `json:"command"`
+		// 仅系统 crontab 需要
+		User    string `json:"user"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	src, err := parseCronSource(req.Source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job := &CronJob{
+		Source:   src.String(),
+		User:     src.user,
+		Name:     strings.TrimSpace(req.Name),
+		Schedule: strings.Join(strings.Fields(req.Schedule), " "),
+		Command:  strings.TrimSpace(req.Command),
+		Enabled:  true,
+		Managed:  true,
+	}
+	if err := singleLine("名称", job.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCronSchedule(job.Schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间表达式: " + err.Error()})
+		return
+	}
+	if job.Command == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "命令不能为空"})
+		return
+	}
+	if err := singleLine("命令", job.Command); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if src.system() {
+		job.User = strings.TrimSpace(req.User)
+		if !cronUserPattern.MatchString(job.User) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户名"})
+			return
+		}
+	}
+	if req.Enabled != nil {
+		job.Enabled = *req.Enabled
+	}
+
+	wrapper, err := prepareCronJob(job.User)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	validation, err := updateCrontab(c.Request.Context(), src, func(lines []cronLine) ([]cronLine, error) {
+		if req.ID == "" {
+			job.ID = newCronJobID()
+			return append(lines, cronLine{text: job.render(src, wrapper), job: job}), nil
+		}
+		i := findCronJob(lines, req.ID)
+		if i < 0 {
+			return nil, errCronJobNotFound
+		}
+		existing := lines[i].job
+		job.ID = existing.ID
+		if !existing.Managed {
+			job.ID = newCronJobID()
+		}
+		if req.Enabled == nil {
+			job.Enabled = existing.Enabled
+		}
+		lines[i] = cronLine{text: job.render(src, wrapper), job: job}
+		return lines, nil
+	})
+	if err != nil {
+		cronWriteError(c, validation, err)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "计划任务已保存", "source", job.Source, "id", job.ID, "schedule", job.Schedule)
+	job.fill(defaultCronRuns, false)
+	c.JSON(http.StatusOK, gin.H{"message": "任务已保存", "job": job, "validation": validation})
+}
+
+// 处理计划任务的启用和禁用
+func HandleCronJobToggle(c *gin.Context) {
+	var req struct {
+		Source  string `json:"source"`
+		ID      string `json:"id"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	src, err := parseCronSource(req.Source)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var job *CronJob
+	validation, err := updateCrontab(c.Request.Context(), src, func(lines []cronLine) ([]cronLine, error) {
+		i := findCronJob(lines, req.ID)
+		if i < 0 {
+			return nil, errCronJobNotFound
+		}
+		job = lines[i].job
+		if !job.Managed {
+			job.ID = newCronJobID()
+			job.Managed = true
+		}
+		wrapper, err := prepareCronJob(job.User)
+		if err != nil {
+			return nil, err
+		}
+		job.Enabled = req.Enabled
+		lines[i] = cronLine{text: job.render(src, wrapper), job: job}
+		return lines, nil
+	})
+	if err != nil {
+		cronWriteError(c, validation, err)
+		return
+	}
+
+	job.fill(defaultCronRuns, false)
+	c.JSON(http.StatusOK, gin.H{"message": "任务已更新", "job": job})
+}
+
+// 处理计划任务删除请求
+func HandleCronJobDelete(c *gin.Context) {
+	src, err := parseCronSource(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var job *CronJob
+	validation, err := updateCrontab(c.Request.Context(), src, func(lines []cronLine) ([]cronLine, error) {
+		i := findCronJob(lines, c.Query("id"))
+		if i < 0 {
+			return nil, errCronJobNotFound
+		}
+		job = lines[i].job
+		return append(lines[:i], lines[i+1:]...), nil
+	})
+	if err != nil {
+		cronWriteError(c, validation, err)
+		return
+	}
+
+	if job.Managed {
+		removeCronRun(job.User, job.ID)
+	}
+	slog.InfoContext(c.Request.Context(), "计划任务已删除", "source", job.Source, "id", job.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+}
+
+// 处理时间表达式预览请求，返回后续的运行时间
+func HandleCronSchedulePreview(c *gin.Context) {
+	schedule := strings.Join(strings.Fields(c.Query("schedule")), " ")
+	runs, err := cronNextRuns(schedule, cronRunsFromRequest(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间表达式: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule, "nextRuns": runs})
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 默认的统一diff上下文行数
+const diffContextLines = 3
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// 将文本拆分为行，保留最后一行是否有换行的信息
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// 编辑距离超过该值时不再计算最短编辑脚本，直接按整体替换处理
+const maxDiffEdits = 2000
+
+// 使用 Myers 算法计算两组行之间的最短编辑脚本
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	// trace[d] 保存第 d 步开始时 k ∈ [-d, d] 的状态
+	var trace [][]int
+
+	for d := 0; d <= max && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace, d)
+			}
+		}
+	}
+
+	// 差异过大，整体删除后整体插入
+	result := make([]diffLine, 0, n+m)
+	for _, line := range a {
+		result = append(result, diffLine{diffDelete, line})
+	}
+	for _, line := range b {
+		result = append(result, diffLine{diffInsert, line})
+	}
+	return result
+}
+
+// 根据记录的搜索路径回溯出编辑脚本
+func backtrackDiff(a, b []string, trace [][]int, d int) []diffLine {
+	x, y := len(a), len(b)
+	var result []diffLine
+
+	for ; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			result = append(result, diffLine{diffEqual, a[x]})
+		}
+		if x == prevX {
+			y--
+			result = append(result, diffLine{diffInsert, b[y]})
+		} else {
+			x--
+			result = append(result, diffLine{diffDelete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		result = append(result, diffLine{diffEqual, a[x]})
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// 生成统一格式（unified）的diff文本，内容相同时返回空字符串
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	changed := false
+	for _, l := range lines {
+		if l.Op != diffEqual {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// 每行在原文件和新文件中的行号
+	aLine := make([]int, len(lines))
+	bLine := make([]int, len(lines))
+	ai, bi := 0, 0
+	for i, l := range lines {
+		aLine[i], bLine[i] = ai, bi
+		if l.Op != diffInsert {
+			ai++
+		}
+		if l.Op != diffDelete {
+			bi++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == diffEqual {
+			i++
+			continue
+		}
+
+		// 找到包含当前改动及其上下文的区块
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != diffEqual {
+				end++
+				continue
+			}
+			// 连续相同的行超过两倍上下文时结束区块
+			run := 0
+			for end+run < len(lines) && lines[end+run].Op == diffEqual {
+				run++
+			}
+			if end+run >= len(lines) || run > 2*diffContextLines {
+				if run > diffContextLines {
+					run = diffContextLines
+				}
+				end += run
+				break
+			}
+			end += run
+		}
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.Op != diffInsert {
+				aCount++
+			}
+			if l.Op != diffDelete {
+				bCount++
+			}
+		}
+		aStart, bStart := aLine[start]+1, bLine[start]+1
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+
+		for _, l := range lines[start:end] {
+			prefix := " "
+			switch l.Op {
+			case diffDelete:
+				prefix = "-"
+			case diffInsert:
+				prefix = "+"
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(l.Text)
+			if !strings.HasSuffix(l.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+// MountStats 挂载点的空间和inode使用情况
+type MountStats struct {
+	Device            string  `json:"device"`
+	Mountpoint        string  `json:"mountpoint"`
+	Fstype            string  `json:"fstype"`
+	ReadOnly          bool    `json:"readOnly"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	Free              uint64  `json:"free"`
+	UsedPercent       float64 `json:"usedPercent"`
+	InodesTotal       uint64  `json:"inodesTotal"`
+	InodesUsed        uint64  `json:"inodesUsed"`
+	InodesFree        uint64  `json:"inodesFree"`
+	InodesUsedPercent float64 `json:"inodesUsedPercent"`
+}
+
+// DiskIOStats 块设备的I/O速率
+type DiskIOStats struct {
+	Device       string  `json:"device"`
+	ReadIOPS     float64 `json:"readIops"`
+	WriteIOPS    float64 `json:"writeIops"`
+	ReadBytes    float64 `json:"readBytes"`    // 字节/秒
+	WriteBytes   float64 `json:"writeBytes"`   // 字节/秒
+	ReadLatency  float64 `json:"readLatency"`  // 平均每次读耗时（毫秒）
+	WriteLatency float64 `json:"writeLatency"` // 平均每次写耗时（毫秒）
+	Utilization  float64 `json:"utilization"`  // 设备忙碌时间占比（%）
+	InProgress   uint64  `json:"inProgress"`
+}
+
+// 磁盘I/O采样器，只由采集器调用
+type diskSampler struct {
+	last     map[string]disk.IOCountersStat
+	lastTime time.Time
+}
+
+var diskStatsSampler = &diskSampler{}
+
+// 不统计的虚拟块设备
+var ignoredBlockDevices = []string{"loop", "ram", "zram", "fd", "sr"}
+
+// 采集所有真实文件系统挂载点的使用情况
+func collectMounts() ([]MountStats, error) {
+	// all=false 时只返回非 nodev 的文件系统，排除 proc、tmpfs、overlay 等
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var mounts []MountStats
+	for _, p := range partitions {
+		if seen[p.Mountpoint] || strings.HasPrefix(p.Device, "/dev/loop") {
+			continue
+		}
+		seen[p.Mountpoint] = true
+
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+
+		readOnly := false
+		for _, opt := range strings.Split(p.Opts, ",") {
+			if opt == "ro" {
+				readOnly = true
+				break
+			}
+		}
+
+		mounts = append(mounts, MountStats{
+			Device:            p.Device,
+			Mountpoint:        p.Mountpoint,
+			Fstype:            p.Fstype,
+			ReadOnly:          readOnly,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesFree:        usage.InodesFree,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+	}
+
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Mountpoint < mounts[j].Mountpoint })
+	return mounts, nil
+}
+
+// 采集块设备的I/O速率，第一次调用只记录基准值
+func (s *diskSampler) sample() ([]DiskIOStats, error) {
+	now := time.Now()
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []DiskIOStats
+	elapsed := now.Sub(s.lastTime).Seconds()
+	for name, cur := range counters {
+		ignored := false
+		for _, prefix := range ignoredBlockDevices {
+			if strings.HasPrefix(name, prefix) {
+				ignored = true
+				break
+			}
+		}
+		if ignored {
+			continue
+		}
+
+		prev, ok := s.last[name]
+		// 计数器重置（如设备重新挂载）时跳过本次
+		if !ok || elapsed <= 0 || cur.ReadCount < prev.ReadCount || cur.WriteCount < prev.WriteCount ||
+			cur.ReadBytes < prev.ReadBytes || cur.WriteBytes < prev.WriteBytes || cur.IoTime < prev.IoTime {
+			continue
+		}
+
+		reads := float64(cur.ReadCount - prev.ReadCount)
+		writes := float64(cur.WriteCount - prev.WriteCount)
+		io := DiskIOStats{
+			Device:     name,
+			ReadIOPS:   reads / elapsed,
+			WriteIOPS:  writes / elapsed,
+			ReadBytes:  float64(cur.ReadBytes-prev.ReadBytes) / elapsed,
+			WriteBytes: float64(cur.WriteBytes-prev.WriteBytes) / elapsed,
+			InProgress: cur.IopsInProgress,
+		}
+		if reads > 0 && cur.ReadTime >= prev.ReadTime {
+			io.ReadLatency = float64(cur.ReadTime-prev.ReadTime) / reads
+		}
+		if writes > 0 && cur.WriteTime >= prev.WriteTime {
+			io.WriteLatency = float64(cur.WriteTime-prev.WriteTime) / writes
+		}
+		// IoTime 单位为毫秒
+		io.Utilization = float64(cur.IoTime-prev.IoTime) / (elapsed * 1000) * 100
+		if io.Utilization > 100 {
+			io.Utilization = 100
+		}
+		stats = append(stats, io)
+	}
+
+	s.last = counters
+	s.lastTime = now
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Device < stats[j].Device })
+	return stats, nil
+}
+
+// 磁盘状态对应的历史数据序列
+func diskStatsValues(mounts []MountStats, io []DiskIOStats, values map[string]float64) {
+	for _, m := range mounts {
+		values["disk.used_percent:"+m.Mountpoint] = m.UsedPercent
+		values["disk.inodes_percent:"+m.Mountpoint] = m.InodesUsedPercent
+	}
+	for _, d := range io {
+		values["diskio.read_iops:"+d.Device] = d.ReadIOPS
+		values["diskio.write_iops:"+d.Device] = d.WriteIOPS
+		values["diskio.read_bytes:"+d.Device] = d.ReadBytes
+		values["diskio.write_bytes:"+d.Device] = d.WriteBytes
+		values["diskio.read_latency:"+d.Device] = d.ReadLatency
+		values["diskio.write_latency:"+d.Device] = d.WriteLatency
+		values["diskio.util:"+d.Device] = d.Utilization
+	}
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"gegecp/config"
+	"gegecp/middleware"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/process"
+)
+
+// 面板自身的运行统计
+var (
+	activeTerminalSessions atomic.Int64
+	loginFailures          atomic.Uint64
+	panelStartTime         = time.Now()
+)
+
+// OpenMetrics 文本格式输出
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 输出指标族的类型和说明
+func (w *metricsWriter) family(name, typ, help string) {
+	w.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+	w.buf.WriteString("# HELP " + name + " " + help + "\n")
+}
+
+// 输出一个样本，labels 为成对的标签名和值
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i] + `="` + metricLabelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteString(" " + formatMetricValue(value) + "\n")
+}
+
+// 只有一个样本的仪表盘指标
+func (w *metricsWriter) gauge(name, help string, value float64) {
+	w.family(name, "gauge", help)
+	w.sample(name, value)
+}
+
+// 检查抓取请求的 token 和来源IP
+func metricsScrapeAllowed(c *gin.Context, cfg *config.MetricsConfig) bool {
+	if cfg.Token != "" {
+		auth := c.GetHeader("Authorization")
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+			return true
+		}
+	}
+
+	// 使用连接的对端地址，不信任 X-Forwarded-For
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	if cfg.Token == "" && len(cfg.AllowedIPs) == 0 {
+		return ip.IsLoopback()
+	}
+	for _, allowed := range cfg.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 主机指标，来自采集器的最新快照
+func writeHostMetrics(w *metricsWriter, s *SystemSnapshot) {
+	w.gauge("gegecp_cpu_usage_percent", "CPU usage in percent.", s.CPU.Percent)
+
+	w.family("gegecp_cpu_core_usage_percent", "gauge", "Per-core CPU usage in percent.")
+	for i, pct := range s.CPU.PerCore {
+		w.sample("gegecp_cpu_core_usage_percent", pct, "core", strconv.Itoa(i))
+	}
+
+	w.family("gegecp_cpu_time_percent", "gauge", "Share of CPU time spent in each mode.")
+	b := s.CPU.Breakdown
+	for _, m := range []struct {
+		mode  string
+		value float64
+	}{
+		{"user", b.User}, {"system", b.System}, {"nice", b.Nice}, {"iowait", b.Iowait},
+		{"irq", b.Irq}, {"softirq", b.Softirq}, {"steal", b.Steal}, {"idle", b.Idle},
+	} {
+		w.sample("gegecp_cpu_time_percent", m.value, "mode", m.mode)
+	}
+
+	w.gauge("gegecp_cpu_frequency_mhz", "Average current CPU frequency.", s.CPU.Mhz)
+	w.gauge("gegecp_load1", "1-minute load average.", s.CPU.Load.Load1)
+	w.gauge("gegecp_load5", "5-minute load average.", s.CPU.Load.Load5)
+	w.gauge("gegecp_load15", "15-minute load average.", s.CPU.Load.Load15)
+	w.gauge("gegecp_context_switches_per_second", "Context switches per second.", s.CPU.ContextSwitches)
+	w.gauge("gegecp_interrupts_per_second", "Interrupts per second.", s.CPU.Interrupts)
+
+	w.gauge("gegecp_memory_total_bytes", "Total physical memory.", float64(s.Memory.Total))
+	w.gauge("gegecp_memory_used_bytes", "Used physical memory.", float64(s.Memory.Used))
+	w.gauge("gegecp_memory_free_bytes", "Free physical memory.", float64(s.Memory.Free))
+	w.gauge("gegecp_swap_total_bytes", "Total swap space.", float64(s.Swap.Total))
+	w.gauge("gegecp_swap_used_bytes", "Used swap space.", float64(s.Swap.Used))
+
+	fsLabels := func(m MountStats) []string {
+		return []string{"mountpoint", m.Mountpoint, "device", m.Device, "fstype", m.Fstype}
+	}
+	for _, f := range []struct {
+		name, help string
+		value      func(m MountStats) uint64
+	}{
+		{"gegecp_filesystem_size_bytes", "Filesystem size.", func(m MountStats) uint64 { return m.Total }},
+		{"gegecp_filesystem_used_bytes", "Filesystem used space.", func(m MountStats) uint64 { return m.Used }},
+		{"gegecp_filesystem_free_bytes", "Filesystem free space.", func(m MountStats) uint64 { return m.Free }},
+		{"gegecp_filesystem_inodes", "Filesystem total inodes.", func(m MountStats) uint64 { return m.InodesTotal }},
+		{"gegecp_filesystem_inodes_used", "Filesystem used inodes.", func(m MountStats) uint64 { return m.InodesUsed }},
+	} {
+		w.family(f.name, "gauge", f.help)
+		for _, m := range s.Mounts {
+			w.sample(f.name, float64(f.value(m)), fsLabels(m)...)
+		}
+	}
+	w.family("gegecp_filesystem_readonly", "gauge", "Whether the filesystem is mounted read-only.")
+	for _, m := range s.Mounts {
+		ro := 0.0
+		if m.ReadOnly {
+			ro = 1
+		}
+		w.sample("gegecp_filesystem_readonly", ro, fsLabels(m)...)
+	}
+
+	for _, f := range []struct {
+		name, help string
+		value      func(d DiskIOStats) float64
+	}{
+		{"gegecp_disk_read_bytes_per_second", "Disk read throughput.", func(d DiskIOStats) float64 { return d.ReadBytes }},
+		{"gegecp_disk_written_bytes_per_second", "Disk write throughput.", func(d DiskIOStats) float64 { return d.WriteBytes }},
+		{"gegecp_disk_reads_per_second", "Disk read operations per second.", func(d DiskIOStats) float64 { return d.ReadIOPS }},
+		{"gegecp_disk_writes_per_second", "Disk write operations per second.", func(d DiskIOStats) float64 { return d.WriteIOPS }},
+		{"gegecp_disk_utilization_percent", "Share of time the device was busy.", func(d DiskIOStats) float64 { return d.Utilization }},
+	} {
+		w.family(f.name, "gauge", f.help)
+		for _, d := range s.DiskIO {
+			w.sample(f.name, f.value(d), "device", d.Device)
+		}
+	}
+
+	// 网卡字节数是内核计数器，以 counter 输出，由 Prometheus 计算速率
+	w.family("gegecp_network_receive_bytes", "counter", "Bytes received per interface.")
+	for _, i := range s.Interfaces {
+		w.sample("gegecp_network_receive_bytes_total", float64(i.BytesRecv), "interface", i.Name)
+	}
+	w.family("gegecp_network_transmit_bytes", "counter", "Bytes transmitted per interface.")
+	for _, i := range s.Interfaces {
+		w.sample("gegecp_network_transmit_bytes_total", float64(i.BytesSent), "interface", i.Name)
+	}
+	w.family("gegecp_network_up", "gauge", "Whether the interface is up.")
+	for _, i := range s.Interfaces {
+		up := 0.0
+		if i.Up {
+			up = 1
+		}
+		w.sample("gegecp_network_up", up, "interface", i.Name)
+	}
+
+	w.family("gegecp_tcp_connections", "gauge", "TCP connections by state.")
+	states := make([]string, 0, len(tcpStates))
+	for _, state := range tcpStates {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		w.sample("gegecp_tcp_connections", float64(s.TCPStates[state]), "state", strings.ToLower(state))
+	}
+
+	w.gauge("gegecp_procs_running", "Processes in runnable state.", float64(s.CPU.ProcsRunning))
+	w.gauge("gegecp_procs_blocked", "Processes blocked waiting for I/O.", float64(s.CPU.ProcsBlocked))
+	if pids, err := process.Pids(); err == nil {
+		w.gauge("gegecp_processes", "Total number of processes.", float64(len(pids)))
+	}
+}
+
+// 面板自身的指标
+func writePanelMetrics(w *metricsWriter) {
+	w.gauge("gegecp_terminal_sessions", "Active web terminal sessions.", float64(activeTerminalSessions.Load()))
+
+	w.family("gegecp_login_failures", "counter", "Failed login attempts.")
+	w.sample("gegecp_login_failures_total", float64(loginFailures.Load()))
+
+	alertMutex.Lock()
+	alertCounts := make(map[[2]string]int)
+	for _, a := range activeAlerts {
+		alertCounts[[2]string{a.State, a.Severity}]++
+	}
+	alertMutex.Unlock()
+	w.family("gegecp_alerts", "gauge", "Active alerts by state and severity.")
+	for _, state := range []string{alertStatePending, alertStateFiring} {
+		for _, severity := range []string{"info", "warning", "critical"} {
+			w.sample("gegecp_alerts", float64(alertCounts[[2]string{state, severity}]), "state", state, "severity", severity)
+		}
+	}
+
+	stats := middleware.RequestStats()
+	w.family("gegecp_http_requests", "counter", "HTTP requests by route and status code.")
+	for _, s := range stats {
+		codes := make([]string, 0, len(s.Codes))
+		for code := range s.Codes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			w.sample("gegecp_http_requests_total", float64(s.Codes[code]), "method", s.Method, "route", s.Route, "code", code)
+		}
+	}
+	w.family("gegecp_http_request_duration_seconds", "histogram", "HTTP request latency, excluding WebSocket and SSE streams.")
+	for _, s := range stats {
+		for i, le := range middleware.LatencyBuckets {
+			w.sample("gegecp_http_request_duration_seconds_bucket", float64(s.Buckets[i]),
+				"method", s.Method, "route", s.Route, "le", formatMetricValue(le))
+		}
+		w.sample("gegecp_http_request_duration_seconds_bucket", float64(s.Count), "method", s.Method, "route", s.Route, "le", "+Inf")
+		w.sample("gegecp_http_request_duration_seconds_count", float64(s.Count), "method", s.Method, "route", s.Route)
+		w.sample("gegecp_http_request_duration_seconds_sum", s.Sum, "method", s.Method, "route", s.Route)
+	}
+
+	w.gauge("gegecp_start_time_seconds", "Panel start time since unix epoch.", float64(panelStartTime.Unix()))
+	w.gauge("gegecp_goroutines", "Number of goroutines in the panel process.", float64(runtime.NumGoroutine()))
+	if p, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		if mem, err := p.MemoryInfo(); err == nil {
+			w.gauge("gegecp_resident_memory_bytes", "Resident memory of the panel process.", float64(mem.RSS))
+		}
+		if times, err := p.Times(); err == nil {
+			w.family("gegecp_cpu_seconds", "counter", "CPU time consumed by the panel process.")
+			w.sample("gegecp_cpu_seconds_total", times.User+times.System)
+		}
+		if fds, err := p.NumFDs(); err == nil {
+			w.gauge("gegecp_open_fds", "Open file descriptors of the panel process.", float64(fds))
+		}
+	}
+}
+
+// 处理 Prometheus 抓取请求，输出 OpenMetrics 文本格式
+//
+// 需要在配置文件中启用 system.metrics，并通过 token 或IP白名单访问。
+func HandlePrometheusMetrics(c *gin.Context) {
+	cfg := &config.GlobalConfig.System.Metrics
+	if !cfg.Enabled {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+	if !metricsScrapeAllowed(c, cfg) {
+		c.String(http.StatusForbidden, "forbidden")
+		return
+	}
+
+	w := &metricsWriter{}
+	snapshot, ok := latestSnapshot()
+	w.gauge("gegecp_collector_up", "Whether the system collector has produced a snapshot.", map[bool]float64{true: 1, false: 0}[ok])
+	if ok {
+		w.gauge("gegecp_collector_last_sample_timestamp_seconds", "Time of the latest collector snapshot.",
+			float64(snapshot.Timestamp.UnixMilli())/1000)
+		writeHostMetrics(w, &snapshot)
+	}
+	writePanelMetrics(w)
+	w.buf.WriteString("# EOF\n")
+
+	c.Data(http.StatusOK, "application/openmetrics-text; version=1.0.0; charset=utf-8", w.buf.Bytes())
+}
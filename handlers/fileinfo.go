@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// FileEntry 文件列表中的单个条目
+type FileEntry struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"modTime"`
+	IsDir         bool      `json:"isDir"`
+	Permissions   string    `json:"permissions"`
+	Mode          string    `json:"mode"` // 八进制权限，例如 0755
+	Owner         string    `json:"owner"`
+	Group         string    `json:"group"`
+	UID           uint32    `json:"uid"`
+	GID           uint32    `json:"gid"`
+	IsHidden      bool      `json:"isHidden"`
+	IsSymlink     bool      `json:"isSymlink"`
+	LinkTarget    string    `json:"linkTarget,omitempty"`
+	IsBrokenLink  bool      `json:"isBrokenLink,omitempty"`
+	MimeType      string    `json:"mimeType,omitempty"`
+	targetIsDir   bool
+	targetRegular bool
+}
+
+var (
+	userNameCache  = make(map[uint32]string)
+	groupNameCache = make(map[uint32]string)
+	idCacheMutex   sync.Mutex
+)
+
+// 根据uid查找用户名，结果会被缓存
+func lookupUserName(uid uint32) string {
+	idCacheMutex.Lock()
+	defer idCacheMutex.Unlock()
+
+	if name, ok := userNameCache[uid]; ok {
+		return name
+	}
+
+	name := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	userNameCache[uid] = name
+	return name
+}
+
+// 根据gid查找组名，结果会被缓存
+func lookupGroupName(gid uint32) string {
+	idCacheMutex.Lock()
+	defer idCacheMutex.Unlock()
+
+	if name, ok := groupNameCache[gid]; ok {
+		return name
+	}
+
+	name := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupNameCache[gid] = name
+	return name
+}
+
+// 构建文件条目，不跟随符号链接
+func newFileEntry(dir string, info os.FileInfo) FileEntry {
+	fullPath := filepath.Join(dir, info.Name())
+	entry := FileEntry{
+		Name:          info.Name(),
+		Path:          fullPath,
+		Size:          info.Size(),
+		ModTime:       info.ModTime(),
+		IsDir:         info.IsDir(),
+		Permissions:   info.Mode().String(),
+		Mode:          "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+		IsHidden:      strings.HasPrefix(info.Name(), "."),
+		targetIsDir:   info.IsDir(),
+		targetRegular: info.Mode().IsRegular(),
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.UID = stat.Uid
+		entry.GID = stat.Gid
+		entry.Owner = lookupUserName(stat.Uid)
+		entry.Group = lookupGroupName(stat.Gid)
+	}
+
+	// 符号链接：记录目标并检查是否失效
+	if info.Mode()&os.ModeSymlink != 0 {
+		entry.IsSymlink = true
+		if target, err := os.Readlink(fullPath); err == nil {
+			entry.LinkTarget = target
+		}
+		if targetInfo, err := os.Stat(fullPath); err != nil {
+			entry.IsBrokenLink = true
+		} else {
+			entry.targetIsDir = targetInfo.IsDir()
+			entry.targetRegular = targetInfo.Mode().IsRegular()
+			// 指向目录的链接可以像目录一样打开
+			entry.IsDir = targetInfo.IsDir()
+		}
+	}
+
+	return entry
+}
+
+// 检测文件的MIME类型，只对普通文件（或指向普通文件的链接）检测
+func (e *FileEntry) detectMimeType() {
+	switch {
+	case e.targetIsDir:
+		e.MimeType = "inode/directory"
+	case e.IsBrokenLink:
+		e.MimeType = "inode/symlink"
+	case e.targetRegular:
+		if mtype, err := mimetype.DetectFile(e.Path); err == nil {
+			e.MimeType = mtype.String()
+		}
+	}
+}
+
+// 对文件列表排序，目录始终排在文件前面
+func sortFileEntries(entries []FileEntry, sortBy string, desc bool) {
+	less := func(a, b FileEntry) bool {
+		switch sortBy {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "modTime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		case "type":
+			extA, extB := strings.ToLower(filepath.Ext(a.Name)), strings.ToLower(filepath.Ext(b.Name))
+			if extA != extB {
+				return extA < extB
+			}
+		case "owner":
+			if a.Owner != b.Owner {
+				return a.Owner < b.Owner
+			}
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		if desc {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"gegecp/config"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -191,6 +193,27 @@ func DownloadFile(c *gin.Context) {
 	c.File(fullPath)
 }
 
+const (
+	defaultFilesPageSize = 500
+	maxFilesPageSize     = 5000
+)
+
+// 计算分页的起止下标，页码过大时返回空页，避免乘法溢出
+func pageRange(page, pageSize, total int) (int, int) {
+	if page < 1 || pageSize < 1 || page-1 > total/pageSize {
+		return total, total
+	}
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := total
+	if pageSize < total-start {
+		end = start + pageSize
+	}
+	return start, end
+}
+
 // 处理文件列表请求
 func HandleFilesList(c *gin.Context) {
 	path := c.Query("path")
@@ -204,28 +227,54 @@ func HandleFilesList(c *gin.Context) {
 		return
 	}
 
-	var fileList []gin.H
+	showHidden := c.DefaultQuery("showHidden", "true") != "false"
+
+	fileList := make([]FileEntry, 0, len(files))
 	for _, file := range files {
+		// DirEntry.Info 使用 lstat，不会跟随符号链接
 		info, err := file.Info()
 		if err != nil {
 			continue
 		}
 
-		// 获取文件权限
-		fileMode := info.Mode()
-		// 转换为字符串形式的权限表示 (例如: drwxr-xr-x)
-		modeStr := fileMode.String()
-
-		fileList = append(fileList, gin.H{
-			"name":        file.Name(),
-			"size":        info.Size(),
-			"modTime":     info.ModTime(),
-			"isDir":       file.IsDir(),
-			"permissions": modeStr, // 添加权限信息
-		})
+		entry := newFileEntry(path, info)
+		if entry.IsHidden && !showHidden {
+			continue
+		}
+		fileList = append(fileList, entry)
 	}
 
-	c.JSON(http.StatusOK, fileList)
+	// 服务端排序
+	sortFileEntries(fileList, c.DefaultQuery("sort", "name"), c.Query("order") == "desc")
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultFilesPageSize)))
+	if pageSize < 1 {
+		pageSize = defaultFilesPageSize
+	} else if pageSize > maxFilesPageSize {
+		pageSize = maxFilesPageSize
+	}
+
+	total := len(fileList)
+	start, end := pageRange(page, pageSize, total)
+	items := fileList[start:end]
+
+	// 只对当前页检测MIME类型，避免读取整个目录的文件内容
+	for i := range items {
+		items[i].detectMimeType()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"path":     path,
+		"items":    items,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
 }
 
 // 处理文件上传请求
@@ -301,20 +350,66 @@ func HandleFileRead(c *gin.Context) {
 		return
 	}
 
+	info, err := os.Stat(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能编辑目录"})
+		return
+	}
+	if info.Size() > maxEditableFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("文件过大（%d 字节），在线编辑最多支持 %d 字节", info.Size(), maxEditableFileSize),
+		})
+		return
+	}
+
 	content, err := os.ReadFile(path)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if isBinaryContent(content) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "二进制文件不支持在线编辑"})
+		return
+	}
 
-	c.String(http.StatusOK, string(content))
+	text, err := decodeTextFile(content)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "无法识别文件编码: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"path":       path,
+		"content":    text.Content,
+		"encoding":   text.Encoding,
+		"lineEnding": text.LineEnding,
+		"hash":       text.Hash,
+		"size":       info.Size(),
+		"modTime":    info.ModTime(),
+		"mode":       "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+	})
 }
 
+// 文件保存时串行化，保证并发修改检查和写入之间不被打断
+var fileSaveMutex sync.Mutex
+
 // 处理文件保存请求
 func HandleFileSave(c *gin.Context) {
 	var req struct {
 		Path    string `json:"path"`    // 文件路径
 		Content string `json:"content"` // 文件内容
+		// 客户端加载文件时的哈希或修改时间，用于检测并发修改
+		ExpectedHash    string    `json:"expectedHash"`
+		ExpectedModTime time.Time `json:"expectedModTime"`
+		// 留空时沿用原文件的编码和换行符
+		Encoding   string `json:"encoding"`
+		LineEnding string `json:"lineEnding"`
+		// 文件不存在时是否允许新建
+		Create bool `json:"create"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -327,8 +422,6 @@ func HandleFileSave(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("原始保存路径: %s\n", req.Path)
-
 	// 处理路径
 	savePath := req.Path
 	// 如果路径以双斜杠开头，说明是从收藏夹打开的文件
@@ -343,34 +436,131 @@ func HandleFileSave(c *gin.Context) {
 			for _, fav := range favorites {
 				if filepath.Base(fav.Path) == fileName {
 					savePath = fav.Path
-					fmt.Printf("找到收藏文件的原始路径: %s\n", savePath)
+					slog.DebugContext(c.Request.Context(), "使用收藏文件的原始路径", "path", savePath)
 					break
 				}
 			}
 		}
 	}
 
-	fmt.Printf("最终保存路径: %s\n", savePath)
+	// 符号链接写入其指向的文件，保持链接本身不变
+	if resolved, err := filepath.EvalSymlinks(savePath); err == nil {
+		savePath = resolved
+	}
 
-	// 确保目录存在
-	dir := filepath.Dir(savePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		fmt.Printf("创建目录失败: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建目录失败: " + err.Error()})
+	if len(req.Content) > maxEditableFileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "文件内容过大"})
 		return
 	}
 
+	fileSaveMutex.Lock()
+	defer fileSaveMutex.Unlock()
+
+	encodingName := encodingUTF8
+	lineEnding := ""
+	original, err := os.Stat(savePath)
+	switch {
+	case err == nil:
+		if original.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不能保存到目录"})
+			return
+		}
+		if req.ExpectedHash == "" && req.ExpectedModTime.IsZero() {
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": "缺少文件版本信息（expectedHash 或 expectedModTime）"})
+			return
+		}
+
+		current, err := os.ReadFile(savePath)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取原文件失败: " + err.Error()})
+			return
+		}
+		currentHash := contentHash(current)
+		if (req.ExpectedHash != "" && req.ExpectedHash != currentHash) ||
+			(req.ExpectedHash == "" && !req.ExpectedModTime.Equal(original.ModTime())) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "文件已被其他人修改，请重新加载后再保存",
+				"hash":    currentHash,
+				"modTime": original.ModTime(),
+			})
+			return
+		}
+
+		// 沿用原文件的编码和换行符
+		if text, err := decodeTextFile(current); err == nil {
+			encodingName = text.Encoding
+			if text.LineEnding != lineEndingMixed {
+				lineEnding = text.LineEnding
+			}
+		}
+	case os.IsNotExist(err):
+		if !req.Create {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+			return
+		}
+		// 不再自动创建缺失的目录
+		if _, err := os.Stat(filepath.Dir(savePath)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "所在目录不存在: " + filepath.Dir(savePath)})
+			return
+		}
+		original = nil
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Encoding != "" {
+		encodingName = req.Encoding
+	}
+	if req.LineEnding != "" {
+		lineEnding = req.LineEnding
+	}
+
+	data, err := encodeTextFile(req.Content, encodingName, lineEnding)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无法以 %s 编码保存: %v", encodingName, err)})
+		return
+	}
+
+	// 保存前校验配置文件语法，校验失败时拒绝覆盖
+	validation, err := validateFileContent(savePath, data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "配置校验失败，文件未保存: " + err.Error(),
+			"validation": validation,
+		})
+		return
+	}
+
+	// 覆盖前保存原内容的快照，用于回滚
+	if original != nil {
+		if _, err := snapshotFile(savePath, "保存前自动备份"); err != nil {
+			slog.WarnContext(c.Request.Context(), "保存历史版本失败", "path", savePath, "error", err)
+		}
+	}
+
 	// 写入文件内容
-	if err := os.WriteFile(savePath, []byte(req.Content), 0644); err != nil {
-		fmt.Printf("写入文件失败: %v\n", err)
+	if err := writeFileAtomic(savePath, data, original); err != nil {
+		slog.ErrorContext(c.Request.Context(), "写入文件失败", "path", savePath, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败: " + err.Error()})
 		return
 	}
 
-	fmt.Printf("文件保存成功: %s\n", savePath)
+	info, err := os.Stat(savePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "文件已保存", "path", savePath, "size", len(data))
 	c.JSON(http.StatusOK, gin.H{
-		"message": "文件保存成功",
-		"path":    savePath,
+		"message":    "文件保存成功",
+		"path":       savePath,
+		"hash":       contentHash(data),
+		"modTime":    info.ModTime(),
+		"encoding":   encodingName,
+		"lineEnding": lineEnding,
+		"validation": validation,
 	})
 }
 
@@ -0,0 +1,940 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gegecp/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 防火墙管理：自动检测 firewalld、ufw、nftables 或 iptables，以统一的模型列出和修改规则。
+//
+// 每次修改前先保存当前规则，修改后需在确认时间内调用确认接口，否则自动回滚，
+// 避免误操作导致无法再连接服务器。确认前的多次修改合并为一次待确认变更，
+// 回滚时恢复到第一次修改前的状态。会阻断 SSH 或面板端口的修改直接拒绝。
+// 各后端的实现见 firewallbackends.go。
+//
+// 超时回滚由面板进程内的定时器执行，面板退出后在下次启动时回滚。面板卡死或退出后
+// 没有重启时进程内的定时器无法生效，因此在有 systemd 的系统上还会通过 systemd-run
+// 创建一个稍晚触发的临时定时器，由它调用面板的 firewall-rollback 子命令回滚；
+// 没有 systemd 时只能依赖面板进程。
+
+const (
+	firewallDataDir        = "data/firewall"
+	firewallCommandTimeout = 30 * time.Second
+	defaultConfirmTimeout  = 60
+	minConfirmTimeout      = 10
+	maxConfirmTimeout      = 600
+	// systemd 定时器在面板的确认期限之后再等待的时间，正常情况下由面板自身先回滚
+	firewallRollbackGrace = 30 * time.Second
+	firewallRollbackUnit  = "gegecp-firewall-rollback"
+	// 面板添加的规则在注释前加的标记
+	firewallCommentPrefix = "gegecp:"
+	maxFirewallComment    = 100
+)
+
+// FirewallRule 统一的防火墙规则，目前只管理入站规则
+type FirewallRule struct {
+	ID string `json:"id"`
+	// allow、deny、reject，其他动作（如跳转到自定义链）原样显示
+	Action string `json:"action"`
+	// in 或 out
+	Direction string `json:"direction"`
+	// ipv4、ipv6，为空表示两者
+	Family string `json:"family,omitempty"`
+	// tcp、udp，为空表示任意协议
+	Protocol string `json:"protocol,omitempty"`
+	// 单个端口或 起始-结束 范围，为空表示任意端口
+	Port string `json:"port,omitempty"`
+	// 来源 IP 或网段，为空表示任意来源
+	Source string `json:"source,omitempty"`
+	// firewalld 服务或 ufw 应用名称
+	Service string `json:"service,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// 由面板添加
+	Managed bool `json:"managed"`
+	// 后端中的原始规则
+	Raw string `json:"raw"`
+
+	// 后端用于定位规则的信息
+	ref string
+	// 规则包含未能识别的匹配条件，不用于判断是否放行
+	unparsed bool
+}
+
+// FirewallStatus 防火墙当前状态
+type FirewallStatus struct {
+	Backend string `json:"backend"`
+	// 未匹配任何规则时的默认处理：accept、drop、reject
+	DefaultPolicy string         `json:"defaultPolicy"`
+	Rules         []FirewallRule `json:"rules"`
+}
+
+// FirewallBackend 防火墙后端
+type FirewallBackend struct {
+	Name string
+	// 后端是否已安装并处于启用状态
+	Detect   func(ctx context.Context) bool
+	Status   func(ctx context.Context) (*FirewallStatus, error)
+	Add      func(ctx context.Context, r *FirewallRule) error
+	Delete   func(ctx context.Context, r *FirewallRule) error
+	Snapshot func(ctx context.Context) ([]byte, error)
+	Restore  func(ctx context.Context, snapshot []byte) error
+	// 确认后将当前规则持久化，重启后仍然生效
+	Persist func(ctx context.Context) error
+}
+
+// 待确认的变更
+type firewallChange struct {
+	ID       string    `json:"id"`
+	Backend  string    `json:"backend"`
+	Changes  []string  `json:"changes"`
+	Created  time.Time `json:"created"`
+	Deadline time.Time `json:"deadline"`
+	Snapshot []byte    `json:"snapshot"`
+
+	timer *time.Timer
+}
+
+var (
+	// 按检测顺序排列
+	firewallBackends []FirewallBackend
+
+	firewallMutex   sync.Mutex
+	pendingFirewall *firewallChange
+
+	errFirewallUnavailable = errors.New("未检测到可用的防火墙，请安装并启用 firewalld、ufw、nftables 或 iptables")
+	// 后端不支持持久化或未找到保存规则的文件
+	errFirewallNotPersisted = errors.New("规则已生效，但未能持久化，重启后将失效")
+)
+
+// RegisterFirewallBackend 注册防火墙后端，先注册的优先检测
+func RegisterFirewallBackend(b FirewallBackend) {
+	firewallBackends = append(firewallBackends, b)
+}
+
+func init() {
+	registerBuiltinFirewallBackends()
+}
+
+// StartFirewall 回滚面板退出前尚未确认的变更，需在初始化日志之后调用
+func StartFirewall() {
+	restorePendingFirewall()
+}
+
+// RollbackPendingFirewall 回滚指定的待确认变更，供 systemd 定时器调用的 firewall-rollback 子命令使用。
+// 变更已被确认或回滚时不做任何操作
+func RollbackPendingFirewall(id string) error {
+	data, err := os.ReadFile(pendingFirewallPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var change firewallChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		return err
+	}
+	if change.ID != id {
+		return nil
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+	pendingFirewall = &change
+	return rollbackFirewall("面板未在确认期限内回滚，由 systemd 定时器回滚")
+}
+
+func findFirewallBackend(name string) *FirewallBackend {
+	for i := range firewallBackends {
+		if firewallBackends[i].Name == name {
+			return &firewallBackends[i]
+		}
+	}
+	return nil
+}
+
+// 返回配置指定或自动检测到的后端
+func activeFirewallBackend(ctx context.Context) (*FirewallBackend, error) {
+	if name := config.GlobalConfig.System.Firewall.Backend; name != "" {
+		if b := findFirewallBackend(name); b != nil {
+			return b, nil
+		}
+		return nil, fmt.Errorf("不支持的防火墙后端: %s", name)
+	}
+	for i := range firewallBackends {
+		if firewallBackends[i].Detect(ctx) {
+			return &firewallBackends[i], nil
+		}
+	}
+	return nil, errFirewallUnavailable
+}
+
+func runFirewallCommand(ctx context.Context, stdin string, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, firewallCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return string(out), fmt.Errorf("%s 执行失败: %s", name, msg)
+	}
+	return string(out), nil
+}
+
+func firewallRuleID(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// 拆分出面板标记，返回注释内容和是否由面板添加
+func parseFirewallComment(comment string) (string, bool) {
+	if rest, ok := strings.CutPrefix(comment, firewallCommentPrefix); ok {
+		return strings.TrimSpace(rest), true
+	}
+	return comment, false
+}
+
+// 解析端口或端口范围，分隔符可以是 - 或 :
+func parsePortRange(port string) (int, int, error) {
+	lo, hi, isRange := strings.Cut(strings.Replace(port, ":", "-", 1), "-")
+	start, err := strconv.Atoi(lo)
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, fmt.Errorf("无效的端口: %s", port)
+	}
+	end := start
+	if isRange {
+		end, err = strconv.Atoi(hi)
+		if err != nil || end < start || end > 65535 {
+			return 0, 0, fmt.Errorf("无效的端口范围: %s", port)
+		}
+	}
+	return start, end, nil
+}
+
+// 规则的端口是否包含 port，多个端口以逗号分隔，为空表示任意端口
+func (r *FirewallRule) coversPort(port int) bool {
+	if r.Port == "" {
+		return r.Service == ""
+	}
+	for _, p := range strings.Split(r.Port, ",") {
+		if lo, hi, err := parsePortRange(strings.TrimSpace(p)); err == nil && port >= lo && port <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// 规则的来源是否包含 ip，为空表示任意来源
+func (r *FirewallRule) coversSource(ip net.IP) bool {
+	if r.Source == "" || ip == nil {
+		return true
+	}
+	if _, network, err := net.ParseCIDR(r.Source); err == nil {
+		return network.Contains(ip)
+	}
+	return net.ParseIP(r.Source).Equal(ip)
+}
+
+// 规则的协议族是否包含 ip，为空表示两者
+func (r *FirewallRule) coversFamily(ip net.IP) bool {
+	return r.Family == "" || ip == nil || r.Family == familyOf(ip)
+}
+
+func familyOf(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// 删除 rule 时 other 是否会被一并删除：ufw 按参数删除，来源为任意时会同时删除 IPv4 和 IPv6 两条规则
+func deletedWith(backend string, rule, other *FirewallRule) bool {
+	if other.ID == rule.ID {
+		return true
+	}
+	return backend == "ufw" && other.ref == rule.ref && other.Direction == rule.Direction &&
+		other.Protocol == rule.Protocol && other.Port == rule.Port && other.Source == rule.Source &&
+		other.Service == rule.Service
+}
+
+func (r *FirewallRule) normalize() error {
+	r.Direction = "in"
+	switch r.Action {
+	case "":
+		r.Action = "allow"
+	case "allow", "deny", "reject":
+	default:
+		return errors.New("动作只能是 allow、deny 或 reject")
+	}
+
+	r.Protocol = strings.ToLower(r.Protocol)
+	switch r.Protocol {
+	case "", "tcp", "udp":
+	default:
+		return errors.New("协议只能是 tcp 或 udp")
+	}
+
+	r.Port = strings.TrimSpace(r.Port)
+	if r.Port != "" {
+		if r.Protocol == "" {
+			return errors.New("指定端口时必须选择 tcp 或 udp")
+		}
+		lo, hi, err := parsePortRange(r.Port)
+		if err != nil {
+			return err
+		}
+		r.Port = strconv.Itoa(lo)
+		if hi != lo {
+			r.Port += "-" + strconv.Itoa(hi)
+		}
+	}
+
+	r.Source = strings.TrimSpace(r.Source)
+	r.Family = ""
+	if r.Source != "" {
+		var ip net.IP
+		if strings.Contains(r.Source, "/") {
+			addr, network, err := net.ParseCIDR(r.Source)
+			if err != nil {
+				return fmt.Errorf("无效的来源地址: %s", r.Source)
+			}
+			ip = addr
+			r.Source = network.String()
+		} else {
+			if ip = net.ParseIP(r.Source); ip == nil {
+				return fmt.Errorf("无效的来源地址: %s", r.Source)
+			}
+			r.Source = ip.String()
+		}
+		r.Family = "ipv6"
+		if ip.To4() != nil {
+			r.Family = "ipv4"
+		}
+	}
+	if r.Port == "" && r.Source == "" {
+		return errors.New("请至少指定端口或来源地址")
+	}
+
+	r.Comment = strings.TrimSpace(r.Comment)
+	if len(r.Comment) > maxFirewallComment {
+		return fmt.Errorf("备注不能超过 %d 字节", maxFirewallComment)
+	}
+	if strings.ContainsAny(r.Comment, "\"'\\\r\n") {
+		return errors.New("备注不能包含引号、反斜杠或换行")
+	}
+	r.Service = ""
+	r.Managed = true
+	return nil
+}
+
+// 读取 sshd 配置中的监听端口，包括 Include 的文件
+func sshPorts() []int {
+	var ports []int
+	seen := map[string]bool{}
+	var parse func(path string)
+	parse = func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		f, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			switch strings.ToLower(fields[0]) {
+			case "port":
+				if port, err := strconv.Atoi(fields[1]); err == nil {
+					ports = append(ports, port)
+				}
+			case "include":
+				for _, pattern := range fields[1:] {
+					if !filepath.IsAbs(pattern) {
+						pattern = filepath.Join("/etc/ssh", pattern)
+					}
+					matches, _ := filepath.Glob(pattern)
+					for _, m := range matches {
+						parse(m)
+					}
+				}
+			}
+		}
+	}
+	parse("/etc/ssh/sshd_config")
+	if len(ports) == 0 {
+		ports = []int{22}
+	}
+	return ports
+}
+
+func panelPort() int {
+	if port := config.GlobalConfig.Server.Port; port > 0 {
+		return port
+	}
+	return 8080
+}
+
+// 对 ip 实际生效的默认处理。链的默认策略为放行但有不带任何匹配条件的丢弃或拒绝规则时
+// （如 RHEL 默认的 -A INPUT -j REJECT），未被其他规则放行的连接同样会被拦截
+func (s *FirewallStatus) effectivePolicy(ip net.IP) string {
+	if s.DefaultPolicy != "accept" {
+		return s.DefaultPolicy
+	}
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.unparsed || r.Direction == "out" || !r.coversFamily(ip) ||
+			r.Protocol != "" || r.Port != "" || r.Source != "" || r.Service != "" {
+			continue
+		}
+		switch r.Action {
+		case "deny":
+			return "drop"
+		case "reject":
+			return "reject"
+		}
+	}
+	return s.DefaultPolicy
+}
+
+// 变更涉及的规则是否包含 ip 的协议族，删除时包括会被一并删除的规则
+func (s *FirewallStatus) removesFamily(op string, rule *FirewallRule, ip net.IP) bool {
+	if rule.coversFamily(ip) {
+		return true
+	}
+	if op == "delete" {
+		for i := range s.Rules {
+			if deletedWith(s.Backend, rule, &s.Rules[i]) && s.Rules[i].coversFamily(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 需要保护的端口，值为端口说明
+func protectedFirewallPorts() map[int]string {
+	ports := map[int]string{panelPort(): "面板端口"}
+	for _, p := range sshPorts() {
+		ports[p] = "SSH 端口"
+	}
+	return ports
+}
+
+// 检查变更是否会导致当前客户端无法再访问 SSH 或面板
+func checkFirewallLockout(status *FirewallStatus, op string, rule *FirewallRule, clientIP net.IP) error {
+	if rule.Direction == "out" || !rule.coversSource(clientIP) || !status.removesFamily(op, rule, clientIP) {
+		return nil
+	}
+	protected := protectedFirewallPorts()
+
+	switch {
+	case op == "add" && (rule.Action == "deny" || rule.Action == "reject"):
+		if rule.Port == "" {
+			return fmt.Errorf("该规则会阻断当前客户端（%s）的所有访问", clientIP)
+		}
+		if rule.Protocol == "udp" {
+			return nil
+		}
+		for port, name := range protected {
+			if rule.coversPort(port) {
+				return fmt.Errorf("该规则会阻断%s %d，当前客户端（%s）将无法连接", name, port, clientIP)
+			}
+		}
+
+	case op == "delete" && rule.Action == "allow":
+		// 默认放行时删除放行规则不影响访问
+		if status.effectivePolicy(clientIP) == "accept" || rule.Protocol == "udp" {
+			return nil
+		}
+		for port, name := range protected {
+			if !rule.coversPort(port) {
+				continue
+			}
+			covered := false
+			for i := range status.Rules {
+				other := &status.Rules[i]
+				if !deletedWith(status.Backend, rule, other) && !other.unparsed && other.Action == "allow" && other.Direction != "out" &&
+					other.Protocol != "udp" && other.coversPort(port) && other.coversSource(clientIP) && other.coversFamily(clientIP) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return fmt.Errorf("删除后没有其他规则放行%s %d，当前客户端（%s）将无法连接", name, port, clientIP)
+			}
+		}
+	}
+	return nil
+}
+
+func firewallConfirmTimeout(requested int) (time.Duration, error) {
+	seconds := requested
+	if seconds == 0 {
+		seconds = config.GlobalConfig.System.Firewall.ConfirmTimeout
+	}
+	if seconds == 0 {
+		seconds = defaultConfirmTimeout
+	}
+	if seconds < minConfirmTimeout || seconds > maxConfirmTimeout {
+		return 0, fmt.Errorf("确认时间必须在 %d 到 %d 秒之间", minConfirmTimeout, maxConfirmTimeout)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func pendingFirewallPath() string {
+	return filepath.Join(firewallDataDir, "pending.json")
+}
+
+// 保存待确认的变更，面板重启后据此回滚；调用方需持有 firewallMutex
+func savePendingFirewall() error {
+	if pendingFirewall == nil {
+		err := os.Remove(pendingFirewallPath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(firewallDataDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(pendingFirewall)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pendingFirewallPath(), data, 0600)
+}
+
+func restorePendingFirewall() {
+	data, err := os.ReadFile(pendingFirewallPath())
+	if err != nil {
+		return
+	}
+	var change firewallChange
+	if err := json.Unmarshal(data, &change); err != nil {
+		slog.Error("读取待确认的防火墙变更失败", "error", err)
+		return
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+	pendingFirewall = &change
+	if err := rollbackFirewall("面板重启时变更尚未确认"); err != nil {
+		slog.Error("回滚防火墙变更失败", "change", change.ID, "error", err)
+		change.timer = time.AfterFunc(10*time.Second, func() { firewallDeadlineExpired(change.ID) })
+	}
+}
+
+// 回滚待确认的变更，调用方需持有 firewallMutex
+func rollbackFirewall(reason string) error {
+	change := pendingFirewall
+	if change == nil {
+		return nil
+	}
+	backend := findFirewallBackend(change.Backend)
+	if backend == nil {
+		return fmt.Errorf("不支持的防火墙后端: %s", change.Backend)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), firewallCommandTimeout)
+	defer cancel()
+	if err := backend.Restore(ctx, change.Snapshot); err != nil {
+		return err
+	}
+	if change.timer != nil {
+		change.timer.Stop()
+	}
+	cancelFirewallRollbackTimer()
+	pendingFirewall = nil
+	if err := savePendingFirewall(); err != nil {
+		slog.Warn("清除待确认的防火墙变更失败", "error", err)
+	}
+	slog.Warn("防火墙变更已回滚", "change", change.ID, "reason", reason, "changes", change.Changes)
+	return nil
+}
+
+func firewallDeadlineExpired(id string) {
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+	if pendingFirewall == nil || pendingFirewall.ID != id {
+		return
+	}
+	if err := rollbackFirewall("超时未确认"); err != nil {
+		slog.Error("回滚防火墙变更失败", "change", id, "error", err)
+		// 稍后重试，避免规则停留在未确认的状态
+		pendingFirewall.timer = time.AfterFunc(10*time.Second, func() { firewallDeadlineExpired(id) })
+	}
+}
+
+// 修改规则：首次修改时保存快照，之后的修改合并到同一次待确认变更并重新计时
+func applyFirewallChange(ctx context.Context, backend *FirewallBackend, timeout time.Duration, description string, apply func() error) (*firewallChange, error) {
+	if pendingFirewall != nil && pendingFirewall.Backend != backend.Name {
+		return nil, errors.New("存在其他后端的待确认变更，请先确认或回滚")
+	}
+
+	created := false
+	if pendingFirewall == nil {
+		snapshot, err := backend.Snapshot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("保存当前规则失败: %v", err)
+		}
+		now := time.Now()
+		pendingFirewall = &firewallChange{
+			ID:       strconv.FormatInt(now.UnixNano(), 10),
+			Backend:  backend.Name,
+			Created:  now,
+			Snapshot: snapshot,
+		}
+		created = true
+	}
+	// 先记录快照再修改，保证修改过程中面板退出也能回滚
+	change := pendingFirewall
+	change.Deadline = time.Now().Add(timeout)
+	if err := savePendingFirewall(); err != nil {
+		if created {
+			pendingFirewall = nil
+		}
+		return nil, err
+	}
+
+	id := change.ID
+	if err := apply(); err != nil {
+		if created {
+			// 修改失败时恢复原状，后端可能只应用了部分规则
+			if rerr := rollbackFirewall("修改失败"); rerr != nil {
+				slog.Error("回滚防火墙变更失败", "change", id, "error", rerr)
+				change.timer = time.AfterFunc(timeout, func() { firewallDeadlineExpired(id) })
+			}
+		}
+		return nil, err
+	}
+
+	change.Changes = append(change.Changes, description)
+	if change.timer != nil {
+		change.timer.Stop()
+	}
+	change.timer = time.AfterFunc(timeout, func() { firewallDeadlineExpired(id) })
+	if err := savePendingFirewall(); err != nil {
+		slog.Warn("保存待确认的防火墙变更失败", "error", err)
+	}
+	scheduleFirewallRollbackTimer(ctx, id, timeout+firewallRollbackGrace)
+	return change, nil
+}
+
+// 通过 systemd-run 创建在 delay 后回滚变更的临时定时器，已有的定时器会被替换
+func scheduleFirewallRollbackTimer(ctx context.Context, id string, delay time.Duration) {
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		slog.Warn("创建防火墙回滚定时器失败", "error", err)
+		return
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		slog.Warn("创建防火墙回滚定时器失败", "error", err)
+		return
+	}
+	cancelFirewallRollbackTimer()
+	_, err = runFirewallCommand(ctx, "", "systemd-run",
+		"--unit="+firewallRollbackUnit,
+		"--collect",
+		"--on-active="+strconv.Itoa(int(delay.Seconds()))+"s",
+		"--timer-property=AccuracySec=1s",
+		"--property=WorkingDirectory="+dir,
+		exe, "firewall-rollback", id)
+	if err != nil {
+		slog.Warn("创建防火墙回滚定时器失败，只能依赖面板进程回滚", "change", id, "error", err)
+	}
+}
+
+// 停止尚未触发的回滚定时器，已开始执行的回滚不受影响
+func cancelFirewallRollbackTimer() {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), firewallCommandTimeout)
+	defer cancel()
+	runFirewallCommand(ctx, "", "systemctl", "stop", firewallRollbackUnit+".timer")
+}
+
+func describeFirewallRule(op string, r *FirewallRule) string {
+	var b strings.Builder
+	b.WriteString(op + " " + r.Action)
+	if r.Protocol != "" {
+		b.WriteString(" " + r.Protocol)
+	}
+	if r.Port != "" {
+		b.WriteString(" port " + r.Port)
+	}
+	if r.Service != "" {
+		b.WriteString(" service " + r.Service)
+	}
+	if r.Source != "" {
+		b.WriteString(" from " + r.Source)
+	}
+	if r.Comment != "" {
+		b.WriteString(" (" + r.Comment + ")")
+	}
+	return b.String()
+}
+
+// 待确认变更的返回内容，调用方需持有 firewallMutex
+func pendingFirewallView() gin.H {
+	if pendingFirewall == nil {
+		return nil
+	}
+	return gin.H{
+		"id":        pendingFirewall.ID,
+		"backend":   pendingFirewall.Backend,
+		"changes":   pendingFirewall.Changes,
+		"created":   pendingFirewall.Created,
+		"deadline":  pendingFirewall.Deadline,
+		"remaining": int(time.Until(pendingFirewall.Deadline).Seconds()),
+	}
+}
+
+func firewallBackendFromRequest(c *gin.Context) (*FirewallBackend, bool) {
+	backend, err := activeFirewallBackend(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return backend, true
+}
+
+// 处理防火墙状态请求，返回后端、规则、受保护端口和待确认的变更
+func HandleFirewallStatus(c *gin.Context) {
+	backend, ok := firewallBackendFromRequest(c)
+	if !ok {
+		return
+	}
+	status, err := backend.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	firewallMutex.Lock()
+	pending := pendingFirewallView()
+	firewallMutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"backend":       status.Backend,
+		"defaultPolicy": status.DefaultPolicy,
+		"rules":         status.Rules,
+		"protected":     protectedFirewallPorts(),
+		"clientIp":      c.ClientIP(),
+		"pending":       pending,
+	})
+}
+
+// 处理添加规则请求，规则在确认前会在超时后自动回滚
+func HandleFirewallRuleAdd(c *gin.Context) {
+	var req struct {
+		Rule FirewallRule `json:"rule"`
+		// 确认时间（秒），为空使用配置的默认值
+		Timeout int `json:"timeout"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	rule := &req.Rule
+	if err := rule.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	timeout, err := firewallConfirmTimeout(req.Timeout)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	backend, ok := firewallBackendFromRequest(c)
+	if !ok {
+		return
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+
+	ctx := c.Request.Context()
+	status, err := backend.Status(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkFirewallLockout(status, "add", rule, net.ParseIP(c.ClientIP())); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	description := describeFirewallRule("add", rule)
+	if _, err := applyFirewallChange(ctx, backend, timeout, description, func() error {
+		return backend.Add(ctx, rule)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.InfoContext(ctx, "防火墙规则已添加，等待确认", "backend", backend.Name, "rule", description)
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("规则已生效，请在 %d 秒内确认，否则将自动回滚", int(timeout.Seconds())),
+		"pending": pendingFirewallView(),
+	})
+}
+
+// 处理删除规则请求，参数 id 为规则列表中的 ID
+func HandleFirewallRuleDelete(c *gin.Context) {
+	timeout, err := firewallConfirmTimeout(0)
+	if v := c.Query("timeout"); v != "" {
+		n, perr := strconv.Atoi(v)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的确认时间"})
+			return
+		}
+		timeout, err = firewallConfirmTimeout(n)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	backend, ok := firewallBackendFromRequest(c)
+	if !ok {
+		return
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+
+	ctx := c.Request.Context()
+	status, err := backend.Status(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var rule *FirewallRule
+	for i := range status.Rules {
+		if status.Rules[i].ID == c.Query("id") {
+			rule = &status.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+		return
+	}
+	if err := checkFirewallLockout(status, "delete", rule, net.ParseIP(c.ClientIP())); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	description := describeFirewallRule("delete", rule)
+	if _, err := applyFirewallChange(ctx, backend, timeout, description, func() error {
+		return backend.Delete(ctx, rule)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	slog.InfoContext(ctx, "防火墙规则已删除，等待确认", "backend", backend.Name, "rule", description)
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("规则已删除，请在 %d 秒内确认，否则将自动回滚", int(timeout.Seconds())),
+		"pending": pendingFirewallView(),
+	})
+}
+
+// 处理确认变更请求，确认后持久化规则
+func HandleFirewallConfirm(c *gin.Context) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+
+	change := pendingFirewall
+	if change == nil || change.ID != req.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有待确认的变更，可能已超时回滚"})
+		return
+	}
+	if change.timer != nil {
+		change.timer.Stop()
+	}
+	cancelFirewallRollbackTimer()
+	pendingFirewall = nil
+	if err := savePendingFirewall(); err != nil {
+		slog.WarnContext(c.Request.Context(), "清除待确认的防火墙变更失败", "error", err)
+	}
+	slog.InfoContext(c.Request.Context(), "防火墙变更已确认", "change", change.ID, "changes", change.Changes)
+
+	backend := findFirewallBackend(change.Backend)
+	if backend.Persist != nil {
+		if err := backend.Persist(c.Request.Context()); err != nil {
+			message := err.Error()
+			if err != errFirewallNotPersisted {
+				message = "规则已生效，但持久化失败: " + message
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "变更已确认", "warning": message})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "变更已确认"})
+}
+
+// 处理立即回滚请求
+func HandleFirewallRollback(c *gin.Context) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	firewallMutex.Lock()
+	defer firewallMutex.Unlock()
+
+	if pendingFirewall == nil || pendingFirewall.ID != req.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有待确认的变更"})
+		return
+	}
+	if err := rollbackFirewall("手动回滚"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "回滚失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "变更已回滚"})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"gegecp/config"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckFirewallLockout(t *testing.T) {
+	savedPort := config.GlobalConfig.Server.Port
+	config.GlobalConfig.Server.Port = 18443
+	defer func() { config.GlobalConfig.Server.Port = savedPort }()
+
+	// 始终放行 SSH 端口，用例只关注面板端口
+	var sshList []string
+	for _, p := range sshPorts() {
+		if p != 18443 {
+			sshList = append(sshList, strconv.Itoa(p))
+		}
+	}
+	ssh := FirewallRule{ID: "ssh", Action: "allow", Direction: "in", Protocol: "tcp", Port: strings.Join(sshList, ",")}
+	if len(sshList) == 0 {
+		ssh.Port = "1"
+	}
+
+	panelV4 := FirewallRule{ID: "panel4", Action: "allow", Direction: "in", Family: "ipv4", Protocol: "tcp", Port: "18443", ref: "allow"}
+	panelV6 := FirewallRule{ID: "panel6", Action: "allow", Direction: "in", Family: "ipv6", Protocol: "tcp", Port: "18443", ref: "allow"}
+	panelAny := FirewallRule{ID: "panel", Action: "allow", Direction: "in", Protocol: "tcp", Port: "18443"}
+	rejectAll := FirewallRule{ID: "reject4", Action: "reject", Direction: "in", Family: "ipv4"}
+	rejectAllV6 := FirewallRule{ID: "reject6", Action: "reject", Direction: "in", Family: "ipv6"}
+	rejectSSH := FirewallRule{ID: "reject-ssh", Action: "reject", Direction: "in", Protocol: "tcp", Port: "2222"}
+
+	v4 := net.ParseIP("192.0.2.10")
+	v6 := net.ParseIP("2001:db8::10")
+
+	tests := []struct {
+		name     string
+		backend  string
+		policy   string
+		rules    []FirewallRule
+		op       string
+		rule     FirewallRule
+		clientIP net.IP
+		lockout  bool
+	}{
+		{"默认放行时删除放行规则", "iptables", "accept", []FirewallRule{ssh, panelV4}, "delete", panelV4, v4, false},
+		{"默认丢弃时删除唯一的放行规则", "iptables", "drop", []FirewallRule{ssh, panelV4}, "delete", panelV4, v4, true},
+		{"默认丢弃时还有其他放行规则", "iptables", "drop", []FirewallRule{ssh, panelV4, panelAny}, "delete", panelV4, v4, false},
+		{"默认放行但末尾有拒绝全部的规则", "iptables", "accept", []FirewallRule{ssh, panelV4, rejectAll}, "delete", panelV4, v4, true},
+		{"拒绝全部的规则只针对另一协议族", "iptables", "accept", []FirewallRule{ssh, panelV4, rejectAllV6}, "delete", panelV4, v4, false},
+		{"带条件的拒绝规则不视为默认策略", "iptables", "accept", []FirewallRule{ssh, panelV4, rejectSSH}, "delete", panelV4, v4, false},
+		{"只剩另一协议族的放行规则", "nftables", "drop", []FirewallRule{ssh, panelV4, panelV6}, "delete", panelV4, v4, true},
+		{"删除另一协议族的放行规则", "nftables", "drop", []FirewallRule{ssh, panelV4, panelV6}, "delete", panelV6, v4, false},
+		{"ufw 同时删除 IPv4 和 IPv6 规则", "ufw", "drop", []FirewallRule{ssh, panelV4, panelV6}, "delete", panelV4, v6, true},
+		{"ufw 来源不同的规则不会一并删除", "ufw", "drop", []FirewallRule{ssh, panelV4, withSource(panelV6, "2001:db8::/32")}, "delete", panelV4, v6, false},
+		{"添加拒绝全部的规则", "iptables", "accept", []FirewallRule{ssh, panelV4}, "add", rejectAll, v4, true},
+		{"添加只针对另一协议族的拒绝规则", "iptables", "accept", []FirewallRule{ssh, panelV4}, "add", rejectAllV6, v4, false},
+		{"添加拒绝面板端口的规则", "iptables", "accept", []FirewallRule{ssh}, "add", FirewallRule{Action: "deny", Direction: "in", Protocol: "tcp", Port: "18000-19000"}, v4, true},
+		{"添加拒绝其他来源的规则", "iptables", "accept", []FirewallRule{ssh}, "add", withSource(rejectAll, "198.51.100.0/24"), v4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &FirewallStatus{Backend: tt.backend, DefaultPolicy: tt.policy, Rules: tt.rules}
+			err := checkFirewallLockout(status, tt.op, &tt.rule, tt.clientIP)
+			if (err != nil) != tt.lockout {
+				t.Fatalf("checkFirewallLockout() = %v, want lockout %v", err, tt.lockout)
+			}
+		})
+	}
+}
+
+func withSource(r FirewallRule, source string) FirewallRule {
+	r.ID += "-" + source
+	r.Source = source
+	return r
+}
+
+func TestParseIptablesRejectWith(t *testing.T) {
+	r := parseIptablesRule("ipv4", "-A INPUT -j REJECT --reject-with icmp-host-prohibited")
+	if r.unparsed || r.Action != "reject" {
+		t.Fatalf("parseIptablesRule() = %+v", r)
+	}
+	status := &FirewallStatus{DefaultPolicy: "accept", Rules: []FirewallRule{r}}
+	if got := status.effectivePolicy(net.ParseIP("192.0.2.10")); got != "reject" {
+		t.Fatalf("effectivePolicy() = %q, want reject", got)
+	}
+}
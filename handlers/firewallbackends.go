@@ -0,0 +1,1137 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+func registerBuiltinFirewallBackends() {
+	// firewalld 和 ufw 底层使用 nftables 或 iptables，需要先检测
+	RegisterFirewallBackend(FirewallBackend{
+		Name:     "firewalld",
+		Detect:   firewalldDetect,
+		Status:   firewalldStatus,
+		Add:      firewalldAdd,
+		Delete:   firewalldDelete,
+		Snapshot: func(ctx context.Context) ([]byte, error) { return nil, nil },
+		// 修改只作用于运行时配置，重新加载即恢复为永久配置
+		Restore: func(ctx context.Context, snapshot []byte) error {
+			_, err := runFirewallCommand(ctx, "", "firewall-cmd", "--reload")
+			return err
+		},
+		Persist: func(ctx context.Context) error {
+			_, err := runFirewallCommand(ctx, "", "firewall-cmd", "--runtime-to-permanent")
+			return err
+		},
+	})
+	RegisterFirewallBackend(FirewallBackend{
+		Name:     "ufw",
+		Detect:   ufwDetect,
+		Status:   ufwStatus,
+		Add:      ufwAdd,
+		Delete:   ufwDelete,
+		Snapshot: ufwSnapshot,
+		Restore:  ufwRestore,
+		// ufw 的修改直接写入规则文件
+		Persist: nil,
+	})
+	RegisterFirewallBackend(FirewallBackend{
+		Name:     "nftables",
+		Detect:   nftDetect,
+		Status:   nftStatus,
+		Add:      nftAdd,
+		Delete:   nftDelete,
+		Snapshot: nftSnapshot,
+		Restore:  nftRestore,
+		Persist:  nftPersist,
+	})
+	RegisterFirewallBackend(FirewallBackend{
+		Name:     "iptables",
+		Detect:   iptablesDetect,
+		Status:   iptablesStatus,
+		Add:      iptablesAdd,
+		Delete:   iptablesDelete,
+		Snapshot: iptablesSnapshot,
+		Restore:  iptablesRestore,
+		Persist:  iptablesPersist,
+	})
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// 去掉单个地址的 /32 或 /128 前缀长度
+func trimHostPrefix(addr string) string {
+	if ip, network, err := net.ParseCIDR(addr); err == nil {
+		if ones, bits := network.Mask.Size(); ones == bits {
+			return ip.String()
+		}
+		return network.String()
+	}
+	return addr
+}
+
+// 写入持久化规则文件，写入前保存历史版本
+func writeFirewallFile(ctx context.Context, path string, data []byte) error {
+	original, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if original != nil {
+		if _, err := snapshotFile(path, "面板保存防火墙规则前自动备份"); err != nil {
+			slog.WarnContext(ctx, "保存历史版本失败", "path", path, "error", err)
+		}
+	}
+	return writeFileAtomic(path, data, original)
+}
+
+// firewalld
+
+var (
+	richFamilyPattern = regexp.MustCompile(`family="(ipv4|ipv6)"`)
+	richSourcePattern = regexp.MustCompile(`source address="([^"]+)"`)
+	richPortPattern   = regexp.MustCompile(`port port="([^"]+)" protocol="(tcp|udp)"`)
+	richProtoPattern  = regexp.MustCompile(`protocol value="(tcp|udp)"`)
+	richSvcPattern    = regexp.MustCompile(`service name="([^"]+)"`)
+	richActionPattern = regexp.MustCompile(`\b(accept|drop|reject)\b`)
+	richQuotePattern  = regexp.MustCompile(`"[^"]*"`)
+
+	// firewalld 规则不支持注释，面板添加的规则备注保存在本地
+	firewalldCommentMutex sync.Mutex
+)
+
+func firewalldCommentsPath() string {
+	return filepath.Join(firewallDataDir, "firewalld-comments.json")
+}
+
+func loadFirewalldComments() map[string]string {
+	comments := map[string]string{}
+	if data, err := os.ReadFile(firewalldCommentsPath()); err == nil {
+		json.Unmarshal(data, &comments)
+	}
+	return comments
+}
+
+func updateFirewalldComment(raw, comment string, remove bool) {
+	firewalldCommentMutex.Lock()
+	defer firewalldCommentMutex.Unlock()
+
+	comments := loadFirewalldComments()
+	if remove {
+		delete(comments, raw)
+	} else {
+		comments[raw] = comment
+	}
+	if err := os.MkdirAll(firewallDataDir, 0700); err != nil {
+		slog.Warn("保存防火墙规则备注失败", "error", err)
+		return
+	}
+	data, _ := json.Marshal(comments)
+	if err := os.WriteFile(firewalldCommentsPath(), data, 0600); err != nil {
+		slog.Warn("保存防火墙规则备注失败", "error", err)
+	}
+}
+
+func firewalldDetect(ctx context.Context) bool {
+	if !commandExists("firewall-cmd") {
+		return false
+	}
+	out, err := runFirewallCommand(ctx, "", "firewall-cmd", "--state")
+	return err == nil && strings.TrimSpace(out) == "running"
+}
+
+// 规则作用于默认区域
+func firewalldZone(ctx context.Context) (string, error) {
+	out, err := runFirewallCommand(ctx, "", "firewall-cmd", "--get-default-zone")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func firewalldStatus(ctx context.Context) (*FirewallStatus, error) {
+	zone, err := firewalldZone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zoneArg := "--zone=" + zone
+	status := &FirewallStatus{Backend: "firewalld", DefaultPolicy: "reject", Rules: []FirewallRule{}}
+	if out, err := runFirewallCommand(ctx, "", "firewall-cmd", "--permanent", zoneArg, "--get-target"); err == nil {
+		switch strings.TrimSpace(out) {
+		case "ACCEPT":
+			status.DefaultPolicy = "accept"
+		case "DROP":
+			status.DefaultPolicy = "drop"
+		}
+	}
+	comments := loadFirewalldComments()
+	add := func(r FirewallRule) {
+		r.Direction = "in"
+		r.ID = firewallRuleID("firewalld", zone, r.Raw)
+		if comment, ok := comments[r.Raw]; ok {
+			r.Comment = comment
+			r.Managed = true
+		}
+		status.Rules = append(status.Rules, r)
+	}
+
+	out, err := runFirewallCommand(ctx, "", "firewall-cmd", zoneArg, "--list-ports")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range strings.Fields(out) {
+		port, proto, _ := strings.Cut(p, "/")
+		add(FirewallRule{Action: "allow", Protocol: proto, Port: port, Raw: "port " + p})
+	}
+
+	out, err = runFirewallCommand(ctx, "", "firewall-cmd", zoneArg, "--list-services")
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range strings.Fields(out) {
+		r := FirewallRule{Action: "allow", Service: svc, Raw: "service " + svc}
+		r.Protocol, r.Port = firewalldServicePorts(ctx, svc)
+		add(r)
+	}
+
+	out, err = runFirewallCommand(ctx, "", "firewall-cmd", zoneArg, "--list-rich-rules")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			add(parseRichRule(ctx, line))
+		}
+	}
+	return status, nil
+}
+
+// 服务包含的端口，协议不一致时不返回协议
+func firewalldServicePorts(ctx context.Context, svc string) (string, string) {
+	out, err := runFirewallCommand(ctx, "", "firewall-cmd", "--permanent", "--service="+svc, "--get-ports")
+	if err != nil {
+		return "", ""
+	}
+	var ports []string
+	protocol := ""
+	for i, p := range strings.Fields(out) {
+		port, proto, _ := strings.Cut(p, "/")
+		if i == 0 {
+			protocol = proto
+		} else if proto != protocol {
+			protocol = ""
+		}
+		ports = append(ports, port)
+	}
+	return protocol, strings.Join(ports, ",")
+}
+
+func parseRichRule(ctx context.Context, line string) FirewallRule {
+	r := FirewallRule{Raw: line}
+	if m := richFamilyPattern.FindStringSubmatch(line); m != nil {
+		r.Family = m[1]
+	}
+	if m := richSourcePattern.FindStringSubmatch(line); m != nil {
+		r.Source = trimHostPrefix(m[1])
+	}
+	if m := richPortPattern.FindStringSubmatch(line); m != nil {
+		r.Port, r.Protocol = m[1], m[2]
+	} else if m := richProtoPattern.FindStringSubmatch(line); m != nil {
+		r.Protocol = m[1]
+	} else if m := richSvcPattern.FindStringSubmatch(line); m != nil {
+		r.Service = m[1]
+		r.Protocol, r.Port = firewalldServicePorts(ctx, m[1])
+	}
+	// 去掉引号中的内容后再查找动作，避免匹配到地址或服务名
+	if m := richActionPattern.FindStringSubmatch(richQuotePattern.ReplaceAllString(line, `""`)); m != nil {
+		switch m[1] {
+		case "accept":
+			r.Action = "allow"
+		case "drop":
+			r.Action = "deny"
+		default:
+			r.Action = "reject"
+		}
+	}
+	for _, keyword := range []string{" NOT ", "destination", "forward-port", "icmp-block", "icmp-type", "source-port", "source mac", "source ipset"} {
+		if strings.Contains(line, keyword) {
+			r.unparsed = true
+		}
+	}
+	return r
+}
+
+func firewalldAdd(ctx context.Context, r *FirewallRule) error {
+	zone, err := firewalldZone(ctx)
+	if err != nil {
+		return err
+	}
+	if r.Action == "allow" && r.Source == "" {
+		port := r.Port + "/" + r.Protocol
+		if _, err := runFirewallCommand(ctx, "", "firewall-cmd", "--zone="+zone, "--add-port="+port); err != nil {
+			return err
+		}
+		updateFirewalldComment("port "+port, r.Comment, false)
+		return nil
+	}
+
+	parts := []string{"rule"}
+	if r.Family != "" {
+		parts = append(parts, `family="`+r.Family+`"`)
+	}
+	if r.Source != "" {
+		parts = append(parts, `source address="`+r.Source+`"`)
+	}
+	if r.Port != "" {
+		parts = append(parts, `port port="`+r.Port+`" protocol="`+r.Protocol+`"`)
+	} else if r.Protocol != "" {
+		parts = append(parts, `protocol value="`+r.Protocol+`"`)
+	}
+	parts = append(parts, map[string]string{"allow": "accept", "deny": "drop", "reject": "reject"}[r.Action])
+	rich := strings.Join(parts, " ")
+	if _, err := runFirewallCommand(ctx, "", "firewall-cmd", "--zone="+zone, "--add-rich-rule="+rich); err != nil {
+		return err
+	}
+	updateFirewalldComment(rich, r.Comment, false)
+	return nil
+}
+
+func firewalldDelete(ctx context.Context, r *FirewallRule) error {
+	zone, err := firewalldZone(ctx)
+	if err != nil {
+		return err
+	}
+	arg := "--remove-rich-rule=" + r.Raw
+	if port, ok := strings.CutPrefix(r.Raw, "port "); ok {
+		arg = "--remove-port=" + port
+	} else if svc, ok := strings.CutPrefix(r.Raw, "service "); ok {
+		arg = "--remove-service=" + svc
+	}
+	if _, err := runFirewallCommand(ctx, "", "firewall-cmd", "--zone="+zone, arg); err != nil {
+		return err
+	}
+	if r.Managed {
+		updateFirewalldComment(r.Raw, "", true)
+	}
+	return nil
+}
+
+// ufw
+
+var ufwRuleFiles = map[string]string{
+	"ipv4": "/etc/ufw/user.rules",
+	"ipv6": "/etc/ufw/user6.rules",
+}
+
+func ufwDetect(ctx context.Context) bool {
+	if !commandExists("ufw") {
+		return false
+	}
+	out, err := runFirewallCommand(ctx, "", "ufw", "status")
+	return err == nil && strings.Contains(out, "Status: active")
+}
+
+func ufwStatus(ctx context.Context) (*FirewallStatus, error) {
+	status := &FirewallStatus{Backend: "ufw", DefaultPolicy: "drop", Rules: []FirewallRule{}}
+	if data, err := os.ReadFile("/etc/default/ufw"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "DEFAULT_INPUT_POLICY="); ok {
+				switch strings.Trim(v, `"`) {
+				case "ACCEPT":
+					status.DefaultPolicy = "accept"
+				case "REJECT":
+					status.DefaultPolicy = "reject"
+				}
+			}
+		}
+	}
+
+	for _, family := range []string{"ipv4", "ipv6"} {
+		data, err := os.ReadFile(ufwRuleFiles[family])
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if r := parseUfwTuple(family, line); r != nil {
+				status.Rules = append(status.Rules, *r)
+			}
+		}
+	}
+	return status, nil
+}
+
+// 解析规则文件中的 ### tuple ### 行：
+// 动作 协议 目标端口 目标地址 来源端口 来源地址 [目标应用 来源应用] 方向 [comment=十六进制]
+func parseUfwTuple(family, line string) *FirewallRule {
+	rest, ok := strings.CutPrefix(line, "### tuple ###")
+	if !ok {
+		return nil
+	}
+	fields := strings.Fields(rest)
+	comment := ""
+	if n := len(fields); n > 0 && strings.HasPrefix(fields[n-1], "comment=") {
+		if decoded, err := hex.DecodeString(strings.TrimPrefix(fields[n-1], "comment=")); err == nil {
+			comment = string(decoded)
+		}
+		fields = fields[:n-1]
+	}
+	// 转发规则以 route: 开头，不属于入站规则
+	if len(fields) < 7 || strings.HasPrefix(fields[0], "route:") {
+		return nil
+	}
+
+	r := &FirewallRule{
+		ID:        firewallRuleID("ufw", family, line),
+		Action:    strings.SplitN(fields[0], "_", 2)[0],
+		Direction: fields[6],
+		Family:    family,
+		Raw:       strings.TrimSpace(rest),
+		ref:       fields[0],
+	}
+	if len(fields) >= 9 {
+		r.Direction = fields[8]
+		if fields[6] != "-" {
+			r.Service = strings.ReplaceAll(fields[6], "%20", " ")
+		}
+		if fields[7] != "-" {
+			r.unparsed = true
+		}
+	}
+	if fields[1] != "any" {
+		r.Protocol = fields[1]
+	}
+	if fields[2] != "any" {
+		r.Port = strings.ReplaceAll(fields[2], ":", "-")
+	}
+	if src := fields[5]; src != "0.0.0.0/0" && src != "::/0" {
+		r.Source = trimHostPrefix(src)
+	}
+	if fields[3] != "0.0.0.0/0" && fields[3] != "::/0" || fields[4] != "any" {
+		r.unparsed = true
+	}
+	r.Comment, r.Managed = parseFirewallComment(comment)
+	return r
+}
+
+// 生成 ufw 规则参数，from 之后的部分添加和删除时相同
+func ufwRuleArgs(r *FirewallRule) []string {
+	var args []string
+	if r.Protocol != "" && r.Service == "" {
+		args = append(args, "proto", r.Protocol)
+	}
+	source := "any"
+	if r.Source != "" {
+		source = r.Source
+	}
+	args = append(args, "from", source, "to", "any")
+	if r.Service != "" {
+		args = append(args, "app", r.Service)
+	} else if r.Port != "" {
+		args = append(args, "port", strings.Replace(r.Port, "-", ":", 1))
+	}
+	return args
+}
+
+func ufwAdd(ctx context.Context, r *FirewallRule) error {
+	// 拒绝规则插入到最前面，否则会被已有的放行规则先匹配
+	args := []string{r.Action}
+	if r.Action != "allow" {
+		args = []string{"prepend", r.Action}
+	}
+	args = append(args, ufwRuleArgs(r)...)
+	args = append(args, "comment", firewallCommentPrefix+r.Comment)
+	_, err := runFirewallCommand(ctx, "", "ufw", args...)
+	return err
+}
+
+func ufwDelete(ctx context.Context, r *FirewallRule) error {
+	args := []string{"delete", r.Action}
+	if strings.HasSuffix(r.ref, "_log") || strings.HasSuffix(r.ref, "_log-all") {
+		args = append(args, strings.SplitN(r.ref, "_", 2)[1])
+	}
+	if r.Direction == "out" {
+		args = append(args, "out")
+	}
+	args = append(args, ufwRuleArgs(r)...)
+	_, err := runFirewallCommand(ctx, "", "ufw", args...)
+	return err
+}
+
+func ufwSnapshot(ctx context.Context) ([]byte, error) {
+	files := map[string]string{}
+	for _, path := range ufwRuleFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		files[path] = string(data)
+	}
+	return json.Marshal(files)
+}
+
+func ufwRestore(ctx context.Context, snapshot []byte) error {
+	var files map[string]string
+	if err := json.Unmarshal(snapshot, &files); err != nil {
+		return err
+	}
+	for path, content := range files {
+		original, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := writeFileAtomic(path, []byte(content), original); err != nil {
+			return err
+		}
+	}
+	_, err := runFirewallCommand(ctx, "", "ufw", "reload")
+	return err
+}
+
+// nftables
+
+type nftChain struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Hook   string `json:"hook"`
+	Policy string `json:"policy"`
+}
+
+type nftRule struct {
+	Family  string                       `json:"family"`
+	Table   string                       `json:"table"`
+	Chain   string                       `json:"chain"`
+	Handle  int                          `json:"handle"`
+	Comment string                       `json:"comment"`
+	Expr    []map[string]json.RawMessage `json:"expr"`
+}
+
+type nftRuleset struct {
+	Chains []nftChain
+	Rules  []nftRule
+	// 所有表，键为 "族 表名"
+	Tables map[string]bool
+}
+
+const nftPanelTable = "gegecp"
+
+// iptables-nft 创建的表和链名称为大写，由 iptables 管理
+func isIptablesNftChain(name string) bool {
+	return name != "" && strings.ToUpper(name) == name
+}
+
+func loadNftRuleset(ctx context.Context) (*nftRuleset, error) {
+	out, err := runFirewallCommand(ctx, "", "nft", "-j", "list", "ruleset")
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Nftables []map[string]json.RawMessage `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		return nil, fmt.Errorf("解析 nftables 规则失败: %v", err)
+	}
+
+	ruleset := &nftRuleset{Tables: map[string]bool{}}
+	inputChains := map[string]bool{}
+	var rules []nftRule
+	for _, item := range doc.Nftables {
+		if raw, ok := item["table"]; ok {
+			var table struct{ Family, Name string }
+			if json.Unmarshal(raw, &table) == nil {
+				ruleset.Tables[table.Family+" "+table.Name] = true
+			}
+		}
+		if raw, ok := item["chain"]; ok {
+			var chain nftChain
+			if json.Unmarshal(raw, &chain) == nil && chain.Type == "filter" && chain.Hook == "input" && !isIptablesNftChain(chain.Name) {
+				ruleset.Chains = append(ruleset.Chains, chain)
+				inputChains[chain.Family+" "+chain.Table+" "+chain.Name] = true
+			}
+		}
+		if raw, ok := item["rule"]; ok {
+			var rule nftRule
+			if json.Unmarshal(raw, &rule) == nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	for _, rule := range rules {
+		if inputChains[rule.Family+" "+rule.Table+" "+rule.Chain] {
+			ruleset.Rules = append(ruleset.Rules, rule)
+		}
+	}
+	return ruleset, nil
+}
+
+// 包含入站链的表，快照和回滚以表为单位
+func (rs *nftRuleset) inputTables() []string {
+	seen := map[string]bool{}
+	var tables []string
+	for _, c := range rs.Chains {
+		key := c.Family + " " + c.Table
+		if !seen[key] {
+			seen[key] = true
+			tables = append(tables, key)
+		}
+	}
+	if key := "inet " + nftPanelTable; rs.Tables[key] && !seen[key] {
+		tables = append(tables, key)
+	}
+	return tables
+}
+
+func nftDetect(ctx context.Context) bool {
+	if !commandExists("nft") {
+		return false
+	}
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return false
+	}
+	// 只有 iptables-nft 的规则时交给 iptables 后端管理
+	return len(ruleset.Chains) > 0 || !commandExists("iptables")
+}
+
+// 将匹配的值转换为文本：数字、字符串、范围、网段或集合
+func nftValue(raw json.RawMessage) string {
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Range  []json.RawMessage `json:"range"`
+		Prefix *struct {
+			Addr string `json:"addr"`
+			Len  int    `json:"len"`
+		} `json:"prefix"`
+		Set []json.RawMessage `json:"set"`
+	}
+	if json.Unmarshal(raw, &obj) != nil {
+		return ""
+	}
+	switch {
+	case len(obj.Range) == 2:
+		return nftValue(obj.Range[0]) + "-" + nftValue(obj.Range[1])
+	case obj.Prefix != nil:
+		return obj.Prefix.Addr + "/" + strconv.Itoa(obj.Prefix.Len)
+	case obj.Set != nil:
+		values := make([]string, 0, len(obj.Set))
+		for _, v := range obj.Set {
+			values = append(values, nftValue(v))
+		}
+		return strings.Join(values, ",")
+	}
+	return ""
+}
+
+func parseNftRule(rule nftRule) FirewallRule {
+	r := FirewallRule{
+		ID:        firewallRuleID("nftables", rule.Family, rule.Table, rule.Chain, strconv.Itoa(rule.Handle)),
+		Direction: "in",
+		ref:       fmt.Sprintf("%s %s %s handle %d", rule.Family, rule.Table, rule.Chain, rule.Handle),
+	}
+	if rule.Family == "ip" {
+		r.Family = "ipv4"
+	} else if rule.Family == "ip6" {
+		r.Family = "ipv6"
+	}
+	r.Comment, r.Managed = parseFirewallComment(rule.Comment)
+
+	for _, expr := range rule.Expr {
+		for key, raw := range expr {
+			switch key {
+			case "match":
+				var match struct {
+					Op    string                     `json:"op"`
+					Left  map[string]json.RawMessage `json:"left"`
+					Right json.RawMessage            `json:"right"`
+				}
+				if json.Unmarshal(raw, &match) != nil || (match.Op != "==" && match.Op != "in") {
+					r.unparsed = true
+					continue
+				}
+				var field struct{ Protocol, Field, Key string }
+				if v, ok := match.Left["payload"]; ok {
+					json.Unmarshal(v, &field)
+				} else if v, ok := match.Left["meta"]; ok {
+					json.Unmarshal(v, &field)
+				}
+				switch {
+				case (field.Protocol == "tcp" || field.Protocol == "udp") && field.Field == "dport":
+					r.Protocol = field.Protocol
+					r.Port = nftValue(match.Right)
+				case (field.Protocol == "ip" || field.Protocol == "ip6") && field.Field == "saddr":
+					r.Source = trimHostPrefix(nftValue(match.Right))
+					r.Family = map[string]string{"ip": "ipv4", "ip6": "ipv6"}[field.Protocol]
+				case field.Key == "l4proto" || (field.Protocol == "ip" && field.Field == "protocol"):
+					if proto := nftValue(match.Right); proto == "tcp" || proto == "udp" {
+						r.Protocol = proto
+					} else {
+						r.unparsed = true
+					}
+				default:
+					r.unparsed = true
+				}
+			case "accept":
+				r.Action = "allow"
+			case "drop":
+				r.Action = "deny"
+			case "reject":
+				r.Action = "reject"
+			case "jump", "goto":
+				var target struct{ Target string }
+				json.Unmarshal(raw, &target)
+				r.Action = key + " " + target.Target
+			case "counter", "log", "comment":
+			default:
+				r.unparsed = true
+			}
+		}
+	}
+	return r
+}
+
+// 读取链的文本形式，返回句柄到规则文本的映射
+func nftChainText(ctx context.Context, c nftChain) map[int]string {
+	texts := map[int]string{}
+	out, err := runFirewallCommand(ctx, "", "nft", "-a", "list", "chain", c.Family, c.Table, c.Name)
+	if err != nil {
+		return texts
+	}
+	for _, line := range strings.Split(out, "\n") {
+		text, handle, ok := strings.Cut(line, "# handle ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(handle))
+		text = strings.TrimSpace(text)
+		if err != nil || strings.HasPrefix(text, "chain ") || strings.HasPrefix(text, "table ") {
+			continue
+		}
+		texts[n] = text
+	}
+	return texts
+}
+
+func nftStatus(ctx context.Context) (*FirewallStatus, error) {
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &FirewallStatus{Backend: "nftables", DefaultPolicy: "accept", Rules: []FirewallRule{}}
+	for _, c := range ruleset.Chains {
+		// 多个入站链时，任一链丢弃即视为丢弃
+		if c.Policy == "drop" {
+			status.DefaultPolicy = "drop"
+		}
+		texts := nftChainText(ctx, c)
+		for _, rule := range ruleset.Rules {
+			if rule.Family == c.Family && rule.Table == c.Table && rule.Chain == c.Name {
+				r := parseNftRule(rule)
+				r.Raw = texts[rule.Handle]
+				status.Rules = append(status.Rules, r)
+			}
+		}
+	}
+	return status, nil
+}
+
+func nftAdd(ctx context.Context, r *FirewallRule) error {
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+	var script strings.Builder
+	var chain *nftChain
+	for i := range ruleset.Chains {
+		c := &ruleset.Chains[i]
+		if c.Family == "inet" || (c.Family == "ip" && r.Family != "ipv6") || (c.Family == "ip6" && r.Family == "ipv6") {
+			chain = c
+			break
+		}
+	}
+	if chain == nil {
+		// 没有可用的入站链时创建面板自己的表，默认放行
+		chain = &nftChain{Family: "inet", Table: nftPanelTable, Name: "input"}
+		fmt.Fprintf(&script, "add table inet %s\n", nftPanelTable)
+		fmt.Fprintf(&script, "add chain inet %s input { type filter hook input priority 0; policy accept; }\n", nftPanelTable)
+	}
+
+	var match []string
+	if r.Source != "" {
+		if r.Family == "ipv6" {
+			match = append(match, "ip6 saddr "+r.Source)
+		} else {
+			match = append(match, "ip saddr "+r.Source)
+		}
+	}
+	if r.Port != "" {
+		match = append(match, r.Protocol+" dport "+r.Port)
+	} else if r.Protocol != "" {
+		match = append(match, "meta l4proto "+r.Protocol)
+	}
+	verdict := map[string]string{"allow": "accept", "deny": "drop", "reject": "reject"}[r.Action]
+	fmt.Fprintf(&script, "insert rule %s %s %s %s counter %s comment \"%s%s\"\n",
+		chain.Family, chain.Table, chain.Name, strings.Join(match, " "), verdict, firewallCommentPrefix, r.Comment)
+	_, err = runFirewallCommand(ctx, script.String(), "nft", "-f", "-")
+	return err
+}
+
+func nftDelete(ctx context.Context, r *FirewallRule) error {
+	args := append([]string{"delete", "rule"}, strings.Fields(r.ref)...)
+	_, err := runFirewallCommand(ctx, "", "nft", args...)
+	return err
+}
+
+func nftSnapshot(ctx context.Context) ([]byte, error) {
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]string{}
+	for _, key := range ruleset.inputTables() {
+		family, name, _ := strings.Cut(key, " ")
+		out, err := runFirewallCommand(ctx, "", "nft", "list", "table", family, name)
+		if err != nil {
+			return nil, err
+		}
+		tables[key] = out
+	}
+	return json.Marshal(tables)
+}
+
+// 删除当前的入站表后重新载入快照中的表，在同一事务中执行
+func nftRestore(ctx context.Context, snapshot []byte) error {
+	var tables map[string]string
+	if err := json.Unmarshal(snapshot, &tables); err != nil {
+		return err
+	}
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+
+	var script strings.Builder
+	deleted := map[string]bool{}
+	for _, key := range ruleset.inputTables() {
+		deleted[key] = true
+		fmt.Fprintf(&script, "delete table %s\n", key)
+	}
+	for key := range tables {
+		if ruleset.Tables[key] && !deleted[key] {
+			fmt.Fprintf(&script, "delete table %s\n", key)
+		}
+	}
+	for _, text := range tables {
+		script.WriteString(text + "\n")
+	}
+	_, err = runFirewallCommand(ctx, script.String(), "nft", "-f", "-")
+	return err
+}
+
+// 将 iptables-nft 之外的所有表写入 /etc/nftables.conf
+func nftPersist(ctx context.Context) error {
+	const path = "/etc/nftables.conf"
+	if _, err := os.Stat(path); err != nil {
+		return errFirewallNotPersisted
+	}
+	ruleset, err := loadNftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(ruleset.Tables))
+	for key := range ruleset.Tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("#!/usr/sbin/nft -f\n\nflush ruleset\n\n")
+	for _, key := range keys {
+		family, name, _ := strings.Cut(key, " ")
+		out, err := runFirewallCommand(ctx, "", "nft", "list", "table", family, name)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(out, "iptables-nft") {
+			continue
+		}
+		b.WriteString(out + "\n")
+	}
+	return writeFirewallFile(ctx, path, []byte(b.String()))
+}
+
+// iptables
+
+type iptablesFamily struct {
+	family  string
+	cmd     string
+	save    string
+	restore string
+	// 持久化文件，使用第一个已存在的文件
+	persist []string
+}
+
+var iptablesFamilies = []iptablesFamily{
+	{"ipv4", "iptables", "iptables-save", "iptables-restore", []string{"/etc/iptables/rules.v4", "/etc/sysconfig/iptables"}},
+	{"ipv6", "ip6tables", "ip6tables-save", "ip6tables-restore", []string{"/etc/iptables/rules.v6", "/etc/sysconfig/ip6tables"}},
+}
+
+func availableIptables() []iptablesFamily {
+	var families []iptablesFamily
+	for _, f := range iptablesFamilies {
+		if commandExists(f.cmd) {
+			families = append(families, f)
+		}
+	}
+	return families
+}
+
+func iptablesDetect(ctx context.Context) bool {
+	if !commandExists("iptables") {
+		return false
+	}
+	_, err := runFirewallCommand(ctx, "", "iptables", "-S", "INPUT")
+	return err == nil
+}
+
+// 按空白拆分 iptables -S 的输出，支持双引号包含的参数
+func splitQuotedFields(line string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuote, hasField := false, false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && inQuote && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case ch == '"':
+			inQuote = !inQuote
+			hasField = true
+		case (ch == ' ' || ch == '\t') && !inQuote:
+			if hasField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				hasField = false
+			}
+		default:
+			cur.WriteByte(ch)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+func parseIptablesRule(family, line string) FirewallRule {
+	args := splitQuotedFields(line)
+	r := FirewallRule{
+		ID:        firewallRuleID("iptables", family, line),
+		Direction: "in",
+		Family:    family,
+		Raw:       line,
+	}
+	value := func(i int) string {
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+		return ""
+	}
+	for i := 2; i < len(args); i++ {
+		if args[i] == "!" {
+			// 取反的条件无法用统一模型表示，跳过该选项及其值
+			r.unparsed = true
+			i += 2
+			continue
+		}
+		switch args[i] {
+		case "-s":
+			r.Source = trimHostPrefix(value(i))
+		case "-p":
+			if proto := value(i); proto == "tcp" || proto == "udp" {
+				r.Protocol = proto
+			} else {
+				r.unparsed = true
+			}
+		case "-m":
+			if m := value(i); m != "tcp" && m != "udp" && m != "comment" && m != "multiport" {
+				r.unparsed = true
+			}
+		case "--dport", "--dports":
+			r.Port = strings.ReplaceAll(value(i), ":", "-")
+		case "--comment":
+			r.Comment, r.Managed = parseFirewallComment(value(i))
+		case "--reject-with":
+			// 拒绝时返回的报文类型，不影响匹配
+		case "-j":
+			switch target := value(i); target {
+			case "ACCEPT":
+				r.Action = "allow"
+			case "DROP":
+				r.Action = "deny"
+			case "REJECT":
+				r.Action = "reject"
+			default:
+				r.Action = "jump " + target
+			}
+		default:
+			// 其他匹配条件，没有值的选项不跳过下一个参数
+			r.unparsed = true
+			if strings.HasPrefix(value(i), "-") {
+				continue
+			}
+		}
+		i++
+	}
+	return r
+}
+
+func iptablesStatus(ctx context.Context) (*FirewallStatus, error) {
+	status := &FirewallStatus{Backend: "iptables", DefaultPolicy: "accept", Rules: []FirewallRule{}}
+	for _, f := range availableIptables() {
+		out, err := runFirewallCommand(ctx, "", f.cmd, "-S", "INPUT")
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(strings.NewReader(out))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if policy, ok := strings.CutPrefix(line, "-P INPUT "); ok {
+				if policy == "DROP" {
+					status.DefaultPolicy = "drop"
+				}
+			} else if strings.HasPrefix(line, "-A INPUT ") {
+				status.Rules = append(status.Rules, parseIptablesRule(f.family, line))
+			}
+		}
+	}
+	return status, nil
+}
+
+func iptablesAdd(ctx context.Context, r *FirewallRule) error {
+	var families []iptablesFamily
+	for _, f := range availableIptables() {
+		if r.Family == "" || r.Family == f.family {
+			families = append(families, f)
+		}
+	}
+	if len(families) == 0 {
+		return fmt.Errorf("未找到 %s 规则对应的 iptables 命令", r.Family)
+	}
+
+	args := []string{"-I", "INPUT", "1"}
+	if r.Source != "" {
+		args = append(args, "-s", r.Source)
+	}
+	if r.Protocol != "" {
+		args = append(args, "-p", r.Protocol)
+	}
+	if r.Port != "" {
+		args = append(args, "-m", r.Protocol, "--dport", strings.Replace(r.Port, "-", ":", 1))
+	}
+	args = append(args, "-m", "comment", "--comment", firewallCommentPrefix+r.Comment)
+	args = append(args, "-j", map[string]string{"allow": "ACCEPT", "deny": "DROP", "reject": "REJECT"}[r.Action])
+	for _, f := range families {
+		if _, err := runFirewallCommand(ctx, "", f.cmd, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func iptablesDelete(ctx context.Context, r *FirewallRule) error {
+	for _, f := range availableIptables() {
+		if f.family == r.Family {
+			args := append([]string{"-D", "INPUT"}, splitQuotedFields(r.Raw)[2:]...)
+			_, err := runFirewallCommand(ctx, "", f.cmd, args...)
+			return err
+		}
+	}
+	return fmt.Errorf("未找到 %s 规则对应的 iptables 命令", r.Family)
+}
+
+func iptablesSnapshot(ctx context.Context) ([]byte, error) {
+	rules := map[string]string{}
+	for _, f := range availableIptables() {
+		out, err := runFirewallCommand(ctx, "", f.save, "-t", "filter")
+		if err != nil {
+			return nil, err
+		}
+		rules[f.family] = out
+	}
+	return json.Marshal(rules)
+}
+
+// iptables-restore 只清空输入中包含的表，其他表不受影响
+func iptablesRestore(ctx context.Context, snapshot []byte) error {
+	var rules map[string]string
+	if err := json.Unmarshal(snapshot, &rules); err != nil {
+		return err
+	}
+	for _, f := range availableIptables() {
+		if data, ok := rules[f.family]; ok {
+			if _, err := runFirewallCommand(ctx, data, f.restore); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func iptablesPersist(ctx context.Context) error {
+	persisted := true
+	for _, f := range availableIptables() {
+		path := ""
+		for _, p := range f.persist {
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			persisted = false
+			continue
+		}
+		out, err := runFirewallCommand(ctx, "", f.save)
+		if err != nil {
+			return err
+		}
+		if err := writeFirewallFile(ctx, path, []byte(out)); err != nil {
+			return err
+		}
+	}
+	if !persisted {
+		return errFirewallNotPersisted
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	fileHistoryDir = "data/file_history"
+	// 每个文件最多保留的版本数
+	maxFileRevisions = 50
+	// 版本最长保留时间
+	maxFileRevisionAge = 90 * 24 * time.Hour
+	// 超过该大小的文件不做快照
+	maxSnapshotFileSize = maxEditableFileSize
+)
+
+// FileRevision 文件的一个历史版本
+type FileRevision struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Size    int64     `json:"size"`
+	Hash    string    `json:"hash"`
+	Mode    string    `json:"mode"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// 单个文件的版本索引
+type fileHistoryIndex struct {
+	Path      string         `json:"path"`
+	Revisions []FileRevision `json:"revisions"`
+}
+
+var fileHistoryMutex sync.Mutex
+
+// 解析符号链接，保证通过链接访问和直接访问使用同一份历史记录
+func resolveHistoryPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// 每个文件的历史记录存放在以路径哈希命名的目录中
+func fileHistoryPath(path string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(path)))
+	return filepath.Join(fileHistoryDir, hex.EncodeToString(sum[:16]))
+}
+
+func loadFileHistory(path string) (*fileHistoryIndex, error) {
+	index := &fileHistoryIndex{Path: filepath.Clean(path), Revisions: []FileRevision{}}
+
+	data, err := os.ReadFile(filepath.Join(fileHistoryPath(path), "index.json"))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func saveFileHistory(index *fileHistoryIndex) error {
+	dir := fileHistoryPath(index.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.json"), data, 0600)
+}
+
+// 为文件当前内容创建快照，内容与最新版本相同时不重复保存
+func snapshotFile(path, comment string) (*FileRevision, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSnapshotFileSize {
+		return nil, fmt.Errorf("文件过大，不保存历史版本")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileHistoryMutex.Lock()
+	defer fileHistoryMutex.Unlock()
+
+	index, err := loadFileHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := contentHash(data)
+	if n := len(index.Revisions); n > 0 && index.Revisions[n-1].Hash == hash {
+		return &index.Revisions[n-1], nil
+	}
+
+	now := time.Now()
+	rev := FileRevision{
+		ID:      strconv.FormatInt(now.UnixNano(), 10),
+		Time:    now,
+		Size:    int64(len(data)),
+		Hash:    hash,
+		Mode:    "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+		Comment: comment,
+	}
+
+	dir := fileHistoryPath(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// 历史版本可能包含敏感配置，只允许面板进程读取
+	if err := os.WriteFile(filepath.Join(dir, rev.ID+".rev"), data, 0600); err != nil {
+		return nil, err
+	}
+
+	index.Revisions = append(index.Revisions, rev)
+	pruneFileHistory(index)
+
+	if err := saveFileHistory(index); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// 按数量和时间清理过期版本
+func pruneFileHistory(index *fileHistoryIndex) {
+	cutoff := time.Now().Add(-maxFileRevisionAge)
+	dir := fileHistoryPath(index.Path)
+
+	kept := index.Revisions[:0]
+	for i, rev := range index.Revisions {
+		tooMany := len(index.Revisions)-i > maxFileRevisions
+		if tooMany || rev.Time.Before(cutoff) {
+			os.Remove(filepath.Join(dir, rev.ID+".rev"))
+			continue
+		}
+		kept = append(kept, rev)
+	}
+	index.Revisions = kept
+}
+
+// 读取指定版本的原始内容
+func readFileRevision(path, id string) (*FileRevision, []byte, error) {
+	fileHistoryMutex.Lock()
+	index, err := loadFileHistory(path)
+	fileHistoryMutex.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range index.Revisions {
+		if index.Revisions[i].ID == id {
+			data, err := os.ReadFile(filepath.Join(fileHistoryPath(path), id+".rev"))
+			if err != nil {
+				return nil, nil, err
+			}
+			return &index.Revisions[i], data, nil
+		}
+	}
+	return nil, nil, os.ErrNotExist
+}
+
+// 读取版本内容，id 为 current 时读取文件当前内容
+func readRevisionText(path, id string) (string, error) {
+	var data []byte
+	var err error
+	if id == "" || id == "current" {
+		data, err = os.ReadFile(path)
+	} else {
+		_, data, err = readFileRevision(path, id)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if isBinaryContent(data) {
+		return "", fmt.Errorf("二进制内容无法比较")
+	}
+	text, err := decodeTextFile(data)
+	if err != nil {
+		return "", err
+	}
+	return text.Content, nil
+}
+
+// 处理文件历史版本列表请求
+func HandleFileHistoryList(c *gin.Context) {
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "路径不能为空"})
+		return
+	}
+	path = resolveHistoryPath(path)
+
+	fileHistoryMutex.Lock()
+	index, err := loadFileHistory(path)
+	fileHistoryMutex.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加载历史版本失败: " + err.Error()})
+		return
+	}
+
+	// 最新的版本排在前面
+	revisions := append([]FileRevision(nil), index.Revisions...)
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Time.After(revisions[j].Time)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"path":      index.Path,
+		"revisions": revisions,
+	})
+}
+
+// 处理读取历史版本内容请求
+func HandleFileHistoryContent(c *gin.Context) {
+	path := c.Query("path")
+	id := c.Query("rev")
+	if path == "" || id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "路径和版本不能为空"})
+		return
+	}
+	path = resolveHistoryPath(path)
+
+	rev, data, err := readFileRevision(path, id)
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if isBinaryContent(data) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "二进制内容无法显示"})
+		return
+	}
+	text, err := decodeTextFile(data)
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revision": rev,
+		"content":  text.Content,
+		"encoding": text.Encoding,
+	})
+}
+
+// 处理版本差异比较请求，to 为空时与当前文件比较
+func HandleFileHistoryDiff(c *gin.Context) {
+	path := c.Query("path")
+	from := c.Query("from")
+	to := c.DefaultQuery("to", "current")
+	if path == "" || from == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "路径和起始版本不能为空"})
+		return
+	}
+	path = resolveHistoryPath(path)
+
+	fromText, err := readRevisionText(path, from)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取版本 " + from + " 失败: " + err.Error()})
+		return
+	}
+	toText, err := readRevisionText(path, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取版本 " + to + " 失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"path": path,
+		"from": from,
+		"to":   to,
+		"diff": unifiedDiff(path+"@"+from, path+"@"+to, fromText, toText),
+	})
+}
+
+// 处理恢复历史版本请求，恢复前会先保存当前内容
+func HandleFileHistoryRestore(c *gin.Context) {
+	var req struct {
+		Path string `json:"path"`
+		Rev  string `json:"rev"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" || req.Rev == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "路径和版本不能为空"})
+		return
+	}
+	req.Path = resolveHistoryPath(req.Path)
+
+	rev, data, err := readFileRevision(req.Path, req.Rev)
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "版本不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileSaveMutex.Lock()
+	defer fileSaveMutex.Unlock()
+
+	original, err := os.Stat(req.Path)
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if original != nil {
+		if _, err := snapshotFile(req.Path, "恢复版本 "+rev.ID+" 前的内容"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存当前版本失败: " + err.Error()})
+			return
+		}
+	}
+
+	if err := writeFileAtomic(req.Path, data, original); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复文件失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "文件已恢复",
+		"path":     req.Path,
+		"revision": rev,
+		"hash":     contentHash(data),
+	})
+}
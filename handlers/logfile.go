@@ -0,0 +1,878 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gegecp/logging"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	logSourceDataDir = "data/logs"
+	defaultLogLines  = 200
+	maxLogLines      = 5000
+	// 超过该长度的行会被截断
+	maxLogLineLength = 64 * 1024
+	// 倒序读取文件时每次读取的块大小
+	logReadChunkSize = 64 * 1024
+	// 查询的最长执行时间，压缩的轮转文件需要完整解压
+	logQueryTimeout = 15 * time.Second
+	// 跟踪模式检查文件变化的间隔
+	logFollowInterval = time.Second
+	// 同时跟踪日志文件的客户端上限
+	maxLogFollowers = 20
+	// 时间戳只在行首附近查找
+	logTimestampSearchLength = 128
+)
+
+// LogSource 命名的日志来源
+type LogSource struct {
+	Name        string `json:"name"`
+	App         string `json:"app"`
+	Description string `json:"description,omitempty"`
+	// 候选路径，使用第一个存在的文件
+	Paths   []string `json:"paths"`
+	Builtin bool     `json:"builtin"`
+	// 路径取决于配置时使用，优先于 Paths
+	pathsFunc func() []string
+}
+
+var (
+	logSourcesMutex sync.Mutex
+	// 内置的日志来源
+	builtinLogSources []LogSource
+	// 用户添加的日志来源，保存在 data/logs/sources.json
+	customLogSources []LogSource
+
+	logFollowersMutex sync.Mutex
+	logFollowers      int
+)
+
+var logSourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// RegisterLogSource 注册内置日志来源
+func RegisterLogSource(s LogSource) {
+	s.Builtin = true
+	logSourcesMutex.Lock()
+	builtinLogSources = append(builtinLogSources, s)
+	logSourcesMutex.Unlock()
+}
+
+func init() {
+	RegisterLogSource(LogSource{
+		Name:      "panel",
+		App:       "面板",
+		pathsFunc: func() []string { return []string{logging.FilePath()} },
+	})
+	RegisterLogSource(LogSource{
+		Name:  "nginx-access",
+		App:   "nginx",
+		Paths: []string{"/var/log/nginx/access.log", "/usr/local/nginx/logs/access.log"},
+	})
+	RegisterLogSource(LogSource{
+		Name:  "nginx-error",
+		App:   "nginx",
+		Paths: []string{"/var/log/nginx/error.log", "/usr/local/nginx/logs/error.log"},
+	})
+	RegisterLogSource(LogSource{
+		Name:        "auth",
+		App:         "系统",
+		Description: "登录与认证日志",
+		Paths:       []string{"/var/log/auth.log", "/var/log/secure"},
+	})
+	RegisterLogSource(LogSource{
+		Name:  "syslog",
+		App:   "系统",
+		Paths: []string{"/var/log/syslog", "/var/log/messages"},
+	})
+	RegisterLogSource(LogSource{
+		Name:  "kernel",
+		App:   "系统",
+		Paths: []string{"/var/log/kern.log"},
+	})
+
+	if data, err := os.ReadFile(filepath.Join(logSourceDataDir, "sources.json")); err == nil {
+		json.Unmarshal(data, &customLogSources)
+	}
+}
+
+// 调用方需持有 logSourcesMutex
+func saveLogSources() error {
+	if err := os.MkdirAll(logSourceDataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(customLogSources, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(logSourceDataDir, "sources.json"), data, 0644)
+}
+
+// 查找日志来源
+func findLogSource(name string) (LogSource, bool) {
+	logSourcesMutex.Lock()
+	defer logSourcesMutex.Unlock()
+	for _, list := range [][]LogSource{builtinLogSources, customLogSources} {
+		for _, s := range list {
+			if s.Name == name {
+				return s, true
+			}
+		}
+	}
+	return LogSource{}, false
+}
+
+// 候选路径
+func (s *LogSource) candidates() []string {
+	if s.pathsFunc != nil {
+		return s.pathsFunc()
+	}
+	return s.Paths
+}
+
+// 返回日志来源实际使用的文件路径
+func (s *LogSource) resolve() (string, bool) {
+	for _, p := range s.candidates() {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// 轮转后的文件：access.log.1、access.log.2.gz、secure-20240101 等
+func rotatedLogPattern(base string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `([.-]\d+)(\.gz)?$`)
+}
+
+// 返回当前文件及其轮转文件，从新到旧排列
+func logFileChain(path string, rotated bool) []string {
+	files := []string{path}
+	if !rotated {
+		return files
+	}
+	pattern := rotatedLogPattern(filepath.Base(path))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return files
+	}
+
+	type rotatedFile struct {
+		path    string
+		modTime time.Time
+	}
+	var siblings []rotatedFile
+	for _, e := range entries {
+		if e.IsDir() || !pattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		siblings = append(siblings, rotatedFile{filepath.Join(filepath.Dir(path), e.Name()), info.ModTime()})
+	}
+	sort.Slice(siblings, func(i, j int) bool { return siblings[i].modTime.After(siblings[j].modTime) })
+	for _, s := range siblings {
+		files = append(files, s.path)
+	}
+	return files
+}
+
+// 从请求中确定日志文件：source 为日志来源名，path 为文件路径（受访问路径限制）
+func logFileFromRequest(c *gin.Context) (string, bool) {
+	if name := c.Query("source"); name != "" {
+		source, ok := findLogSource(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "日志来源不存在"})
+			return "", false
+		}
+		path, ok := source.resolve()
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "日志文件不存在"})
+			return "", false
+		}
+		return path, true
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定日志来源或文件路径"})
+		return "", false
+	}
+	if err := checkPathPolicy(path); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", false
+	}
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "日志文件不存在"})
+		return "", false
+	}
+	if !info.Mode().IsRegular() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不是普通文件"})
+		return "", false
+	}
+	return path, true
+}
+
+// 常见日志格式的时间戳
+var logTimestampFormats = []struct {
+	pattern *regexp.Regexp
+	layouts []string
+	// 格式中不含年份
+	noYear bool
+}{
+	// ISO 8601：2024-01-02T15:04:05.000+08:00、2024-01-02 15:04:05
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`),
+		[]string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"},
+		false,
+	},
+	// nginx 访问日志：[02/Jan/2006:15:04:05 -0700]
+	{
+		regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`),
+		[]string{"02/Jan/2006:15:04:05 -0700"},
+		false,
+	},
+	// nginx 错误日志、Go 标准库日志：2006/01/02 15:04:05；gin 日志：2006/01/02 - 15:04:05
+	{
+		regexp.MustCompile(`\d{4}/\d{2}/\d{2} (- )?\d{2}:\d{2}:\d{2}`),
+		[]string{"2006/01/02 15:04:05", "2006/01/02 - 15:04:05"},
+		false,
+	},
+	// syslog：Jan  2 15:04:05
+	{
+		regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`),
+		[]string{"Jan _2 15:04:05"},
+		true,
+	},
+}
+
+// 解析行首附近的时间戳，没有时间戳时返回零值
+func parseLogTimestamp(line string) time.Time {
+	head := line
+	if len(head) > logTimestampSearchLength {
+		head = head[:logTimestampSearchLength]
+	}
+	for _, f := range logTimestampFormats {
+		m := f.pattern.FindString(head)
+		if m == "" {
+			continue
+		}
+		for _, layout := range f.layouts {
+			t, err := time.ParseInLocation(layout, m, time.Local)
+			if err != nil {
+				continue
+			}
+			if f.noYear {
+				now := time.Now()
+				t = t.AddDate(now.Year(), 0, 0)
+				// 跨年时去年年底的日志会被解析到未来
+				if t.After(now.Add(24 * time.Hour)) {
+					t = t.AddDate(-1, 0, 0)
+				}
+			}
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// LogLine 一行日志
+type LogLine struct {
+	File string     `json:"file"`
+	Time *time.Time `json:"time,omitempty"`
+	Line string     `json:"line"`
+}
+
+// 日志过滤条件
+type logFilter struct {
+	re    *regexp.Regexp
+	since time.Time
+	until time.Time
+}
+
+func parseLogFilter(c *gin.Context) (*logFilter, error) {
+	f := &logFilter{}
+	if q := c.Query("q"); q != "" {
+		re, err := regexp.Compile(q)
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式: %v", err)
+		}
+		f.re = re
+	}
+	for _, p := range []struct {
+		key string
+		t   *time.Time
+	}{{"since", &f.since}, {"until", &f.until}} {
+		v := c.Query(p.key)
+		if v == "" {
+			continue
+		}
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			*p.t = time.Unix(sec, 0)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			*p.t = t
+		} else {
+			return nil, fmt.Errorf("无效的时间: %s", v)
+		}
+	}
+	return f, nil
+}
+
+// 检查一行日志；older 表示该行早于开始时间，倒序读取时可以停止
+func (f *logFilter) check(file, line string) (entry LogLine, matched, older bool) {
+	entry = LogLine{File: file, Line: line}
+	if ts := parseLogTimestamp(line); !ts.IsZero() {
+		entry.Time = &ts
+		if !f.since.IsZero() && ts.Before(f.since) {
+			return entry, false, true
+		}
+		if !f.until.IsZero() && ts.After(f.until) {
+			return entry, false, false
+		}
+	}
+	// 没有时间戳的行（如多行日志的后续行）不参与时间过滤
+	if f.re != nil && !f.re.MatchString(line) {
+		return entry, false, false
+	}
+	return entry, true, false
+}
+
+func truncateLogLine(line string) string {
+	if len(line) > maxLogLineLength {
+		return strings.ToValidUTF8(line[:maxLogLineLength], "") + "…"
+	}
+	return line
+}
+
+// 从文件末尾开始倒序读取各行，回调返回 false 时停止
+func readLinesBackward(ctx context.Context, f *os.File, end int64, fn func(line string) bool) error {
+	buf := make([]byte, logReadChunkSize)
+	var partial []byte
+	offset := end
+	first := true
+	for offset > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n := int64(len(buf))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		if _, err := f.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return err
+		}
+		chunk := append(buf[:n:n], partial...)
+		// 文件末尾的换行不产生空行
+		if first {
+			chunk = bytes.TrimSuffix(chunk, []byte("\n"))
+			first = false
+		}
+		for {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			if !fn(truncateLogLine(string(chunk[i+1:]))) {
+				return nil
+			}
+			chunk = chunk[:i]
+		}
+		// 超长的行只保留末尾部分，避免占用过多内存
+		if len(chunk) > maxLogLineLength {
+			chunk = chunk[len(chunk)-maxLogLineLength:]
+		}
+		partial = append([]byte(nil), chunk...)
+	}
+	if len(partial) > 0 {
+		fn(truncateLogLine(string(partial)))
+	}
+	return nil
+}
+
+// 倒序读取日志文件中匹配的行，压缩文件需要从头解压，只保留最后 limit 条匹配的行
+func scanLogFileBackward(ctx context.Context, path string, filter *logFilter, limit int, fn func(LogLine) bool) (stop bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".gz") {
+		info, err := f.Stat()
+		if err != nil {
+			return false, err
+		}
+		err = readLinesBackward(ctx, f, info.Size(), func(line string) bool {
+			entry, matched, older := filter.check(path, line)
+			if older {
+				stop = true
+				return false
+			}
+			if matched && !fn(entry) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		return stop, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return false, err
+	}
+	defer gz.Close()
+
+	// 环形缓冲区保留最后 limit 条匹配的行
+	ring := make([]LogLine, 0, limit)
+	next := 0
+	reachedSince := false
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		entry, matched, older := filter.check(path, truncateLogLine(scanner.Text()))
+		if older {
+			reachedSince = true
+			continue
+		}
+		if !matched || limit == 0 {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, entry)
+		} else {
+			ring[next] = entry
+			next = (next + 1) % limit
+		}
+	}
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return false, err
+	}
+	for i := len(ring) - 1; i >= 0; i-- {
+		if !fn(ring[(next+i)%len(ring)]) {
+			return true, nil
+		}
+	}
+	return reachedSince, nil
+}
+
+// 读取最新的 limit 条匹配的日志，按时间正序返回
+func tailLogFiles(ctx context.Context, files []string, filter *logFilter, limit int) (lines []LogLine, more bool, err error) {
+	lines = make([]LogLine, 0, limit)
+	for _, file := range files {
+		stop, err := scanLogFileBackward(ctx, file, filter, limit-len(lines)+1, func(l LogLine) bool {
+			if len(lines) >= limit {
+				more = true
+				return false
+			}
+			lines = append(lines, l)
+			return true
+		})
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			// 轮转文件可能在读取过程中被删除
+			if file != files[0] && os.IsNotExist(err) {
+				continue
+			}
+			return nil, false, err
+		}
+		if stop {
+			break
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, more, nil
+}
+
+// 处理日志来源列表请求
+func HandleLogSourcesList(c *gin.Context) {
+	logSourcesMutex.Lock()
+	sources := append(append([]LogSource(nil), builtinLogSources...), customLogSources...)
+	logSourcesMutex.Unlock()
+
+	result := make([]gin.H, 0, len(sources))
+	for _, s := range sources {
+		item := gin.H{
+			"name":        s.Name,
+			"app":         s.App,
+			"description": s.Description,
+			"paths":       s.candidates(),
+			"builtin":     s.Builtin,
+		}
+		if path, ok := s.resolve(); ok {
+			item["path"] = path
+			if info, err := os.Stat(path); err == nil {
+				item["size"] = info.Size()
+				item["modTime"] = info.ModTime()
+			}
+			item["rotated"] = logFileChain(path, true)[1:]
+		}
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// 处理添加或修改日志来源请求，请求体：name、app、description、paths（绝对路径）
+func HandleLogSourceSave(c *gin.Context) {
+	var req LogSource
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if !logSourceNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "名称只能包含小写字母、数字、点、下划线和横线"})
+		return
+	}
+	if len(req.Paths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请至少指定一个日志文件路径"})
+		return
+	}
+	for i, p := range req.Paths {
+		if err := checkPathPolicy(p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Paths[i] = filepath.Clean(p)
+	}
+	req.Builtin = false
+
+	logSourcesMutex.Lock()
+	defer logSourcesMutex.Unlock()
+
+	for _, s := range builtinLogSources {
+		if s.Name == req.Name {
+			c.JSON(http.StatusConflict, gin.H{"error": "不能覆盖内置的日志来源"})
+			return
+		}
+	}
+	replaced := false
+	for i := range customLogSources {
+		if customLogSources[i].Name == req.Name {
+			customLogSources[i] = req
+			replaced = true
+		}
+	}
+	if !replaced {
+		customLogSources = append(customLogSources, req)
+	}
+	if err := saveLogSources(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// 处理删除日志来源请求，参数 name
+func HandleLogSourceDelete(c *gin.Context) {
+	name := c.Query("name")
+
+	logSourcesMutex.Lock()
+	defer logSourcesMutex.Unlock()
+
+	kept := customLogSources[:0]
+	found := false
+	for _, s := range customLogSources {
+		if s.Name == name {
+			found = true
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "日志来源不存在或为内置来源"})
+		return
+	}
+	customLogSources = kept
+	if err := saveLogSources(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "日志来源已删除"})
+}
+
+// 处理日志文件查询请求
+//
+// 参数：source 为日志来源名，或 path 为文件路径；q 为正则表达式；
+// since/until 为 RFC3339 时间或 Unix 秒，按行首的时间戳过滤，没有时间戳的行不参与时间过滤；
+// rotated 为 true 时同时读取轮转文件（包括 .gz）；lines 为返回的行数。
+// 结果按时间正序排列，返回最新的 lines 行。
+func HandleLogFileQuery(c *gin.Context) {
+	path, ok := logFileFromRequest(c)
+	if !ok {
+		return
+	}
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("lines", strconv.Itoa(defaultLogLines)))
+	if limit < 1 || limit > maxLogLines {
+		limit = defaultLogLines
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
+	defer cancel()
+
+	files := logFileChain(path, c.Query("rotated") == "true")
+	lines, more, err := tailLogFiles(ctx, files, filter, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"path":  path,
+		"files": files,
+		"lines": lines,
+		// 还有更早的匹配行未返回
+		"more": more,
+		// 超时时只返回已读取到的部分结果
+		"partial": ctx.Err() == context.DeadlineExceeded,
+	})
+}
+
+// 跟踪中的日志文件
+type logFollower struct {
+	path    string
+	file    *os.File
+	inode   uint64
+	offset  int64
+	partial []byte
+}
+
+func fileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
+
+// 打开文件，from 为起始位置，小于 0 时从文件末尾开始
+func (f *logFollower) open(from int64) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if from < 0 {
+		from = info.Size()
+	}
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file, f.inode, f.offset, f.partial = file, fileInode(info), from, nil
+	return nil
+}
+
+func (f *logFollower) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+}
+
+// 读取新增内容中的完整行
+func (f *logFollower) readLines() ([]string, error) {
+	var lines []string
+	buf := make([]byte, logReadChunkSize)
+	for {
+		n, err := f.file.ReadAt(buf, f.offset)
+		f.offset += int64(n)
+		data := append(f.partial, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			lines = append(lines, truncateLogLine(string(data[:i])))
+			data = data[i+1:]
+		}
+		// 超长的行直接输出，避免一直等待换行
+		if len(data) > maxLogLineLength {
+			lines = append(lines, truncateLogLine(string(data)))
+			data = nil
+		}
+		f.partial = append([]byte(nil), data...)
+		if err == io.EOF || n == 0 {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// 检查轮转和截断：路径指向了新文件时读完旧文件再切换，文件变小时从头读取
+//
+// 返回事件名以及切换前旧文件中剩余的行
+func (f *logFollower) checkRotation() (string, []string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		// 轮转过程中文件可能暂时不存在
+		return "", nil, nil
+	}
+	if fileInode(info) != f.inode {
+		// 旧文件在轮转前后可能还有写入
+		rest, err := f.readLines()
+		if err != nil {
+			return "", rest, err
+		}
+		if len(f.partial) > 0 {
+			rest = append(rest, string(f.partial))
+		}
+		if err := f.open(0); err != nil {
+			return "", rest, err
+		}
+		return "rotated", rest, nil
+	}
+	if info.Size() < f.offset {
+		f.offset, f.partial = 0, nil
+		return "truncated", nil, nil
+	}
+	return "", nil, nil
+}
+
+// 处理日志文件跟踪请求（SSE）
+//
+// 参数与查询接口相同（不支持 rotated 和 until）。连接建立后先推送最近 lines 行匹配的日志，
+// 之后持续推送新增的行，每行为一个 line 事件。文件被轮转（路径指向新文件）或截断时
+// 发送 rotated 或 truncated 事件，并从新文件的开头继续读取。
+func HandleLogFileStream(c *gin.Context) {
+	path, ok := logFileFromRequest(c)
+	if !ok {
+		return
+	}
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.until = time.Time{}
+	limit, _ := strconv.Atoi(c.DefaultQuery("lines", strconv.Itoa(defaultLogLines)))
+	if limit < 0 || limit > maxLogLines {
+		limit = defaultLogLines
+	}
+
+	logFollowersMutex.Lock()
+	if logFollowers >= maxLogFollowers {
+		logFollowersMutex.Unlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "跟踪日志的客户端过多，请稍后重试"})
+		return
+	}
+	logFollowers++
+	logFollowersMutex.Unlock()
+	defer func() {
+		logFollowersMutex.Lock()
+		logFollowers--
+		logFollowersMutex.Unlock()
+	}()
+
+	follower := &logFollower{path: path}
+	if err := follower.open(-1); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer follower.close()
+
+	var recent []LogLine
+	if limit > 0 {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), logQueryTimeout)
+		recent, _, _ = tailLogFiles(ctx, []string{path}, filter, limit)
+		cancel()
+	}
+
+	write := startEventStream(c)
+	if !write("config", gin.H{"path": path}) {
+		return
+	}
+	for _, l := range recent {
+		if !write("line", l) {
+			return
+		}
+	}
+
+	lastWrite := time.Now()
+	writeLines := func(lines []string) bool {
+		for _, line := range lines {
+			if entry, matched, _ := filter.check(path, line); matched {
+				if !write("line", entry) {
+					return false
+				}
+				lastWrite = time.Now()
+			}
+		}
+		return true
+	}
+
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		lines, err := follower.readLines()
+		if err != nil {
+			write("error", gin.H{"error": err.Error()})
+			return
+		}
+		event, rest, err := follower.checkRotation()
+		if !writeLines(append(lines, rest...)) {
+			return
+		}
+		if err != nil {
+			write("error", gin.H{"error": err.Error()})
+			return
+		}
+		if event != "" {
+			if !write(event, gin.H{"path": path}) {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		if time.Since(lastWrite) >= streamKeepAlive {
+			if !write("ping", gin.H{"time": time.Now().Unix()}) {
+				return
+			}
+			lastWrite = time.Now()
+		}
+	}
+}
@@ -1,37 +1,448 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetSystemLogs(c *gin.Context) {
-	lines := c.DefaultQuery("lines", "100")
-	cmd := exec.Command("journalctl", "-n", lines, "--no-pager")
-	output, err := cmd.Output()
+const (
+	defaultJournalLines = 100
+	maxJournalLines     = 5000
+	// 查询的最长执行时间，带文本过滤时可能需要扫描大量日志
+	journalQueryTimeout = 15 * time.Second
+	// 同时跟踪日志的客户端上限
+	maxJournalFollowers = 20
+	// 单条日志 JSON 的最大长度
+	maxJournalEntrySize = 1024 * 1024
+)
+
+// 日志级别名称，与 syslog 一致
+var journalPriorities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+var (
+	journalBootPattern   = regexp.MustCompile(`^(-?\d+|[0-9a-f]{32})$`)
+	journalCursorPattern = regexp.MustCompile(`^[A-Za-z0-9=;_-]+$`)
+	// SYSLOG_IDENTIFIER 只允许常见的程序名字符
+	journalIdentPattern = regexp.MustCompile(`^[A-Za-z0-9@._:/+-]+$`)
+)
+
+// JournalEntry 一条 journald 日志
+type JournalEntry struct {
+	Time       time.Time `json:"time"`
+	Priority   int       `json:"priority"`
+	Unit       string    `json:"unit,omitempty"`
+	Identifier string    `json:"identifier,omitempty"`
+	Pid        int       `json:"pid,omitempty"`
+	Hostname   string    `json:"hostname,omitempty"`
+	BootID     string    `json:"bootId,omitempty"`
+	Message    string    `json:"message"`
+	Cursor     string    `json:"cursor"`
+}
+
+// journalQuery 日志过滤条件
+type journalQuery struct {
+	units       []string
+	identifiers []string
+	priority    int
+	boot        string
+	since       string
+	until       string
+	text        string
+	lines       int
+	afterCursor string
+}
+
+var (
+	journalFollowersMutex sync.Mutex
+	journalFollowers      int
+)
+
+// 解析时间参数：RFC3339 或 Unix 秒，转换为 journalctl 可识别的格式
+func parseJournalTime(v string) (string, bool) {
+	if v == "" {
+		return "", true
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "@" + strconv.FormatInt(sec, 10), true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return "@" + strconv.FormatInt(t.Unix(), 10), true
+	}
+	return "", false
+}
+
+// 从请求中解析过滤条件
+func parseJournalQuery(c *gin.Context) (*journalQuery, error) {
+	q := &journalQuery{priority: -1, lines: defaultJournalLines}
+
+	for _, unit := range c.QueryArray("unit") {
+		if unit == "" {
+			continue
+		}
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+		if !unitRefPattern.MatchString(unit) {
+			return nil, errors.New("无效的单元名")
+		}
+		q.units = append(q.units, unit)
+	}
+	for _, ident := range c.QueryArray("identifier") {
+		if ident == "" {
+			continue
+		}
+		if !journalIdentPattern.MatchString(ident) {
+			return nil, errors.New("无效的程序标识")
+		}
+		q.identifiers = append(q.identifiers, ident)
+	}
+
+	if p := c.Query("priority"); p != "" {
+		if n, ok := journalPriorities[p]; ok {
+			q.priority = n
+		} else if n, err := strconv.Atoi(p); err == nil && n >= 0 && n <= 7 {
+			q.priority = n
+		} else {
+			return nil, errors.New("无效的日志级别")
+		}
+	}
+
+	if b := c.Query("boot"); b != "" {
+		if !journalBootPattern.MatchString(b) {
+			return nil, errors.New("无效的启动标识")
+		}
+		q.boot = b
+	}
+
+	var ok bool
+	if q.since, ok = parseJournalTime(c.Query("since")); !ok {
+		return nil, errors.New("无效的开始时间")
+	}
+	if q.until, ok = parseJournalTime(c.Query("until")); !ok {
+		return nil, errors.New("无效的结束时间")
+	}
+
+	if v := c.Query("lines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("无效的行数")
+		}
+		if n > maxJournalLines {
+			n = maxJournalLines
+		}
+		q.lines = n
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		if !journalCursorPattern.MatchString(cursor) {
+			return nil, errors.New("无效的游标")
+		}
+		q.afterCursor = cursor
+	}
+
+	q.text = strings.ToLower(strings.TrimSpace(c.Query("q")))
+	return q, nil
+}
+
+// 生成 journalctl 参数，所有取值都已校验，且作为独立参数传递
+func (q *journalQuery) args() []string {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	for _, unit := range q.units {
+		args = append(args, "--unit="+unit)
+	}
+	for _, ident := range q.identifiers {
+		args = append(args, "--identifier="+ident)
+	}
+	if q.priority >= 0 {
+		args = append(args, "--priority="+strconv.Itoa(q.priority))
+	}
+	if q.boot != "" {
+		args = append(args, "--boot="+q.boot)
+	}
+	if q.since != "" {
+		args = append(args, "--since="+q.since)
+	}
+	if q.until != "" {
+		args = append(args, "--until="+q.until)
+	}
+	if q.afterCursor != "" {
+		args = append(args, "--after-cursor="+q.afterCursor)
+	}
+	return args
+}
+
+func (q *journalQuery) match(e *JournalEntry) bool {
+	return q.text == "" || strings.Contains(strings.ToLower(e.Message), q.text)
+}
+
+// 字段值通常是字符串，包含非 UTF-8 内容时是字节数组
+func journalField(fields map[string]json.RawMessage, key string) string {
+	raw, ok := fields[key]
+	if !ok {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var ints []int
+	if json.Unmarshal(raw, &ints) == nil {
+		b := make([]byte, len(ints))
+		for i, v := range ints {
+			b[i] = byte(v)
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	return ""
+}
+
+// 解析 journalctl -o json 输出的一行
+func parseJournalEntry(line []byte) (*JournalEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	e := &JournalEntry{
+		Unit:       journalField(fields, "_SYSTEMD_UNIT"),
+		Identifier: journalField(fields, "SYSLOG_IDENTIFIER"),
+		Hostname:   journalField(fields, "_HOSTNAME"),
+		BootID:     journalField(fields, "_BOOT_ID"),
+		Message:    journalField(fields, "MESSAGE"),
+		Cursor:     journalField(fields, "__CURSOR"),
+		Priority:   6,
+	}
+	// systemd 自身关于某个单元的消息记录在 UNIT 字段
+	if e.Unit == "" {
+		e.Unit = journalField(fields, "UNIT")
+	}
+	if us, err := strconv.ParseInt(journalField(fields, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		e.Time = time.UnixMicro(us)
+	}
+	if p, err := strconv.Atoi(journalField(fields, "PRIORITY")); err == nil {
+		e.Priority = p
+	}
+	e.Pid, _ = strconv.Atoi(journalField(fields, "_PID"))
+	return e, nil
+}
+
+// 逐行读取 journalctl 输出，回调返回 false 时停止
+func scanJournal(r io.Reader, fn func(*JournalEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJournalEntrySize)
+	for scanner.Scan() {
+		e, err := parseJournalEntry(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// 检查 journalctl 是否可用，失败时已写入响应
+func requireJournalctl(c *gin.Context) bool {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未找到 journalctl"})
+		return false
+	}
+	return true
+}
+
+// 处理日志查询请求
+//
+// 参数：unit、identifier 可重复；priority 为 0-7 或 emerg/alert/crit/err/warning/notice/info/debug，
+// 返回该级别及更严重的日志；boot 为启动偏移（0 为本次启动，-1 为上次）或启动ID；
+// since/until 为 RFC3339 时间或 Unix 秒；q 按消息内容过滤；lines 为返回的条数；
+// cursor 为上次返回的游标，只返回其后的日志。
+// 结果按时间正序排列，返回最新的 lines 条。
+func HandleJournalQuery(c *gin.Context) {
+	q, err := parseJournalQuery(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireJournalctl(c) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), journalQueryTimeout)
+	defer cancel()
+
+	// 没有游标时倒序读取最新的日志；收集到足够的匹配条目后停止，避免为文本过滤读取全部日志。
+	// 指定游标时从游标处正序读取（--reverse 会改为读取游标之前的日志）
+	args := q.args()
+	reverse := q.afterCursor == ""
+	if reverse {
+		args = append(args, "--reverse")
+	}
+	if reverse && q.text == "" {
+		args = append(args, "--lines="+strconv.Itoa(q.lines))
+	}
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.String(http.StatusOK, string(output))
+
+	entries := make([]*JournalEntry, 0, q.lines)
+	truncated := false
+	scanErr := scanJournal(stdout, func(e *JournalEntry) bool {
+		if !q.match(e) {
+			return true
+		}
+		if len(entries) >= q.lines {
+			truncated = true
+			return false
+		}
+		entries = append(entries, e)
+		return true
+	})
+	cmd.Process.Kill()
+	waitErr := cmd.Wait()
+
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	if !timedOut && scanErr == nil && waitErr != nil && !truncated && len(entries) == 0 && stderr.Len() > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": strings.TrimSpace(stderr.String())})
+		return
+	}
+
+	if reverse {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	cursor := q.afterCursor
+	if len(entries) > 0 {
+		cursor = entries[len(entries)-1].Cursor
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"cursor":  cursor,
+		// 还有更多匹配的日志未返回
+		"more": truncated,
+		// 超时时只返回已扫描到的部分结果
+		"partial": timedOut,
+	})
 }
 
-func GetServiceLogs(c *gin.Context) {
-	service := c.Query("service")
-	lines := c.DefaultQuery("lines", "100")
+// 处理日志跟踪请求（SSE）
+//
+// 过滤参数与查询接口相同。连接建立后先推送最近 lines 条日志（指定 cursor 时推送其后的全部日志），
+// 之后持续推送新日志，每条日志为一个 entry 事件。
+func HandleJournalStream(c *gin.Context) {
+	q, err := parseJournalQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q.until != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "跟踪模式不支持结束时间"})
+		return
+	}
+	if !requireJournalctl(c) {
+		return
+	}
 
-	if service == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "服务名不能为空"})
+	journalFollowersMutex.Lock()
+	if journalFollowers >= maxJournalFollowers {
+		journalFollowersMutex.Unlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "跟踪日志的客户端过多，请稍后重试"})
 		return
 	}
+	journalFollowers++
+	journalFollowersMutex.Unlock()
+	defer func() {
+		journalFollowersMutex.Lock()
+		journalFollowers--
+		journalFollowersMutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
 
-	cmd := exec.Command("journalctl", "-u", service, "-n", lines, "--no-pager")
-	output, err := cmd.Output()
+	args := append(q.args(), "--follow")
+	if q.afterCursor == "" {
+		args = append(args, "--lines="+strconv.Itoa(q.lines))
+	}
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.String(http.StatusOK, string(output))
+	if err := cmd.Start(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 先结束 journalctl 再等待退出
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	entries := make(chan *JournalEntry, 64)
+	go func() {
+		defer close(entries)
+		scanJournal(stdout, func(e *JournalEntry) bool {
+			if !q.match(e) {
+				return true
+			}
+			select {
+			case entries <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	write := startEventStream(c)
+	if !write("ping", gin.H{"time": time.Now().Unix()}) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-entries:
+			if !ok {
+				write("end", gin.H{"message": "日志读取已结束"})
+				return
+			}
+			if !write("entry", e) {
+				return
+			}
+		case <-keepAlive.C:
+			if !write("ping", gin.H{"time": time.Now().Unix()}) {
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 处理历史数据查询请求
+//
+// 参数：start/end 为 Unix 秒或 RFC3339（默认最近1小时），step 为秒数或时长（如 5m），
+// series 为逗号分隔的序列名，以 * 结尾表示前缀匹配，留空返回全部序列。
+func HandleMetricsQuery(c *gin.Context) {
+	if metricStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "历史数据存储不可用"})
+		return
+	}
+
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+			return
+		}
+		end = t
+	}
+	start := end.Add(-time.Hour)
+	if v := c.Query("start"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+			return
+		}
+		start = t
+	}
+
+	var step time.Duration
+	if v := c.Query("step"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil {
+			step = time.Duration(sec) * time.Second
+		} else if d, err := time.ParseDuration(v); err == nil {
+			step = d
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的步长"})
+			return
+		}
+	}
+
+	var series []string
+	for _, name := range strings.Split(c.Query("series"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			series = append(series, name)
+		}
+	}
+
+	result, err := metricStore.Query(start, end, step, series)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// 处理序列列表请求
+func HandleMetricsSeries(c *gin.Context) {
+	if metricStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "历史数据存储不可用"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"series": metricStore.SeriesNames()})
+}
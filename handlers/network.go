@@ -1,28 +1,349 @@
 package handlers
 
 import (
+	"bufio"
 	"net/http"
-	"os/exec"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
 )
 
-func GetNetworkStats(c *gin.Context) {
-	cmd := exec.Command("netstat", "-i")
-	output, err := cmd.Output()
+// InterfaceStats 网卡状态和速率
+type InterfaceStats struct {
+	Name         string   `json:"name"`
+	HardwareAddr string   `json:"hardwareAddr"`
+	MTU          int      `json:"mtu"`
+	Addrs        []string `json:"addrs"`
+	Up           bool     `json:"up"`
+	OperState    string   `json:"operState"` // up/down/unknown，来自 /sys/class/net
+	Speed        int      `json:"speed"`     // 链路速率（Mb/s），未知时为0
+	Virtual      bool     `json:"virtual"`   // 回环、网桥、veth 等虚拟网卡
+	BytesSent    uint64   `json:"bytesSent"`
+	BytesRecv    uint64   `json:"bytesRecv"`
+	SentSpeed    float64  `json:"sentSpeed"` // 字节/秒
+	RecvSpeed    float64  `json:"recvSpeed"` // 字节/秒
+	PacketsSent  float64  `json:"packetsSent"`
+	PacketsRecv  float64  `json:"packetsRecv"`
+	ErrorsIn     float64  `json:"errorsIn"`
+	ErrorsOut    float64  `json:"errorsOut"`
+	DropsIn      float64  `json:"dropsIn"`
+	DropsOut     float64  `json:"dropsOut"`
+}
+
+// 网卡采样器，只由采集器调用
+type netSampler struct {
+	mu       sync.Mutex
+	last     map[string]net.IOCountersStat
+	lastTime time.Time
+}
+
+var netStatsSampler = &netSampler{}
+
+// 虚拟网卡在 /sys/devices/virtual/net 下
+func isVirtualInterface(name string) bool {
+	target, err := filepath.EvalSymlinks(filepath.Join("/sys/class/net", name))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return name == "lo"
+	}
+	return strings.Contains(target, "/virtual/")
+}
+
+func readSysNet(name, attr string) string {
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", name, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// 计数器差值，计数器回绕或网卡重置时返回 false
+func counterDelta(cur, prev uint64) (uint64, bool) {
+	if cur < prev {
+		return 0, false
+	}
+	return cur - prev, true
+}
+
+// 采集所有网卡的状态和速率，第一次调用只记录基准值
+func (s *netSampler) sample() ([]InterfaceStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, _ := net.Interfaces()
+	ifaceByName := make(map[string]net.InterfaceStat, len(ifaces))
+	for _, iface := range ifaces {
+		ifaceByName[iface.Name] = iface
+	}
+
+	elapsed := now.Sub(s.lastTime).Seconds()
+	current := make(map[string]net.IOCountersStat, len(counters))
+	stats := make([]InterfaceStats, 0, len(counters))
+	for _, cur := range counters {
+		current[cur.Name] = cur
+		stat := InterfaceStats{
+			Name:      cur.Name,
+			Virtual:   isVirtualInterface(cur.Name),
+			OperState: readSysNet(cur.Name, "operstate"),
+			BytesSent: cur.BytesSent,
+			BytesRecv: cur.BytesRecv,
+			Addrs:     []string{},
+		}
+		if speed, err := strconv.Atoi(readSysNet(cur.Name, "speed")); err == nil && speed > 0 {
+			stat.Speed = speed
+		}
+		if iface, ok := ifaceByName[cur.Name]; ok {
+			stat.HardwareAddr = iface.HardwareAddr
+			stat.MTU = iface.MTU
+			for _, flag := range iface.Flags {
+				if flag == "up" {
+					stat.Up = true
+				}
+			}
+			for _, addr := range iface.Addrs {
+				stat.Addrs = append(stat.Addrs, addr.Addr)
+			}
+		}
+
+		if prev, ok := s.last[cur.Name]; ok && elapsed > 0 {
+			rate := func(c, p uint64) float64 {
+				d, ok := counterDelta(c, p)
+				if !ok {
+					return 0
+				}
+				return float64(d) / elapsed
+			}
+			stat.SentSpeed = rate(cur.BytesSent, prev.BytesSent)
+			stat.RecvSpeed = rate(cur.BytesRecv, prev.BytesRecv)
+			stat.PacketsSent = rate(cur.PacketsSent, prev.PacketsSent)
+			stat.PacketsRecv = rate(cur.PacketsRecv, prev.PacketsRecv)
+			stat.ErrorsIn = rate(cur.Errin, prev.Errin)
+			stat.ErrorsOut = rate(cur.Errout, prev.Errout)
+			stat.DropsIn = rate(cur.Dropin, prev.Dropin)
+			stat.DropsOut = rate(cur.Dropout, prev.Dropout)
+		}
+		stats = append(stats, stat)
+	}
+
+	s.last = current
+	s.lastTime = now
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats, nil
+}
+
+// 汇总非虚拟网卡的流量，回环和容器网桥不计入
+func aggregateNetwork(stats []InterfaceStats) (sentSpeed, recvSpeed, totalSent, totalRecv uint64) {
+	for _, s := range stats {
+		if s.Virtual {
+			continue
+		}
+		sentSpeed += uint64(s.SentSpeed)
+		recvSpeed += uint64(s.RecvSpeed)
+		totalSent += s.BytesSent
+		totalRecv += s.BytesRecv
+	}
+	return
+}
+
+// TCP 状态码，见内核 include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// 直接读取 /proc/net/tcp{,6} 统计各状态的连接数，不需要扫描进程
+func tcpStateSummary() (map[string]int, error) {
+	summary := make(map[string]int)
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // 表头
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			if state, ok := tcpStates[fields[3]]; ok {
+				summary[state]++
+			}
+		}
+		f.Close()
+	}
+	return summary, nil
+}
+
+// 网络状态对应的历史数据序列。物理网卡单独记录，docker 的 veth、网桥等虚拟网卡
+// 名称经常变化，合并记录为 virtual，避免序列数量无限增长
+func netStatsValues(ifaces []InterfaceStats, tcp map[string]int, values map[string]float64) {
+	for _, s := range ifaces {
+		if s.Name == "lo" {
+			continue
+		}
+		name := s.Name
+		if s.Virtual {
+			name = "virtual"
+		}
+		values["net.sent_bytes:"+name] += s.SentSpeed
+		values["net.recv_bytes:"+name] += s.RecvSpeed
+		values["net.sent_packets:"+name] += s.PacketsSent
+		values["net.recv_packets:"+name] += s.PacketsRecv
+		values["net.errors:"+name] += s.ErrorsIn + s.ErrorsOut
+		values["net.drops:"+name] += s.DropsIn + s.DropsOut
+	}
+	for _, state := range tcpStates {
+		values["tcp."+strings.ToLower(state)] = float64(tcp[state])
+	}
+}
+
+// ListeningSocket 监听中的套接字
+type ListeningSocket struct {
+	Protocol string `json:"protocol"` // tcp, tcp6, udp, udp6
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	Pid      int32  `json:"pid"`
+	Process  string `json:"process"`
+	User     string `json:"user"`
+}
+
+// 套接字的协议名称
+func socketProtocol(c net.ConnectionStat) string {
+	proto := "tcp"
+	if c.Type == 2 { // SOCK_DGRAM
+		proto = "udp"
+	}
+	if c.Family == 10 { // AF_INET6
+		proto += "6"
+	}
+	return proto
+}
+
+// 是否为未连接的 UDP 套接字，即 UDP 监听。gopsutil 对未连接的套接字返回 0.0.0.0 或 :: 而不是空地址
+func isUDPListener(c net.ConnectionStat) bool {
+	if c.Type != 2 || c.Raddr.Port != 0 {
+		return false
+	}
+	if c.Raddr.IP == "" {
+		return true
+	}
+	addr, err := netip.ParseAddr(c.Raddr.IP)
+	return err == nil && addr.IsUnspecified()
+}
+
+// 处理网卡列表请求
+func HandleNetworkInterfaces(c *gin.Context) {
+	snapshot, ok := latestSnapshot()
+	if !ok {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "网络信息采集中，请稍后重试"})
 		return
 	}
-	c.String(http.StatusOK, string(output))
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":  snapshot.Timestamp,
+		"interfaces": snapshot.Interfaces,
+	})
 }
 
-func GetConnections(c *gin.Context) {
-	cmd := exec.Command("netstat", "-ntu")
-	output, err := cmd.Output()
+// 处理连接统计请求：TCP状态汇总和监听端口列表
+func HandleNetworkConnections(c *gin.Context) {
+	summary, err := tcpStateSummary()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	conns, err := net.Connections("inet")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.String(http.StatusOK, string(output))
+
+	// 同一进程的名称和用户只查询一次
+	type procInfo struct{ name, user string }
+	procs := make(map[int32]procInfo)
+	lookup := func(pid int32) procInfo {
+		if info, ok := procs[pid]; ok || pid == 0 {
+			return info
+		}
+		var info procInfo
+		if p, err := process.NewProcess(pid); err == nil {
+			info.name, _ = p.Name()
+			info.user, _ = p.Username()
+		}
+		procs[pid] = info
+		return info
+	}
+
+	listening := []ListeningSocket{}
+	remotes := make(map[string]int)
+	for _, conn := range conns {
+		if conn.Status == "LISTEN" || isUDPListener(conn) {
+			info := lookup(conn.Pid)
+			listening = append(listening, ListeningSocket{
+				Protocol: socketProtocol(conn),
+				Address:  conn.Laddr.IP,
+				Port:     conn.Laddr.Port,
+				Pid:      conn.Pid,
+				Process:  info.name,
+				User:     info.user,
+			})
+			continue
+		}
+		if conn.Status == "ESTABLISHED" {
+			remotes[conn.Raddr.IP]++
+		}
+	}
+	sort.Slice(listening, func(i, j int) bool {
+		if listening[i].Port != listening[j].Port {
+			return listening[i].Port < listening[j].Port
+		}
+		return listening[i].Protocol < listening[j].Protocol
+	})
+
+	// 连接数最多的远端地址
+	type remoteCount struct {
+		Address string `json:"address"`
+		Count   int    `json:"count"`
+	}
+	topRemotes := make([]remoteCount, 0, len(remotes))
+	for addr, n := range remotes {
+		topRemotes = append(topRemotes, remoteCount{addr, n})
+	}
+	sort.Slice(topRemotes, func(i, j int) bool { return topRemotes[i].Count > topRemotes[j].Count })
+	if len(topRemotes) > 20 {
+		topRemotes = topRemotes[:20]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tcpStates":  summary,
+		"listening":  listening,
+		"topRemotes": topRemotes,
+	})
 }
@@ -0,0 +1,816 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 单次发送的超时时间
+	notifyTimeout = 15 * time.Second
+	// 发送失败时的最多尝试次数，间隔按 notifyRetryDelay 翻倍
+	notifyMaxAttempts = 4
+	notifyRetryDelay  = 2 * time.Second
+	// 每个渠道每分钟默认最多发送的消息数
+	defaultNotifyRateLimit = 20
+	// 接口返回时替代密码、密钥等敏感字段
+	maskedSecret = "******"
+)
+
+// Notification 发送到通知渠道的消息
+type Notification struct {
+	Title    string      `json:"title"`
+	Text     string      `json:"text"`
+	Severity string      `json:"severity"`
+	State    string      `json:"state"`
+	Time     time.Time   `json:"time"`
+	Event    *AlertEvent `json:"event,omitempty"` // 测试消息为空
+}
+
+// NotifyChannel 通知渠道配置，不同类型使用不同字段
+type NotifyChannel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"` // webhook, email, dingtalk, wecom, feishu, telegram
+	Enabled bool   `json:"enabled"`
+	// 低于该级别的告警不发送
+	MinSeverity string `json:"minSeverity,omitempty"`
+	// 是否发送恢复通知
+	SendResolved bool `json:"sendResolved"`
+	// 每分钟最多发送的消息数，0 表示使用默认值
+	RateLimit int `json:"rateLimit,omitempty"`
+
+	// webhook 和机器人的地址；telegram 为 API 地址，默认 https://api.telegram.org
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// webhook 请求体模板（text/template），为空时发送 Notification 的 JSON
+	Template string `json:"template,omitempty"`
+	// 钉钉、飞书机器人的加签密钥
+	Secret string `json:"secret,omitempty"`
+
+	BotToken string `json:"botToken,omitempty"`
+	ChatID   string `json:"chatId,omitempty"`
+
+	SMTPHost string   `json:"smtpHost,omitempty"`
+	SMTPPort int      `json:"smtpPort,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	// tls：直接使用TLS（465端口）；starttls：服务器支持时升级（默认）；none：不加密
+	SMTPSecurity string `json:"smtpSecurity,omitempty"`
+}
+
+// ChannelStatus 渠道最近的发送情况
+type ChannelStatus struct {
+	LastSentAt  *time.Time `json:"lastSentAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	Sent        int        `json:"sent"`
+	Failed      int        `json:"failed"`
+	// 因限流未发送的消息数
+	Throttled int `json:"throttled"`
+}
+
+// Notifier 通知渠道类型
+type Notifier struct {
+	Type string
+	// 检查渠道配置
+	Check func(ch *NotifyChannel) error
+	Send  func(ctx context.Context, ch *NotifyChannel, n *Notification) error
+}
+
+var (
+	notifiers = make(map[string]Notifier)
+
+	notifyMutex    sync.Mutex
+	notifyChannels []*NotifyChannel
+	channelStatus  = make(map[string]*ChannelStatus)
+	// 每个渠道最近一分钟内的发送时间
+	channelSendTimes = make(map[string][]time.Time)
+	// 限流期间被丢弃的消息数，在下一条消息中提示
+	channelDropped = make(map[string]int)
+
+	notifyHTTPClient = &http.Client{Timeout: notifyTimeout}
+)
+
+// RegisterNotifier 注册通知渠道类型
+func RegisterNotifier(n Notifier) {
+	notifiers[n.Type] = n
+}
+
+func init() {
+	RegisterNotifier(Notifier{Type: "webhook", Check: requireChannelURL, Send: sendWebhook})
+	RegisterNotifier(Notifier{Type: "dingtalk", Check: requireChannelURL, Send: sendDingTalk})
+	RegisterNotifier(Notifier{Type: "wecom", Check: requireChannelURL, Send: sendWeCom})
+	RegisterNotifier(Notifier{Type: "feishu", Check: requireChannelURL, Send: sendFeishu})
+	RegisterNotifier(Notifier{Type: "telegram", Check: checkTelegram, Send: sendTelegram})
+	RegisterNotifier(Notifier{Type: "email", Check: checkEmail, Send: sendEmail})
+}
+
+func requireChannelURL(ch *NotifyChannel) error {
+	u, err := url.Parse(ch.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("无效的URL")
+	}
+	return nil
+}
+
+func checkTelegram(ch *NotifyChannel) error {
+	if ch.BotToken == "" || ch.ChatID == "" {
+		return errors.New("必须指定 botToken 和 chatId")
+	}
+	if ch.URL != "" {
+		return requireChannelURL(ch)
+	}
+	return nil
+}
+
+func checkEmail(ch *NotifyChannel) error {
+	if ch.SMTPHost == "" || ch.From == "" || len(ch.To) == 0 {
+		return errors.New("必须指定SMTP服务器、发件人和收件人")
+	}
+	switch ch.SMTPSecurity {
+	case "", "starttls", "tls", "none":
+	default:
+		return errors.New("无效的加密方式")
+	}
+	return nil
+}
+
+// 检查并补全渠道配置
+func (ch *NotifyChannel) normalize() error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return errors.New("渠道名称不能为空")
+	}
+	n, ok := notifiers[ch.Type]
+	if !ok {
+		return errors.New("不支持的渠道类型")
+	}
+	if ch.MinSeverity != "" {
+		if _, ok := alertSeverities[ch.MinSeverity]; !ok {
+			return errors.New("无效的告警级别")
+		}
+	}
+	if ch.RateLimit < 0 {
+		return errors.New("无效的限流设置")
+	}
+	if ch.Template != "" {
+		if _, err := template.New("webhook").Funcs(notifyTemplateFuncs).Parse(ch.Template); err != nil {
+			return fmt.Errorf("模板错误: %v", err)
+		}
+	}
+	return n.Check(ch)
+}
+
+// 路径中形似令牌的部分，如 Slack、Discord、飞书机器人地址中的密钥
+var urlTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,}$`)
+
+// 隐藏地址中的凭据：用户密码、所有查询参数的值和形似令牌的路径
+func maskURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return maskedSecret
+	}
+
+	var b strings.Builder
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.Username())
+		if _, ok := u.User.Password(); ok {
+			b.WriteString(":" + maskedSecret)
+		}
+		b.WriteString("@")
+	}
+	b.WriteString(u.Host)
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, seg := range segments {
+		if urlTokenPattern.MatchString(seg) {
+			segments[i] = maskedSecret
+		}
+	}
+	b.WriteString(strings.Join(segments, "/"))
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			if key, _, ok := strings.Cut(param, "="); ok {
+				params[i] = key + "=" + maskedSecret
+			}
+		}
+		b.WriteString("?" + strings.Join(params, "&"))
+	}
+	if u.Fragment != "" {
+		b.WriteString("#" + maskedSecret)
+	}
+	return b.String()
+}
+
+// 返回隐藏了敏感字段的副本
+func (ch *NotifyChannel) masked() NotifyChannel {
+	c := *ch
+	for _, s := range []*string{&c.Secret, &c.BotToken, &c.Password} {
+		if *s != "" {
+			*s = maskedSecret
+		}
+	}
+	c.URL = maskURL(ch.URL)
+	if len(ch.Headers) > 0 {
+		c.Headers = make(map[string]string, len(ch.Headers))
+		for k := range ch.Headers {
+			c.Headers[k] = maskedSecret
+		}
+	}
+	return c
+}
+
+// 保留未修改（仍为掩码）的敏感字段
+func (ch *NotifyChannel) keepSecrets(old *NotifyChannel) {
+	if ch.Secret == maskedSecret {
+		ch.Secret = old.Secret
+	}
+	if ch.BotToken == maskedSecret {
+		ch.BotToken = old.BotToken
+	}
+	if ch.Password == maskedSecret {
+		ch.Password = old.Password
+	}
+	if ch.URL != "" && ch.URL == maskURL(old.URL) {
+		ch.URL = old.URL
+	}
+	for k, v := range ch.Headers {
+		if v == maskedSecret {
+			ch.Headers[k] = old.Headers[k]
+		}
+	}
+}
+
+func loadNotifyChannels() error {
+	data, err := os.ReadFile(filepath.Join(alertDataDir, "channels.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var channels []*NotifyChannel
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return err
+	}
+
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+	notifyChannels = channels
+	return nil
+}
+
+// 调用方需持有 notifyMutex；渠道配置包含密钥，只允许面板进程读取
+func saveNotifyChannels() error {
+	if err := os.MkdirAll(alertDataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(notifyChannels, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(alertDataDir, "channels.json"), data, 0600)
+}
+
+var severityLabels = map[string]string{
+	"info":     "提示",
+	"warning":  "警告",
+	"critical": "严重",
+}
+
+// 由告警事件生成通知消息
+func alertNotification(e *AlertEvent) *Notification {
+	label := severityLabels[e.Severity]
+	if e.State == alertStateResolved {
+		label = "已恢复"
+	}
+	hostname, _ := os.Hostname()
+	return &Notification{
+		Title:    fmt.Sprintf("[%s] %s", label, e.RuleName),
+		Text:     fmt.Sprintf("%s\n主机: %s\n序列: %s\n时间: %s", e.Message, hostname, e.Series, e.Time.Format("2006-01-02 15:04:05")),
+		Severity: e.Severity,
+		State:    e.State,
+		Time:     e.Time,
+		Event:    e,
+	}
+}
+
+// 检查渠道是否接收该事件
+func (ch *NotifyChannel) accepts(e *AlertEvent) bool {
+	if !ch.Enabled || e.Silenced {
+		return false
+	}
+	if e.State == alertStateResolved && !ch.SendResolved {
+		return false
+	}
+	return ch.MinSeverity == "" || alertSeverities[e.Severity] >= alertSeverities[ch.MinSeverity]
+}
+
+// 按每分钟发送数限流，调用方需持有 notifyMutex
+func allowChannelSend(ch *NotifyChannel, now time.Time) bool {
+	limit := ch.RateLimit
+	if limit == 0 {
+		limit = defaultNotifyRateLimit
+	}
+	times := channelSendTimes[ch.ID]
+	kept := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < time.Minute {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= limit {
+		channelSendTimes[ch.ID] = kept
+		return false
+	}
+	channelSendTimes[ch.ID] = append(kept, now)
+	return true
+}
+
+func updateChannelStatus(id string, err error) {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+
+	status := channelStatus[id]
+	if status == nil {
+		status = &ChannelStatus{}
+		channelStatus[id] = status
+	}
+	now := time.Now()
+	if err != nil {
+		status.Failed++
+		status.LastError = err.Error()
+		status.LastErrorAt = &now
+	} else {
+		status.Sent++
+		status.LastSentAt = &now
+	}
+}
+
+// 发送失败时按指数退避重试
+func sendWithRetry(ch NotifyChannel, n *Notification) {
+	notifier := notifiers[ch.Type]
+	delay := notifyRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= notifyMaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		err = notifier.Send(ctx, &ch, n)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt < notifyMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	if err != nil {
+		slog.Warn("发送通知失败", "channel", ch.Name, "error", err)
+	}
+	updateChannelStatus(ch.ID, err)
+}
+
+// 将告警事件发送到所有匹配的渠道，由告警引擎调用
+func dispatchAlertNotifications(events []AlertEvent) {
+	now := time.Now()
+
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+
+	for i := range events {
+		e := &events[i]
+		for _, ch := range notifyChannels {
+			if !ch.accepts(e) {
+				continue
+			}
+			if !allowChannelSend(ch, now) {
+				channelDropped[ch.ID]++
+				status := channelStatus[ch.ID]
+				if status == nil {
+					status = &ChannelStatus{}
+					channelStatus[ch.ID] = status
+				}
+				status.Throttled++
+				continue
+			}
+
+			n := alertNotification(e)
+			if dropped := channelDropped[ch.ID]; dropped > 0 {
+				n.Text += fmt.Sprintf("\n（另有 %d 条通知因限流未发送）", dropped)
+				delete(channelDropped, ch.ID)
+			}
+			go sendWithRetry(*ch, n)
+		}
+	}
+}
+
+// 发送 JSON 请求，返回响应内容；非 2xx 状态视为失败
+func postNotifyJSON(ctx context.Context, target string, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// 模板中可用的函数，json 用于输出转义后的字符串
+var notifyTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func sendWebhook(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	var body []byte
+	if ch.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(notifyTemplateFuncs).Parse(ch.Template)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, n); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	} else {
+		var err error
+		if body, err = json.Marshal(n); err != nil {
+			return err
+		}
+	}
+	_, err := postNotifyJSON(ctx, ch.URL, ch.Headers, body)
+	return err
+}
+
+// 机器人接口出错时仍返回 200，需要检查返回的错误码
+func checkBotResponse(data []byte) error {
+	var resp struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil
+	}
+	if resp.ErrCode != nil && *resp.ErrCode != 0 {
+		return fmt.Errorf("错误码 %d: %s", *resp.ErrCode, resp.ErrMsg)
+	}
+	if resp.Code != nil && *resp.Code != 0 {
+		return fmt.Errorf("错误码 %d: %s", *resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+func hmacSHA256Base64(key, message string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sendDingTalk(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	target := ch.URL
+	if ch.Secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := hmacSHA256Base64(ch.Secret, ts+"\n"+ch.Secret)
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+	}
+
+	body, _ := json.Marshal(gin.H{
+		"msgtype": "markdown",
+		"markdown": gin.H{
+			"title": n.Title,
+			"text":  "### " + n.Title + "\n\n" + strings.ReplaceAll(n.Text, "\n", "\n\n"),
+		},
+	})
+	data, err := postNotifyJSON(ctx, target, nil, body)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(data)
+}
+
+func sendWeCom(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	body, _ := json.Marshal(gin.H{
+		"msgtype": "markdown",
+		"markdown": gin.H{
+			"content": "**" + n.Title + "**\n" + n.Text,
+		},
+	})
+	data, err := postNotifyJSON(ctx, ch.URL, nil, body)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(data)
+}
+
+func sendFeishu(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	payload := gin.H{
+		"msg_type": "text",
+		"content":  gin.H{"text": n.Title + "\n" + n.Text},
+	}
+	if ch.Secret != "" {
+		// 飞书以 timestamp+"\n"+密钥 作为 HMAC 的密钥，对空字符串签名
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = ts
+		payload["sign"] = hmacSHA256Base64(ts+"\n"+ch.Secret, "")
+	}
+	body, _ := json.Marshal(payload)
+	data, err := postNotifyJSON(ctx, ch.URL, nil, body)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(data)
+}
+
+func sendTelegram(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	base := strings.TrimRight(ch.URL, "/")
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+	body, _ := json.Marshal(gin.H{
+		"chat_id": ch.ChatID,
+		"text":    n.Title + "\n" + n.Text,
+	})
+	data, err := postNotifyJSON(ctx, base+"/bot"+ch.BotToken+"/sendMessage", nil, body)
+	if err != nil {
+		// 错误信息中的地址包含 token
+		return errors.New(strings.ReplaceAll(err.Error(), ch.BotToken, maskedSecret))
+	}
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(data, &resp) == nil && !resp.OK {
+		return fmt.Errorf("发送失败: %s", resp.Description)
+	}
+	return nil
+}
+
+// 构造邮件内容，标题按 RFC 2047 编码，正文使用 base64
+func buildEmailMessage(ch *NotifyChannel, n *Notification) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + ch.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(ch.To, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", n.Title) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(n.Text))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+func sendEmail(ctx context.Context, ch *NotifyChannel, n *Notification) error {
+	port := ch.SMTPPort
+	if port == 0 {
+		port = 25
+		if ch.SMTPSecurity == "tls" {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(ch.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: ch.SMTPHost}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if ch.SMTPSecurity == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, ch.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ch.SMTPSecurity == "" || ch.SMTPSecurity == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if ch.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", ch.Username, ch.Password, ch.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(ch.From); err != nil {
+		return err
+	}
+	for _, to := range ch.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildEmailMessage(ch, n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 处理通知渠道列表请求，敏感字段以掩码返回
+func HandleNotifyChannelsList(c *gin.Context) {
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+
+	type channelWithStatus struct {
+		NotifyChannel
+		Status ChannelStatus `json:"status"`
+	}
+	channels := make([]channelWithStatus, 0, len(notifyChannels))
+	for _, ch := range notifyChannels {
+		item := channelWithStatus{NotifyChannel: ch.masked()}
+		if status := channelStatus[ch.ID]; status != nil {
+			item.Status = *status
+		}
+		channels = append(channels, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// 处理通知渠道保存请求，ID 为空时新建；敏感字段仍为掩码时保留原值
+func HandleNotifyChannelSave(c *gin.Context) {
+	var ch NotifyChannel
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+
+	index := -1
+	if ch.ID != "" {
+		for i, old := range notifyChannels {
+			if old.ID == ch.ID {
+				index = i
+				ch.keepSecrets(old)
+				break
+			}
+		}
+		if index < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+			return
+		}
+	}
+	if err := ch.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if index < 0 {
+		ch.ID = strconv.FormatInt(time.Now().UnixNano(), 10)
+		notifyChannels = append(notifyChannels, &ch)
+	} else {
+		notifyChannels[index] = &ch
+	}
+	if err := saveNotifyChannels(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存通知渠道失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "通知渠道已保存", "channel": ch.masked()})
+}
+
+// 处理通知渠道删除请求
+func HandleNotifyChannelDelete(c *gin.Context) {
+	id := c.Query("id")
+
+	notifyMutex.Lock()
+	defer notifyMutex.Unlock()
+
+	for i, ch := range notifyChannels {
+		if ch.ID != id {
+			continue
+		}
+		notifyChannels = append(notifyChannels[:i], notifyChannels[i+1:]...)
+		delete(channelStatus, id)
+		delete(channelSendTimes, id)
+		delete(channelDropped, id)
+		if err := saveNotifyChannels(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存通知渠道失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "通知渠道已删除"})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+}
+
+// 处理发送测试消息请求
+//
+// 请求体为渠道配置，可以测试尚未保存的渠道；带 ID 时未修改的敏感字段使用已保存的值。
+// 测试消息只发送一次，不重试也不计入限流，直接返回发送结果。
+func HandleNotifyChannelTest(c *gin.Context) {
+	var ch NotifyChannel
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	notifyMutex.Lock()
+	for _, old := range notifyChannels {
+		if ch.ID != "" && old.ID == ch.ID {
+			ch.keepSecrets(old)
+			break
+		}
+	}
+	notifyMutex.Unlock()
+
+	if err := ch.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	n := &Notification{
+		Title:    "[测试] 面板通知测试",
+		Text:     fmt.Sprintf("这是一条来自 %s 的测试消息，收到说明通知渠道「%s」配置正确。", hostname, ch.Name),
+		Severity: "info",
+		State:    alertStateFiring,
+		Time:     time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), notifyTimeout)
+	defer cancel()
+	if err := notifiers[ch.Type].Send(ctx, &ch, n); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "发送失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "测试消息已发送"})
+}
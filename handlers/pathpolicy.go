@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"gegecp/config"
+	"path/filepath"
+	"strings"
+)
+
+// 判断 path 是否等于 base 或位于 base 之下
+func isSubPath(path, base string) bool {
+	base = filepath.Clean(base)
+	if base == "/" {
+		return true
+	}
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+// 检查路径是否被禁止访问
+func isPathForbidden(path string) bool {
+	path = filepath.Clean(path)
+	for _, forbidden := range config.GlobalConfig.System.ForbiddenPaths {
+		if forbidden != "" && isSubPath(path, forbidden) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析路径中的符号链接，路径不存在时解析已存在的最长前缀
+func resolvePath(path string) string {
+	path = filepath.Clean(path)
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if dir == "/" {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// 根据配置的允许/禁止目录检查路径，未配置允许目录时不做限制。
+// 路径中的符号链接会先解析，避免通过允许目录中的链接访问其他位置
+func checkPathPolicy(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("必须使用绝对路径: %s", path)
+	}
+	path = filepath.Clean(path)
+	resolved := resolvePath(path)
+
+	if isPathForbidden(path) || isPathForbidden(resolved) {
+		return fmt.Errorf("该路径在配置 system.forbidden_paths 中被禁止访问: %s", path)
+	}
+
+	allowed := config.GlobalConfig.System.AllowedPaths
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, base := range allowed {
+		if base != "" && (isSubPath(resolved, base) || isSubPath(resolved, resolvePath(base))) {
+			return nil
+		}
+	}
+	return fmt.Errorf("路径不在允许访问的目录中，可在配置 system.allowed_paths 中添加: %s", path)
+}
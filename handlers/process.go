@@ -2,62 +2,668 @@ package handlers
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/shirou/gopsutil/net"
 	"github.com/shirou/gopsutil/process"
 )
 
+const (
+	defaultProcessPageSize = 500
+	maxProcessPageSize     = 5000
+	// 进程详情中最多列出的文件描述符数
+	maxProcessFDs = 1000
+)
+
+// ProcessInfo 进程列表中的一项
+type ProcessInfo struct {
+	Pid           int32   `json:"pid"`
+	PPid          int32   `json:"ppid"`
+	Name          string  `json:"name"`
+	User          string  `json:"user"`
+	Cmdline       string  `json:"cmdline"`
+	Status        string  `json:"status"`
+	CPU           float64 `json:"cpu"`
+	Memory        uint64  `json:"memory"` // 常驻内存（RSS）
+	MemoryPercent float64 `json:"memoryPercent"`
+	Threads       int32   `json:"threads"`
+	Nice          int32   `json:"nice"`
+	StartTime     int64   `json:"startTime"` // Unix 毫秒
+}
+
+// 进程状态字符对应的名称，见 proc(5)
+var processStatusNames = map[string]string{
+	"R": "running",
+	"S": "sleeping",
+	"D": "disk-sleep",
+	"T": "stopped",
+	"t": "tracing-stop",
+	"Z": "zombie",
+	"X": "dead",
+	"I": "idle",
+	"W": "paging",
+	"P": "parked",
+}
+
+// 用户态时钟频率（USER_HZ），Linux 上固定为100
+const clockTicksPerSec = 100
+
+// 进程累计的CPU时间和启动时间（时钟数），启动时间用于识别PID复用
+type processCPUTimes struct {
+	ticks uint64
+	start uint64
+}
+
+// 进程CPU采样器，由采集器定期调用，根据两次采样之间的CPU时间差计算使用率
+//
+// 使用率与 top 一致，100% 表示占满一个逻辑CPU。
+type processSampler struct {
+	mu       sync.Mutex
+	last     map[int32]processCPUTimes
+	lastTime time.Time
+	percent  map[int32]float64
+}
+
+var processStatsSampler = &processSampler{}
+
+// 读取 /proc/<pid>/stat 中的 utime+stime 和 starttime
+func readProcessCPUTimes(pid int32) (processCPUTimes, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return processCPUTimes{}, false
+	}
+	s := string(data)
+	if i := strings.LastIndexByte(s, ')'); i >= 0 {
+		s = s[i+1:]
+	}
+	fields := strings.Fields(s)
+	// utime、stime、starttime 分别是 stat 的第14、15、22列
+	if len(fields) < 20 {
+		return processCPUTimes{}, false
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	return processCPUTimes{ticks: utime + stime, start: start}, true
+}
+
+// 采样所有进程的CPU时间
+func (s *processSampler) sample() {
+	pids, err := process.Pids()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	current := make(map[int32]processCPUTimes, len(pids))
+	for _, pid := range pids {
+		if times, ok := readProcessCPUTimes(pid); ok {
+			current[pid] = times
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	percent := make(map[int32]float64, len(current))
+	if elapsed := now.Sub(s.lastTime).Seconds(); !s.lastTime.IsZero() && elapsed > 0 {
+		for pid, cur := range current {
+			prev, ok := s.last[pid]
+			if !ok || prev.start != cur.start || cur.ticks < prev.ticks {
+				continue
+			}
+			percent[pid] = float64(cur.ticks-prev.ticks) / clockTicksPerSec / elapsed * 100
+		}
+	}
+	s.last = current
+	s.lastTime = now
+	s.percent = percent
+}
+
+// 返回进程在最近一个采样周期内的CPU使用率，新启动的进程返回0
+func (s *processSampler) cpuPercent(pid int32) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.percent[pid]
+}
+
+// 读取进程的基本信息，进程已退出时返回 false
+func newProcessInfo(p *process.Process, memTotal uint64) (ProcessInfo, bool) {
+	name, err := p.Name()
+	if err != nil {
+		return ProcessInfo{}, false
+	}
+	info := ProcessInfo{Pid: p.Pid, Name: name}
+
+	info.PPid, _ = p.Ppid()
+	if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+		info.User = lookupUserName(uint32(uids[0]))
+	}
+	if status, err := p.Status(); err == nil {
+		info.Status = processStatusNames[status]
+		if info.Status == "" {
+			info.Status = status
+		}
+	}
+	if cmdline, err := p.Cmdline(); err == nil && cmdline != "" {
+		info.Cmdline = cmdline
+	} else {
+		// 内核线程没有命令行
+		info.Cmdline = "[" + name + "]"
+	}
+	// gopsutil 的 CPUPercent 是进程启动以来的平均值，改用采样器的最近值
+	info.CPU = processStatsSampler.cpuPercent(p.Pid)
+	// 读取失败时（如进程刚退出或权限不足）内存记为0
+	if memory, err := p.MemoryInfo(); err == nil && memory != nil {
+		info.Memory = memory.RSS
+		if memTotal > 0 {
+			info.MemoryPercent = float64(memory.RSS) / float64(memTotal) * 100
+		}
+	}
+	info.Threads, _ = p.NumThreads()
+	_, info.Nice = readProcessSched(p.Pid)
+	info.StartTime, _ = p.CreateTime()
+	return info, true
+}
+
+// 读取所有进程的基本信息
+func listProcessInfos() ([]ProcessInfo, error) {
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	var memTotal uint64
+	if vm, err := mem.VirtualMemory(); err == nil {
+		memTotal = vm.Total
+	}
+
+	infos := make([]ProcessInfo, 0, len(processes))
+	for _, p := range processes {
+		if info, ok := newProcessInfo(p, memTotal); ok {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// 按指定字段排序进程列表，相同时按PID排序
+func sortProcessInfos(infos []ProcessInfo, sortBy string, desc bool) {
+	less := func(a, b *ProcessInfo) bool {
+		switch sortBy {
+		case "name":
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case "user":
+			if a.User != b.User {
+				return a.User < b.User
+			}
+		case "cpu":
+			if a.CPU != b.CPU {
+				return a.CPU < b.CPU
+			}
+		case "memory":
+			if a.Memory != b.Memory {
+				return a.Memory < b.Memory
+			}
+		case "threads":
+			if a.Threads != b.Threads {
+				return a.Threads < b.Threads
+			}
+		case "start":
+			if a.StartTime != b.StartTime {
+				return a.StartTime < b.StartTime
+			}
+		}
+		return a.Pid < b.Pid
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if desc {
+			return less(&infos[j], &infos[i])
+		}
+		return less(&infos[i], &infos[j])
+	})
+}
+
 // 处理进程列表请求
+//
+// 参数：q 按名称、命令行或PID过滤，user、status 精确过滤；
+// sort 可选 pid/name/user/cpu/memory/threads/start，默认按CPU倒序；page/pageSize 分页。
 func HandleProcessList(c *gin.Context) {
-	processes, err := process.Processes()
+	infos, err := listProcessInfos()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var processList []gin.H
-	for _, p := range processes {
-		name, err := p.Name()
-		if err != nil {
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	userFilter, statusFilter := c.Query("user"), c.Query("status")
+	filtered := infos[:0]
+	for _, info := range infos {
+		if userFilter != "" && info.User != userFilter {
+			continue
+		}
+		if statusFilter != "" && info.Status != statusFilter {
+			continue
+		}
+		if query != "" && strconv.Itoa(int(info.Pid)) != query &&
+			!strings.Contains(strings.ToLower(info.Name), query) &&
+			!strings.Contains(strings.ToLower(info.Cmdline), query) {
 			continue
 		}
+		filtered = append(filtered, info)
+	}
+
+	sortBy := c.DefaultQuery("sort", "cpu")
+	order := c.Query("order")
+	if order == "" && (sortBy == "cpu" || sortBy == "memory") {
+		order = "desc"
+	}
+	sortProcessInfos(filtered, sortBy, order == "desc")
 
-		cpu, _ := p.CPUPercent()
-		memory, _ := p.MemoryInfo()
-		status, _ := p.Status()
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultProcessPageSize)))
+	if pageSize < 1 || pageSize > maxProcessPageSize {
+		pageSize = defaultProcessPageSize
+	}
+
+	total := len(filtered)
+	start, end := pageRange(page, pageSize, total)
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":    filtered[start:end],
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
 
-		processList = append(processList, gin.H{
-			"pid":    p.Pid,
-			"name":   name,
-			"cpu":    cpu,
-			"memory": memory.RSS,
-			"status": status,
+// ProcessTreeNode 进程树中的节点，Total* 为包括所有子孙进程在内的合计
+type ProcessTreeNode struct {
+	ProcessInfo
+	TotalCPU    float64            `json:"totalCpu"`
+	TotalMemory uint64             `json:"totalMemory"`
+	Descendants int                `json:"descendants"`
+	Children    []*ProcessTreeNode `json:"children"`
+}
+
+// 按父子关系组织进程，父进程不存在的作为根节点
+func buildProcessTree(infos []ProcessInfo) []*ProcessTreeNode {
+	nodes := make(map[int32]*ProcessTreeNode, len(infos))
+	for _, info := range infos {
+		nodes[info.Pid] = &ProcessTreeNode{ProcessInfo: info, Children: []*ProcessTreeNode{}}
+	}
+
+	var roots []*ProcessTreeNode
+	for _, info := range infos {
+		node := nodes[info.Pid]
+		if parent, ok := nodes[info.PPid]; ok && info.PPid != info.Pid {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	var total func(n *ProcessTreeNode)
+	total = func(n *ProcessTreeNode) {
+		n.TotalCPU = n.CPU
+		n.TotalMemory = n.Memory
+		for _, child := range n.Children {
+			total(child)
+			n.TotalCPU += child.TotalCPU
+			n.TotalMemory += child.TotalMemory
+			n.Descendants += child.Descendants + 1
+		}
+	}
+	for _, root := range roots {
+		total(root)
+	}
+	return roots
+}
+
+// 按子树合计值或PID递归排序
+func sortProcessTree(nodes []*ProcessTreeNode, sortBy string) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		switch sortBy {
+		case "cpu":
+			if a.TotalCPU != b.TotalCPU {
+				return a.TotalCPU > b.TotalCPU
+			}
+		case "memory":
+			if a.TotalMemory != b.TotalMemory {
+				return a.TotalMemory > b.TotalMemory
+			}
+		}
+		return a.Pid < b.Pid
+	})
+	for _, n := range nodes {
+		sortProcessTree(n.Children, sortBy)
+	}
+}
+
+// 只保留匹配的节点及其祖先
+func filterProcessTree(nodes []*ProcessTreeNode, match func(*ProcessInfo) bool) []*ProcessTreeNode {
+	kept := []*ProcessTreeNode{}
+	for _, n := range nodes {
+		n.Children = filterProcessTree(n.Children, match)
+		if len(n.Children) > 0 || match(&n.ProcessInfo) {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// 处理进程树请求
+//
+// 参数：pid 只返回以该进程为根的子树；q 按名称或命令行过滤，保留匹配进程的祖先；
+// hideKernel=true 隐藏内核线程；sort 可选 pid/cpu/memory，按子树合计值排序。
+// 合计值在过滤之前计算，始终包含全部子孙进程。
+func HandleProcessTree(c *gin.Context) {
+	infos, err := listProcessInfos()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("hideKernel") == "true" {
+		// 内核线程都是 kthreadd（PID 2）的子进程
+		kept := infos[:0]
+		for _, info := range infos {
+			if info.Pid != 2 && info.PPid != 2 {
+				kept = append(kept, info)
+			}
+		}
+		infos = kept
+	}
+
+	roots := buildProcessTree(infos)
+
+	if v := c.Query("pid"); v != "" {
+		pid, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的进程ID"})
+			return
+		}
+		var find func(nodes []*ProcessTreeNode) *ProcessTreeNode
+		find = func(nodes []*ProcessTreeNode) *ProcessTreeNode {
+			for _, n := range nodes {
+				if n.Pid == int32(pid) {
+					return n
+				}
+				if found := find(n.Children); found != nil {
+					return found
+				}
+			}
+			return nil
+		}
+		root := find(roots)
+		if root == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "进程不存在"})
+			return
+		}
+		roots = []*ProcessTreeNode{root}
+	}
+
+	if query := strings.ToLower(strings.TrimSpace(c.Query("q"))); query != "" {
+		roots = filterProcessTree(roots, func(info *ProcessInfo) bool {
+			return strings.Contains(strings.ToLower(info.Name), query) ||
+				strings.Contains(strings.ToLower(info.Cmdline), query)
 		})
 	}
 
-	c.JSON(http.StatusOK, processList)
+	sortProcessTree(roots, c.DefaultQuery("sort", "pid"))
+	c.JSON(http.StatusOK, gin.H{"roots": roots, "total": len(infos)})
+}
+
+// ProcessFD 进程打开的文件描述符
+type ProcessFD struct {
+	FD     int    `json:"fd"`
+	Type   string `json:"type"` // file, socket, pipe, anon, device
+	Target string `json:"target"`
 }
 
-// 处理进程终止请求
-func HandleProcessKill(c *gin.Context) {
-	pidStr := c.PostForm("pid")
-	pid, err := strconv.Atoi(pidStr)
+// ProcessRef 父进程或子进程
+type ProcessRef struct {
+	Pid  int32  `json:"pid"`
+	Name string `json:"name"`
+}
+
+// ProcessDetail 进程详情
+type ProcessDetail struct {
+	ProcessInfo
+	Args          []string          `json:"args"`
+	Exe           string            `json:"exe"`
+	Cwd           string            `json:"cwd"`
+	Uids          []int32           `json:"uids"` // 实际、有效、保存、文件系统 uid
+	Gids          []int32           `json:"gids"`
+	Terminal      string            `json:"terminal"`
+	Priority      int32             `json:"priority"`
+	Parent        *ProcessRef       `json:"parent,omitempty"`
+	Children      []ProcessRef      `json:"children"`
+	VMS           uint64            `json:"vms"`
+	Swap          uint64            `json:"swap"`
+	ReadBytes     uint64            `json:"readBytes"`
+	WriteBytes    uint64            `json:"writeBytes"`
+	FDCount       int               `json:"fdCount"`
+	FDs           []ProcessFD       `json:"fds"`
+	Listening     []ListeningSocket `json:"listening"`
+	Connections   int               `json:"connections"` // 已建立的连接数
+	Cgroups       []string          `json:"cgroups"`
+	Unit          string            `json:"unit,omitempty"` // 所属的 systemd 单元
+	Environ       []string          `json:"environ"`
+	EnvRedacted   bool              `json:"envRedacted"`
+	EnvUnreadable bool              `json:"envUnreadable,omitempty"`
+}
+
+// 值可能是密钥的环境变量
+var sensitiveEnvPattern = regexp.MustCompile(`(?i)(pass|secret|token|key|credential|auth)`)
+
+// 读取 /proc/<pid>/stat 中的调度优先级和 nice 值
+//
+// gopsutil 的 Nice() 返回的实际是优先级字段，这里直接解析。
+func readProcessSched(pid int32) (priority, nice int32) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "stat"))
 	if err != nil {
+		return 0, 0
+	}
+	// 进程名可能包含空格和括号，从最后一个右括号之后开始解析
+	s := string(data)
+	if i := strings.LastIndexByte(s, ')'); i >= 0 {
+		s = s[i+1:]
+	}
+	fields := strings.Fields(s)
+	// 右括号后第一个字段是状态（stat 第3列），priority 和 nice 是第18、19列
+	if len(fields) > 16 {
+		p, _ := strconv.Atoi(fields[15])
+		n, _ := strconv.Atoi(fields[16])
+		return int32(p), int32(n)
+	}
+	return 0, 0
+}
+
+// 读取进程打开的文件描述符
+func readProcessFDs(pid int32) (int, []ProcessFD) {
+	dir := filepath.Join("/proc", strconv.Itoa(int(pid)), "fd")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, []ProcessFD{}
+	}
+
+	fds := []ProcessFD{}
+	for _, e := range entries {
+		if len(fds) >= maxProcessFDs {
+			break
+		}
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		typ := "file"
+		switch {
+		case strings.HasPrefix(target, "socket:"):
+			typ = "socket"
+		case strings.HasPrefix(target, "pipe:"):
+			typ = "pipe"
+		case strings.HasPrefix(target, "anon_inode:"):
+			typ = "anon"
+		case strings.HasPrefix(target, "/dev/"):
+			typ = "device"
+		}
+		fds = append(fds, ProcessFD{FD: fd, Type: typ, Target: target})
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return len(entries), fds
+}
+
+// 读取进程的 cgroup，并从路径中识别 systemd 单元
+func readProcessCgroups(pid int32) ([]string, string) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return []string{}, ""
+	}
+
+	cgroups := []string{}
+	unit := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		cgroups = append(cgroups, line)
+		// 格式为 层级ID:控制器:路径，cgroup v2 为 0::/system.slice/nginx.service
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || unit != "" {
+			continue
+		}
+		for _, elem := range strings.Split(parts[2], "/") {
+			if strings.HasSuffix(elem, ".service") || strings.HasSuffix(elem, ".scope") {
+				unit = elem
+			}
+		}
+	}
+	return cgroups, unit
+}
+
+// 处理进程详情请求
+//
+// 环境变量中疑似密钥的值默认隐藏，参数 reveal=true 时返回原值。
+func HandleProcessDetail(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Query("pid"))
+	if err != nil || pid <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的进程ID"})
 		return
 	}
 
-	proc, err := process.NewProcess(int32(pid))
+	p, err := process.NewProcess(int32(pid))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, gin.H{"error": "进程不存在"})
 		return
 	}
 
-	if err := proc.Kill(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var memTotal uint64
+	if vm, err := mem.VirtualMemory(); err == nil {
+		memTotal = vm.Total
+	}
+	info, ok := newProcessInfo(p, memTotal)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "进程不存在"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "进程已终止"})
+	detail := ProcessDetail{
+		ProcessInfo: info,
+		Args:        []string{},
+		Children:    []ProcessRef{},
+		Listening:   []ListeningSocket{},
+		Environ:     []string{},
+	}
+	if args, err := p.CmdlineSlice(); err == nil {
+		detail.Args = args
+	}
+	detail.Priority, _ = readProcessSched(p.Pid)
+	detail.Exe, _ = p.Exe()
+	detail.Cwd, _ = p.Cwd()
+	detail.Uids, _ = p.Uids()
+	detail.Gids, _ = p.Gids()
+	detail.Terminal, _ = p.Terminal()
+
+	if info.PPid > 0 {
+		if parent, err := process.NewProcess(info.PPid); err == nil {
+			name, _ := parent.Name()
+			detail.Parent = &ProcessRef{Pid: info.PPid, Name: name}
+		}
+	}
+	if children, err := p.Children(); err == nil {
+		for _, child := range children {
+			name, _ := child.Name()
+			detail.Children = append(detail.Children, ProcessRef{Pid: child.Pid, Name: name})
+		}
+	}
+
+	if memory, err := p.MemoryInfo(); err == nil && memory != nil {
+		detail.VMS = memory.VMS
+		detail.Swap = memory.Swap
+	}
+	if io, err := p.IOCounters(); err == nil && io != nil {
+		detail.ReadBytes = io.ReadBytes
+		detail.WriteBytes = io.WriteBytes
+	}
+
+	detail.FDCount, detail.FDs = readProcessFDs(p.Pid)
+	detail.Cgroups, detail.Unit = readProcessCgroups(p.Pid)
+
+	if conns, err := net.ConnectionsPid("inet", p.Pid); err == nil {
+		for _, conn := range conns {
+			if conn.Status == "LISTEN" || isUDPListener(conn) {
+				detail.Listening = append(detail.Listening, ListeningSocket{
+					Protocol: socketProtocol(conn),
+					Address:  conn.Laddr.IP,
+					Port:     conn.Laddr.Port,
+					Pid:      p.Pid,
+					Process:  info.Name,
+					User:     info.User,
+				})
+			} else if conn.Status == "ESTABLISHED" {
+				detail.Connections++
+			}
+		}
+	}
+
+	reveal := c.Query("reveal") == "true"
+	if env, err := p.Environ(); err == nil {
+		for _, kv := range env {
+			if kv == "" {
+				continue
+			}
+			if !reveal {
+				if key, _, ok := strings.Cut(kv, "="); ok && sensitiveEnvPattern.MatchString(key) {
+					kv = key + "=" + maskedSecret
+					detail.EnvRedacted = true
+				}
+			}
+			detail.Environ = append(detail.Environ, kv)
+		}
+	} else {
+		detail.EnvUnreadable = true
+	}
+
+	c.JSON(http.StatusOK, detail)
 }
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"gegecp/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// 发送信号后等待进程退出的最长时间
+	maxEscalateAfter = 60 * time.Second
+	// 等待进程退出时的检查间隔
+	processExitPollInterval = 200 * time.Millisecond
+)
+
+// 允许发送的信号
+var processSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// 始终受保护的进程名
+var builtinProtectedProcesses = []string{"init", "systemd", "sshd"}
+
+// ProcessTarget 操作的目标进程
+type ProcessTarget struct {
+	Pid       int32  `json:"pid"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	Cmdline   string `json:"cmdline"`
+	Protected string `json:"protected,omitempty"` // 受保护的原因
+	start     uint64
+}
+
+// SignalResult 单个进程的信号发送结果
+type SignalResult struct {
+	Pid       int32  `json:"pid"`
+	Signal    string `json:"signal"`
+	Error     string `json:"error,omitempty"`
+	Exited    bool   `json:"exited"`
+	Escalated bool   `json:"escalated,omitempty"` // 超时未退出，已发送 KILL
+}
+
+// 检查进程是否受保护，返回原因
+func processProtectedReason(info *ProcessInfo) string {
+	switch {
+	case info.Pid == 1:
+		return "init 进程"
+	case info.Pid == 2 || info.PPid == 2:
+		return "内核线程"
+	case info.Pid == int32(os.Getpid()):
+		return "面板自身"
+	}
+	for _, name := range builtinProtectedProcesses {
+		if info.Name == name {
+			return "系统关键进程"
+		}
+	}
+	for _, pattern := range config.GlobalConfig.System.ProtectedProcesses {
+		if ok, _ := filepath.Match(pattern, info.Name); ok {
+			return "配置为受保护的进程"
+		}
+	}
+	return ""
+}
+
+// 进程仍在运行（且没有被复用PID）
+func processAlive(t *ProcessTarget) bool {
+	times, ok := readProcessCPUTimes(t.Pid)
+	if !ok || times.start != t.start {
+		return false
+	}
+	// 僵尸进程已经退出，只是还未被回收
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(t.Pid)), "stat"))
+	if err != nil {
+		return false
+	}
+	s := string(data)
+	i := strings.LastIndexByte(s, ')')
+	return !(i >= 0 && i+2 < len(s) && s[i+2] == 'Z')
+}
+
+// 根据范围确定目标进程：process 单个进程，group 同一进程组，tree 进程及其所有子孙进程
+func resolveProcessTargets(pid int32, scope string) ([]*ProcessTarget, error) {
+	infos, err := listProcessInfos()
+	if err != nil {
+		return nil, err
+	}
+	byPid := make(map[int32]*ProcessInfo, len(infos))
+	for i := range infos {
+		byPid[infos[i].Pid] = &infos[i]
+	}
+	if _, ok := byPid[pid]; !ok {
+		return nil, errProcessNotFound
+	}
+
+	var pids []int32
+	switch scope {
+	case "", "process":
+		pids = []int32{pid}
+	case "group":
+		pgid, err := syscall.Getpgid(int(pid))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if g, err := syscall.Getpgid(int(info.Pid)); err == nil && g == pgid {
+				pids = append(pids, info.Pid)
+			}
+		}
+	case "tree":
+		children := make(map[int32][]int32)
+		for _, info := range infos {
+			children[info.PPid] = append(children[info.PPid], info.Pid)
+		}
+		// 子孙进程在前，先终止子进程可以避免它们被重新挂到 init 下
+		var walk func(p int32)
+		walk = func(p int32) {
+			for _, child := range children[p] {
+				if child != p {
+					walk(child)
+				}
+			}
+			pids = append(pids, p)
+		}
+		walk(pid)
+	default:
+		return nil, errors.New("无效的范围")
+	}
+
+	targets := make([]*ProcessTarget, 0, len(pids))
+	for _, p := range pids {
+		info := byPid[p]
+		times, ok := readProcessCPUTimes(p)
+		if !ok {
+			continue
+		}
+		targets = append(targets, &ProcessTarget{
+			Pid:       p,
+			Name:      info.Name,
+			User:      info.User,
+			Cmdline:   info.Cmdline,
+			Protected: processProtectedReason(info),
+			start:     times.start,
+		})
+	}
+	return targets, nil
+}
+
+var errProcessNotFound = errors.New("进程不存在")
+
+// 目标中有受保护进程时拒绝整个操作
+func rejectProtectedTargets(c *gin.Context, targets []*ProcessTarget) bool {
+	var protected []*ProcessTarget
+	for _, t := range targets {
+		if t.Protected != "" {
+			protected = append(protected, t)
+		}
+	}
+	if len(protected) == 0 {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     fmt.Sprintf("目标包含 %d 个受保护的进程，操作已拒绝", len(protected)),
+		"protected": protected,
+	})
+	return true
+}
+
+// 解析请求中的目标进程，失败时已写入响应
+func processTargetsFromRequest(c *gin.Context, pid int, scope string) ([]*ProcessTarget, bool) {
+	if pid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的进程ID"})
+		return nil, false
+	}
+	targets, err := resolveProcessTargets(int32(pid), scope)
+	if err == errProcessNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return targets, true
+}
+
+// 处理发送信号请求
+//
+// 请求体：pid；signal 为 TERM/KILL/HUP/INT/QUIT/STOP/CONT/USR1/USR2，默认 TERM；
+// scope 为 process/group/tree；escalateAfter 为秒数，超时仍未退出的进程发送 KILL；
+// dryRun 为 true 时只返回目标进程，用于确认。目标中有受保护进程时拒绝整个操作。
+func HandleProcessKill(c *gin.Context) {
+	var req struct {
+		Pid           int    `json:"pid"`
+		Signal        string `json:"signal"`
+		Scope         string `json:"scope"`
+		EscalateAfter int    `json:"escalateAfter"`
+		DryRun        bool   `json:"dryRun"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if req.Signal == "" {
+		req.Signal = "TERM"
+	}
+	sig, ok := processSignals[req.Signal]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的信号"})
+		return
+	}
+	escalateAfter := time.Duration(req.EscalateAfter) * time.Second
+	if escalateAfter < 0 || escalateAfter > maxEscalateAfter {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "等待时间必须在0到60秒之间"})
+		return
+	}
+
+	targets, ok := processTargetsFromRequest(c, req.Pid, req.Scope)
+	if !ok {
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"targets": targets})
+		return
+	}
+	if rejectProtectedTargets(c, targets) {
+		return
+	}
+
+	results := make([]*SignalResult, len(targets))
+	for i, t := range targets {
+		results[i] = &SignalResult{Pid: t.Pid, Signal: req.Signal}
+		// 发送前确认PID没有被复用
+		if !processAlive(t) {
+			results[i].Exited = true
+			continue
+		}
+		if err := syscall.Kill(int(t.Pid), sig); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	// STOP/CONT 等信号不会让进程退出，不等待
+	terminating := sig == syscall.SIGTERM || sig == syscall.SIGKILL || sig == syscall.SIGINT ||
+		sig == syscall.SIGQUIT || sig == syscall.SIGHUP
+	if terminating {
+		deadline := time.Now().Add(escalateAfter)
+		if sig == syscall.SIGKILL || escalateAfter == 0 {
+			// 短暂等待以报告进程是否已退出
+			deadline = time.Now().Add(time.Second)
+		}
+		for {
+			running := 0
+			for i, t := range targets {
+				if !results[i].Exited && results[i].Error == "" {
+					if processAlive(t) {
+						running++
+					} else {
+						results[i].Exited = true
+					}
+				}
+			}
+			if running == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(processExitPollInterval)
+		}
+
+		if escalateAfter > 0 && sig != syscall.SIGKILL {
+			for i, t := range targets {
+				if results[i].Exited || results[i].Error != "" || !processAlive(t) {
+					continue
+				}
+				if err := syscall.Kill(int(t.Pid), syscall.SIGKILL); err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				results[i].Escalated = true
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("已向 %d 个进程发送 %s 信号", len(targets), req.Signal),
+		"targets": targets,
+		"results": results,
+	})
+}
+
+// 进程的所有线程，Linux 上优先级按线程设置
+func processThreadIDs(pid int32) []int {
+	entries, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(int(pid)), "task"))
+	if err != nil {
+		return []int{int(pid)}
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		if tid, err := strconv.Atoi(e.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	sort.Ints(tids)
+	return tids
+}
+
+// 处理调整进程优先级请求，请求体：pid、nice（-20 到 19）、scope（process/tree）
+func HandleProcessRenice(c *gin.Context) {
+	var req struct {
+		Pid   int    `json:"pid"`
+		Nice  *int   `json:"nice"`
+		Scope string `json:"scope"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Nice == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if *req.Nice < -20 || *req.Nice > 19 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nice 值必须在 -20 到 19 之间"})
+		return
+	}
+	if req.Scope == "group" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的范围"})
+		return
+	}
+
+	targets, ok := processTargetsFromRequest(c, req.Pid, req.Scope)
+	if !ok {
+		return
+	}
+	if rejectProtectedTargets(c, targets) {
+		return
+	}
+
+	errs := make(map[int32]string)
+	for _, t := range targets {
+		for _, tid := range processThreadIDs(t.Pid) {
+			if err := unix.Setpriority(unix.PRIO_PROCESS, tid, *req.Nice); err != nil && err != unix.ESRCH {
+				errs[t.Pid] = err.Error()
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "部分进程调整失败", "errors": errs, "targets": targets})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "优先级已调整", "targets": targets})
+}
+
+// I/O 调度类别，见 ioprio_set(2)
+var ioniceClasses = map[string]int{
+	"none":        0,
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// 处理调整进程I/O优先级请求
+//
+// 请求体：pid；class 为 realtime/best-effort/idle/none；level 为 0（最高）到 7，idle 和 none 忽略；
+// scope 为 process/tree。
+func HandleProcessIonice(c *gin.Context) {
+	var req struct {
+		Pid   int    `json:"pid"`
+		Class string `json:"class"`
+		Level int    `json:"level"`
+		Scope string `json:"scope"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	class, ok := ioniceClasses[req.Class]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的I/O调度类别"})
+		return
+	}
+	if req.Level < 0 || req.Level > 7 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "I/O优先级必须在 0 到 7 之间"})
+		return
+	}
+	if class == 0 || class == 3 {
+		req.Level = 0
+	}
+	if req.Scope == "group" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的范围"})
+		return
+	}
+
+	targets, ok := processTargetsFromRequest(c, req.Pid, req.Scope)
+	if !ok {
+		return
+	}
+	if rejectProtectedTargets(c, targets) {
+		return
+	}
+
+	ioprio := class<<ioprioClassShift | req.Level
+	errs := make(map[int32]string)
+	for _, t := range targets {
+		for _, tid := range processThreadIDs(t.Pid) {
+			_, _, e := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio))
+			if e != 0 && e != unix.ESRCH {
+				errs[t.Pid] = e.Error()
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "部分进程调整失败", "errors": errs, "targets": targets})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "I/O优先级已调整", "targets": targets})
+}
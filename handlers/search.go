@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"gegecp/config"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchMaxResults = 1000
+	maxSearchMaxResults     = 10000
+	defaultSearchTimeout    = 2 * time.Minute
+	// 内容搜索时跳过超过该大小的文件
+	maxGrepFileSize = 20 * 1024 * 1024
+	maxGrepContext  = 10
+	// 单个文件最多返回的匹配行数
+	maxGrepMatchesPerFile = 200
+	// 单行超过该长度时截断显示
+	maxGrepLineLength = 1024
+)
+
+var errSearchLimitReached = errors.New("已达到结果数量上限")
+
+// 搜索条件
+type searchQuery struct {
+	Root           string
+	NameGlob       string
+	NameRegex      *regexp.Regexp
+	Type           string // file, dir, symlink
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	MaxDepth       int
+	IncludeHidden  bool
+	Content        *regexp.Regexp
+	ContextLines   int
+	MaxResults     int
+}
+
+// 内容搜索的匹配行
+type GrepMatch struct {
+	Line    int      `json:"line"`
+	Text    string   `json:"text"`
+	Before  []string `json:"before,omitempty"`
+	After   []string `json:"after,omitempty"`
+	Matches [][]int  `json:"matches,omitempty"` // 匹配在行内的字节区间
+}
+
+// 搜索结果
+type SearchResult struct {
+	FileEntry
+	Matches []GrepMatch `json:"matches,omitempty"`
+}
+
+// 未指定搜索目录时的默认值：配置了允许目录时使用第一个，否则为根目录
+func defaultSearchRoot() string {
+	for _, base := range config.GlobalConfig.System.AllowedPaths {
+		if base != "" {
+			return base
+		}
+	}
+	return "/"
+}
+
+// 解析搜索参数
+func parseSearchQuery(c *gin.Context) (*searchQuery, error) {
+	q := &searchQuery{
+		Root:          c.DefaultQuery("root", defaultSearchRoot()),
+		NameGlob:      c.Query("name"),
+		Type:          c.Query("type"),
+		MaxSize:       -1,
+		MaxDepth:      -1,
+		IncludeHidden: c.DefaultQuery("hidden", "true") != "false",
+		MaxResults:    defaultSearchMaxResults,
+	}
+	q.Root = filepath.Clean(q.Root)
+	if err := checkPathPolicy(q.Root); err != nil {
+		return nil, err
+	}
+
+	if q.NameGlob != "" {
+		if _, err := filepath.Match(q.NameGlob, ""); err != nil {
+			return nil, errors.New("无效的文件名通配符: " + err.Error())
+		}
+	}
+
+	ignoreCase := c.Query("ignoreCase") == "true"
+	if pattern := c.Query("regex"); pattern != "" {
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("无效的文件名正则: " + err.Error())
+		}
+		q.NameRegex = re
+	}
+
+	switch q.Type {
+	case "", "file", "dir", "symlink":
+	default:
+		return nil, errors.New("无效的文件类型: " + q.Type)
+	}
+
+	var err error
+	if v := c.Query("minSize"); v != "" {
+		if q.MinSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, errors.New("无效的最小文件大小")
+		}
+	}
+	if v := c.Query("maxSize"); v != "" {
+		if q.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, errors.New("无效的最大文件大小")
+		}
+	}
+	if v := c.Query("modifiedAfter"); v != "" {
+		if q.ModifiedAfter, err = parseTimeParam(v); err != nil {
+			return nil, errors.New("无效的修改时间下限")
+		}
+	}
+	if v := c.Query("modifiedBefore"); v != "" {
+		if q.ModifiedBefore, err = parseTimeParam(v); err != nil {
+			return nil, errors.New("无效的修改时间上限")
+		}
+	}
+	if v := c.Query("maxDepth"); v != "" {
+		if q.MaxDepth, err = strconv.Atoi(v); err != nil || q.MaxDepth < 1 {
+			return nil, errors.New("无效的搜索深度")
+		}
+	}
+	if v := c.Query("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, errors.New("无效的结果数量上限")
+		}
+		if n > maxSearchMaxResults {
+			n = maxSearchMaxResults
+		}
+		q.MaxResults = n
+	}
+
+	// 内容搜索模式
+	if content := c.Query("content"); content != "" {
+		pattern := content
+		if c.Query("contentRegex") != "true" {
+			pattern = regexp.QuoteMeta(content)
+		}
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("无效的内容正则: " + err.Error())
+		}
+		q.Content = re
+
+		if v := c.Query("context"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, errors.New("无效的上下文行数")
+			}
+			if n > maxGrepContext {
+				n = maxGrepContext
+			}
+			q.ContextLines = n
+		}
+		// 内容搜索只针对普通文件
+		if q.Type == "" {
+			q.Type = "file"
+		}
+	}
+
+	return q, nil
+}
+
+// 解析时间参数，支持 RFC3339 和 Unix 秒
+func parseTimeParam(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// 检查文件元数据是否满足过滤条件
+func (q *searchQuery) matchEntry(entry *FileEntry) bool {
+	switch q.Type {
+	case "file":
+		if !entry.targetRegular || entry.IsSymlink {
+			return false
+		}
+	case "dir":
+		if !entry.IsDir || entry.IsSymlink {
+			return false
+		}
+	case "symlink":
+		if !entry.IsSymlink {
+			return false
+		}
+	}
+
+	if q.NameGlob != "" {
+		if ok, _ := filepath.Match(q.NameGlob, entry.Name); !ok {
+			return false
+		}
+	}
+	if q.NameRegex != nil && !q.NameRegex.MatchString(entry.Name) {
+		return false
+	}
+	if entry.Size < q.MinSize || (q.MaxSize >= 0 && entry.Size > q.MaxSize) {
+		return false
+	}
+	if !q.ModifiedAfter.IsZero() && entry.ModTime.Before(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && entry.ModTime.After(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// 在文本文件中搜索内容，二进制文件直接跳过
+func grepFile(ctx context.Context, path string, re *regexp.Regexp, contextLines int) ([]GrepMatch, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(8000)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+
+	var (
+		matches []GrepMatch
+		before  []string
+		// 仍需要补充后续上下文的匹配
+		pending []int
+		lineNo  int
+	)
+	for {
+		if lineNo%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			break
+		}
+		lineNo++
+		line = strings.TrimRight(line, "\r\n")
+		display := line
+		if len(display) > maxGrepLineLength {
+			display = display[:maxGrepLineLength]
+		}
+
+		for len(pending) > 0 && len(matches[pending[0]].After) >= contextLines {
+			pending = pending[1:]
+		}
+		for _, idx := range pending {
+			matches[idx].After = append(matches[idx].After, display)
+		}
+
+		if len(pending) == 0 && len(matches) >= maxGrepMatchesPerFile {
+			break
+		}
+
+		if locs := re.FindAllStringIndex(line, -1); locs != nil && len(matches) < maxGrepMatchesPerFile {
+			var inLine [][]int
+			for _, loc := range locs {
+				if loc[1] <= len(display) {
+					inLine = append(inLine, loc)
+				}
+			}
+			matches = append(matches, GrepMatch{
+				Line:    lineNo,
+				Text:    display,
+				Before:  append([]string(nil), before...),
+				Matches: inLine,
+			})
+			if contextLines > 0 {
+				pending = append(pending, len(matches)-1)
+			}
+		}
+
+		if contextLines > 0 {
+			before = append(before, display)
+			if len(before) > contextLines {
+				before = before[1:]
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return matches, err
+		}
+	}
+
+	return matches, nil
+}
+
+// 内核提供的虚拟文件系统，内容搜索时跳过
+var virtualFSRoots = []string{"/proc", "/sys", "/dev"}
+
+func isVirtualFSPath(path string) bool {
+	for _, root := range virtualFSRoots {
+		if isSubPath(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// 遍历目录并将结果交给 emit，emit 返回错误时停止搜索
+func runSearch(ctx context.Context, q *searchQuery, emit func(SearchResult) error) (scanned int, err error) {
+	rootDepth := strings.Count(q.Root, string(os.PathSeparator))
+	found := 0
+
+	err = filepath.WalkDir(q.Root, func(path string, d fs.DirEntry, walkErr error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if walkErr != nil {
+			// 无权限等错误只跳过当前项
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == q.Root {
+			return nil
+		}
+
+		if isPathForbidden(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !q.IncludeHidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if q.Content != nil && d.IsDir() && isVirtualFSPath(path) {
+			return filepath.SkipDir
+		}
+		depth := strings.Count(path, string(os.PathSeparator)) - rootDepth
+		if q.Root == "/" {
+			depth++
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		scanned++
+
+		entry := newFileEntry(filepath.Dir(path), info)
+		if q.matchEntry(&entry) {
+			result := SearchResult{FileEntry: entry}
+			matched := true
+			if q.Content != nil {
+				// 只搜索普通文件的内容，FIFO、设备文件或 /proc 下的文件打开或读取时可能一直阻塞
+				if !info.Mode().IsRegular() || isVirtualFSPath(path) || entry.Size > maxGrepFileSize {
+					matched = false
+				} else {
+					matches, err := grepFile(ctx, path, q.Content, q.ContextLines)
+					if err != nil && ctx.Err() != nil {
+						return ctx.Err()
+					}
+					result.Matches = matches
+					matched = len(matches) > 0
+				}
+			}
+			if matched {
+				if err := emit(result); err != nil {
+					return err
+				}
+				found++
+				if found >= q.MaxResults {
+					return errSearchLimitReached
+				}
+			}
+		}
+
+		if d.IsDir() && q.MaxDepth > 0 && depth >= q.MaxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return scanned, err
+}
+
+// 处理文件搜索请求，结果通过 SSE 逐条推送
+func HandleFileSearch(c *gin.Context) {
+	q, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 客户端断开连接时 Request.Context 会被取消，从而中止搜索
+	ctx, cancel := context.WithTimeout(c.Request.Context(), defaultSearchTimeout)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	start := time.Now()
+	found := 0
+	scanned, err := runSearch(ctx, q, func(result SearchResult) error {
+		c.SSEvent("result", result)
+		c.Writer.Flush()
+		found++
+		return nil
+	})
+
+	summary := gin.H{
+		"found":     found,
+		"scanned":   scanned,
+		"elapsed":   time.Since(start).Milliseconds(),
+		"truncated": errors.Is(err, errSearchLimitReached),
+	}
+	switch {
+	case err == nil, errors.Is(err, errSearchLimitReached):
+	case errors.Is(err, context.DeadlineExceeded):
+		summary["error"] = "搜索超时"
+		summary["truncated"] = true
+	case errors.Is(err, context.Canceled):
+		// 客户端已断开，无需再输出
+		return
+	default:
+		summary["error"] = err.Error()
+	}
+	c.SSEvent("done", summary)
+	c.Writer.Flush()
+}
@@ -1,40 +1,447 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	sdbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/gin-gonic/gin"
 )
 
-func ListServices(c *gin.Context) {
-	cmd := exec.Command("systemctl", "list-units", "--type=service", "--no-pager")
-	output, err := cmd.Output()
+const (
+	// 单次请求调用 systemd 的超时时间
+	systemdCallTimeout = 10 * time.Second
+	// 启动、停止等任务的最长等待时间，超过后任务仍在后台执行
+	serviceJobTimeout = 30 * time.Second
+
+	defaultServicePageSize = 50
+	maxServicePageSize     = 500
+)
+
+// 服务名只允许 systemd 单元名中的字符
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+\.service$`)
+
+// 允许的服务操作
+var serviceActions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"reload":  true,
+	"enable":  true,
+	"disable": true,
+	"mask":    true,
+	"unmask":  true,
+}
+
+// 停止、禁用或屏蔽后会导致面板无法继续管理的服务
+var protectedServices = []string{"dbus.service", "dbus-broker.service"}
+
+// ServiceUnit 服务单元状态
+type ServiceUnit struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	LoadState    string `json:"loadState"`    // loaded/not-found/masked/not-loaded 等
+	ActiveState  string `json:"activeState"`  // active/inactive/failed/activating 等
+	SubState     string `json:"subState"`     // running/exited/dead 等
+	EnabledState string `json:"enabledState"` // enabled/disabled/static/masked 等
+	MainPID      uint32 `json:"mainPid"`
+	Memory       uint64 `json:"memory"`   // 字节，未开启内存统计时为0
+	Restarts     uint32 `json:"restarts"` // 自动重启次数
+	Uptime       int64  `json:"uptime"`   // 秒，未运行时为0
+	ActiveSince  int64  `json:"activeSince,omitempty"`
+	FragmentPath string `json:"fragmentPath,omitempty"`
+}
+
+var (
+	systemdConnMutex sync.Mutex
+	systemdConn      *sdbus.Conn
+)
+
+// 获取 systemd 的 D-Bus 连接，连接断开后自动重连
+func systemdConnection(ctx context.Context) (*sdbus.Conn, error) {
+	systemdConnMutex.Lock()
+	defer systemdConnMutex.Unlock()
+
+	if systemdConn != nil && systemdConn.Connected() {
+		return systemdConn, nil
+	}
+	if systemdConn != nil {
+		systemdConn.Close()
+		systemdConn = nil
+	}
+	conn, err := sdbus.NewWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	systemdConn = conn
+	return conn, nil
+}
+
+// 获取连接，失败时已写入响应
+func systemdFromRequest(c *gin.Context, ctx context.Context) (*sdbus.Conn, bool) {
+	conn, err := systemdConnection(ctx)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "无法连接到 systemd: " + err.Error()})
+		return nil, false
+	}
+	return conn, true
+}
+
+// 规范化服务名，省略后缀时补全 .service
+func normalizeServiceName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if !strings.HasSuffix(name, ".service") {
+		name += ".service"
+	}
+	return name, serviceNamePattern.MatchString(name)
+}
+
+func propUint32(props map[string]interface{}, key string) uint32 {
+	v, _ := props[key].(uint32)
+	return v
+}
+
+func propUint64(props map[string]interface{}, key string) uint64 {
+	v, _ := props[key].(uint64)
+	return v
+}
+
+func propString(props map[string]interface{}, key string) string {
+	v, _ := props[key].(string)
+	return v
+}
+
+// 补充已加载服务的运行时信息
+func fillServiceRuntime(ctx context.Context, conn *sdbus.Conn, unit *ServiceUnit) error {
+	props, err := conn.GetUnitPropertiesContext(ctx, unit.Name)
+	if err != nil {
+		return err
+	}
+	unit.FragmentPath = propString(props, "FragmentPath")
+	if state := propString(props, "UnitFileState"); state != "" {
+		unit.EnabledState = state
+	}
+	if unit.ActiveState == "active" || unit.ActiveState == "reloading" {
+		// 时间戳单位为微秒
+		if ts := propUint64(props, "ActiveEnterTimestamp"); ts > 0 {
+			unit.ActiveSince = int64(ts / 1e6)
+			unit.Uptime = time.Now().Unix() - unit.ActiveSince
+		}
+	}
+
+	props, err = conn.GetUnitTypePropertiesContext(ctx, unit.Name, "Service")
+	if err != nil {
+		return err
+	}
+	unit.MainPID = propUint32(props, "MainPID")
+	unit.Restarts = propUint32(props, "NRestarts")
+	// 未开启内存统计时为 UINT64_MAX
+	if mem := propUint64(props, "MemoryCurrent"); mem != math.MaxUint64 {
+		unit.Memory = mem
+	}
+	return nil
+}
+
+// 列出所有服务，包括未加载的服务单元文件
+func listServiceUnits(ctx context.Context, conn *sdbus.Conn) ([]*ServiceUnit, error) {
+	statuses, err := conn.ListUnitsByPatternsContext(ctx, nil, []string{"*.service"})
+	if err != nil {
+		return nil, err
+	}
+	files, err := conn.ListUnitFilesByPatternsContext(ctx, nil, []string{"*.service"})
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make(map[string]string, len(files))
+	for _, f := range files {
+		enabled[filepath.Base(f.Path)] = f.Type
+	}
+
+	units := make([]*ServiceUnit, 0, len(files))
+	seen := make(map[string]bool, len(statuses))
+	for _, s := range statuses {
+		seen[s.Name] = true
+		units = append(units, &ServiceUnit{
+			Name:         s.Name,
+			Description:  s.Description,
+			LoadState:    s.LoadState,
+			ActiveState:  s.ActiveState,
+			SubState:     s.SubState,
+			EnabledState: enabled[s.Name],
+		})
+	}
+	for name, state := range enabled {
+		// 模板单元需要实例名才能运行
+		if seen[name] || strings.HasSuffix(name, "@.service") {
+			continue
+		}
+		units = append(units, &ServiceUnit{
+			Name:         name,
+			LoadState:    "not-loaded",
+			ActiveState:  "inactive",
+			SubState:     "dead",
+			EnabledState: state,
+		})
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// 处理服务列表请求
+//
+// 参数：q 按名称或描述过滤；state 按运行状态（active/inactive/failed 等）过滤；
+// enabled 按启用状态（enabled/disabled/static/masked 等）过滤；page/pageSize 分页。
+// 只有当前页的服务会查询主进程、内存、重启次数和运行时长。
+func HandleServiceList(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+
+	units, err := listServiceUnits(ctx, conn)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.String(http.StatusOK, string(output))
+
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	stateFilter, enabledFilter := c.Query("state"), c.Query("enabled")
+	filtered := units[:0]
+	for _, u := range units {
+		if stateFilter != "" && u.ActiveState != stateFilter {
+			continue
+		}
+		if enabledFilter != "" && u.EnabledState != enabledFilter {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(u.Name), query) &&
+			!strings.Contains(strings.ToLower(u.Description), query) {
+			continue
+		}
+		filtered = append(filtered, u)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultServicePageSize)))
+	if pageSize < 1 || pageSize > maxServicePageSize {
+		pageSize = defaultServicePageSize
+	}
+
+	total := len(filtered)
+	start, end := pageRange(page, pageSize, total)
+
+	items := filtered[start:end]
+	for _, u := range items {
+		if u.LoadState != "loaded" {
+			continue
+		}
+		// 查询失败时仍返回基本状态
+		fillServiceRuntime(ctx, conn, u)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":    items,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// 查询单个服务的状态
+func serviceUnitStatus(ctx context.Context, conn *sdbus.Conn, name string) (*ServiceUnit, error) {
+	statuses, err := conn.ListUnitsByNamesContext(ctx, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 || statuses[0].LoadState == "not-found" {
+		return nil, errServiceNotFound
+	}
+	s := statuses[0]
+	unit := &ServiceUnit{
+		Name:        s.Name,
+		Description: s.Description,
+		LoadState:   s.LoadState,
+		ActiveState: s.ActiveState,
+		SubState:    s.SubState,
+	}
+	if err := fillServiceRuntime(ctx, conn, unit); err != nil {
+		return nil, err
+	}
+	return unit, nil
+}
+
+var errServiceNotFound = errors.New("服务不存在")
+
+// 处理服务详情请求，参数 name 为服务名
+func HandleServiceDetail(c *gin.Context) {
+	name, ok := normalizeServiceName(c.Query("name"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务名"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+
+	unit, err := serviceUnitStatus(ctx, conn, name)
+	if err == errServiceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, unit)
 }
 
-func ServiceControl(c *gin.Context) {
-	service := c.Query("service")
-	action := c.Query("action") // start, stop, restart, status
+// 检查操作是否会影响面板自身或其依赖的服务
+func serviceProtected(ctx context.Context, conn *sdbus.Conn, name, action string) bool {
+	if action != "stop" && action != "disable" && action != "mask" {
+		return false
+	}
+	for _, s := range protectedServices {
+		if name == s {
+			return true
+		}
+	}
+	own, err := conn.GetUnitNameByPID(ctx, uint32(os.Getpid()))
+	return err == nil && own == name
+}
+
+// 执行启动、停止等任务并等待完成
+func runServiceJob(ctx context.Context, conn *sdbus.Conn, name, action string) (string, error) {
+	ch := make(chan string, 1)
+	var err error
+	switch action {
+	case "start":
+		_, err = conn.StartUnitContext(ctx, name, "replace", ch)
+	case "stop":
+		_, err = conn.StopUnitContext(ctx, name, "replace", ch)
+	case "restart":
+		_, err = conn.RestartUnitContext(ctx, name, "replace", ch)
+	case "reload":
+		_, err = conn.ReloadUnitContext(ctx, name, "replace", ch)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(serviceJobTimeout)
+	defer timer.Stop()
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-timer.C:
+		return "running", nil
+	}
+}
+
+// 修改服务的启用状态，完成后重新加载 systemd 配置
+func changeServiceUnitFile(ctx context.Context, conn *sdbus.Conn, name, action string) error {
+	files := []string{name}
+	var err error
+	switch action {
+	case "enable":
+		var hasInstall bool
+		hasInstall, _, err = conn.EnableUnitFilesContext(ctx, files, false, false)
+		if err == nil && !hasInstall {
+			return errors.New("服务没有 [Install] 段，无法启用")
+		}
+	case "disable":
+		_, err = conn.DisableUnitFilesContext(ctx, files, false)
+	case "mask":
+		_, err = conn.MaskUnitFilesContext(ctx, files, false, false)
+	case "unmask":
+		_, err = conn.UnmaskUnitFilesContext(ctx, files, false)
+	}
+	if err != nil {
+		return err
+	}
+	return conn.ReloadContext(ctx)
+}
 
-	if service == "" || action == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "服务名和操作不能为空"})
+// 处理服务操作请求
+//
+// 请求体：name 为服务名；action 为 start/stop/restart/reload/enable/disable/mask/unmask。
+// 启动类操作最多等待30秒，超时后任务继续在后台执行，返回 result 为 running。
+func HandleServiceControl(c *gin.Context) {
+	var req struct {
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	name, ok := normalizeServiceName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务名"})
+		return
+	}
+	if !serviceActions[req.Action] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的操作"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), serviceJobTimeout+systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+	if serviceProtected(ctx, conn, name, req.Action) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该服务受保护，不允许此操作"})
 		return
 	}
 
-	cmd := exec.Command("systemctl", action, service)
-	output, err := cmd.CombinedOutput()
+	result := "done"
+	var err error
+	switch req.Action {
+	case "start", "stop", "restart", "reload":
+		result, err = runServiceJob(ctx, conn, name, req.Action)
+	default:
+		err = changeServiceUnitFile(ctx, conn, name, req.Action)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": string(output)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	unit, _ := serviceUnitStatus(ctx, conn, name)
+	if result != "done" && result != "running" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  fmt.Sprintf("操作失败（%s），请查看服务日志", result),
+			"result": result,
+			"unit":   unit,
+		})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "操作成功",
-		"output":  string(output),
+		"result":  result,
+		"unit":    unit,
 	})
 }
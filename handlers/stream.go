@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 客户端可以选择的最长推送间隔
+	maxStreamInterval = 5 * time.Minute
+	// 同时订阅的客户端上限
+	maxStreamSubscribers = 100
+	// 没有数据推送时的心跳间隔，防止代理断开空闲连接
+	streamKeepAlive = 30 * time.Second
+	// 单次写入的超时时间，超过说明客户端已无法接收
+	streamWriteTimeout = 30 * time.Second
+)
+
+// 推送订阅者
+type snapshotSubscriber struct {
+	// 只保留最新的一个快照：客户端来不及接收时用新快照替换旧快照，采集器不会被阻塞
+	ch       chan *SystemSnapshot
+	interval time.Duration
+	next     time.Time
+	dropped  int
+}
+
+var (
+	subscribersMutex sync.Mutex
+	subscribers      = make(map[*snapshotSubscriber]bool)
+)
+
+// 向所有到达推送时间的订阅者发送快照，由采集器调用
+func publishSnapshot(s *SystemSnapshot) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+
+	for sub := range subscribers {
+		if s.Timestamp.Before(sub.next) {
+			continue
+		}
+		// 留出一秒余量，避免采样时间的微小抖动导致跳过一次推送
+		sub.next = s.Timestamp.Add(sub.interval - time.Second)
+
+		select {
+		case sub.ch <- s:
+		default:
+			select {
+			case <-sub.ch:
+				sub.dropped++
+			default:
+			}
+			sub.ch <- s
+		}
+	}
+}
+
+// 将推送间隔调整为采样间隔的整数倍
+func negotiateStreamInterval(v string) (time.Duration, bool) {
+	interval := sampleInterval
+	if v != "" {
+		if sec, err := strconv.Atoi(v); err == nil {
+			interval = time.Duration(sec) * time.Second
+		} else if d, err := time.ParseDuration(v); err == nil {
+			interval = d
+		} else {
+			return 0, false
+		}
+	}
+	if interval < sampleInterval {
+		interval = sampleInterval
+	}
+	if interval > maxStreamInterval {
+		interval = maxStreamInterval
+	}
+	n := (interval + sampleInterval - 1) / sampleInterval
+	return n * sampleInterval, true
+}
+
+// 系统信息接口和推送使用的数据格式
+func systemInfoPayload(s *SystemSnapshot) gin.H {
+	return gin.H{
+		"timestamp": s.Timestamp,
+		"cpu":       s.CPU,
+		"memory":    s.Memory,
+		"swap":      s.Swap,
+		"disk":      s.Disk,
+		"mounts":    s.Mounts,
+		"diskIO":    s.DiskIO,
+		"network":   s.Network,
+	}
+}
+
+// 设置 SSE 响应头，返回发送事件的函数，客户端断开或写入超时时返回 false
+func startEventStream(c *gin.Context) func(event string, data interface{}) bool {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 写入失败（包括超时）时 gin 会中止请求
+	rc := http.NewResponseController(c.Writer)
+	return func(event string, data interface{}) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+		return !c.IsAborted()
+	}
+}
+
+// 处理系统状态推送请求（SSE）
+//
+// 参数 interval 为推送间隔（秒数或时长，如 10s），会调整为采样间隔（5秒）的整数倍。
+// 连接建立后先发送 config 事件告知实际间隔，随后立即推送最新快照，之后按间隔推送 snapshot 事件。
+// 客户端处理不及时的快照会被丢弃，只推送最新的状态。
+func HandleSystemStream(c *gin.Context) {
+	interval, ok := negotiateStreamInterval(c.Query("interval"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的推送间隔"})
+		return
+	}
+
+	sub := &snapshotSubscriber{
+		ch:       make(chan *SystemSnapshot, 1),
+		interval: interval,
+	}
+	subscribersMutex.Lock()
+	if len(subscribers) >= maxStreamSubscribers {
+		subscribersMutex.Unlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "订阅的客户端过多，请稍后重试"})
+		return
+	}
+	if snapshot, ok := latestSnapshot(); ok {
+		sub.ch <- &snapshot
+		sub.next = snapshot.Timestamp.Add(interval - time.Second)
+	}
+	subscribers[sub] = true
+	subscribersMutex.Unlock()
+
+	defer func() {
+		subscribersMutex.Lock()
+		delete(subscribers, sub)
+		subscribersMutex.Unlock()
+	}()
+
+	write := startEventStream(c)
+	if !write("config", gin.H{"interval": int(interval / time.Second)}) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case snapshot := <-sub.ch:
+			payload := systemInfoPayload(snapshot)
+			subscribersMutex.Lock()
+			payload["dropped"] = sub.dropped
+			subscribersMutex.Unlock()
+			if !write("snapshot", payload) {
+				return
+			}
+		case <-keepAlive.C:
+			if !write("ping", gin.H{"time": time.Now().Unix()}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 内置的面板任务类型：脚本、目录备份、过期文件清理和 URL 健康检查
+
+const (
+	defaultBackupKeep = 7
+	maxBackupKeep     = 1000
+	// 健康检查读取的响应内容上限
+	maxHTTPCheckBody = 1024 * 1024
+)
+
+var backupPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ScriptTaskConfig 脚本任务
+type ScriptTaskConfig struct {
+	Script string `json:"script"`
+	// 解释器，默认 /bin/sh
+	Shell   string `json:"shell,omitempty"`
+	WorkDir string `json:"workDir,omitempty"`
+	// 额外的环境变量，格式为 KEY=VALUE
+	Env []string `json:"env,omitempty"`
+}
+
+// BackupTaskConfig 备份任务，将目录或文件打包为 tar.gz
+type BackupTaskConfig struct {
+	Sources []string `json:"sources"`
+	// 备份文件存放的目录
+	Dest string `json:"dest"`
+	// 备份文件名前缀，默认 backup
+	Prefix string `json:"prefix,omitempty"`
+	// 按文件名排除，支持通配符
+	Exclude []string `json:"exclude,omitempty"`
+	// 保留的备份份数，默认 7
+	Keep int `json:"keep,omitempty"`
+}
+
+// CleanupTaskConfig 清理任务，删除目录中超过保留天数的文件
+type CleanupTaskConfig struct {
+	Paths []string `json:"paths"`
+	// 文件名通配符，默认 *
+	Pattern   string `json:"pattern,omitempty"`
+	OlderThan int    `json:"olderThan"`
+	Recursive bool   `json:"recursive,omitempty"`
+	// 只列出将被删除的文件
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// HTTPCheckTaskConfig URL 健康检查任务
+type HTTPCheckTaskConfig struct {
+	URL string `json:"url"`
+	// GET 或 HEAD，默认 GET
+	Method string `json:"method,omitempty"`
+	// 期望的状态码，为空时 2xx 和 3xx 视为正常
+	ExpectStatus []int `json:"expectStatus,omitempty"`
+	// 响应内容需要包含的文本
+	Contains string `json:"contains,omitempty"`
+	// 跳过证书校验
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+func registerBuiltinTaskTypes() {
+	RegisterTaskType(TaskType{Name: "script", Validate: validateScriptTask, Run: runScriptTask})
+	RegisterTaskType(TaskType{Name: "backup", Validate: validateBackupTask, Run: runBackupTask})
+	RegisterTaskType(TaskType{Name: "cleanup", Validate: validateCleanupTask, Run: runCleanupTask})
+	RegisterTaskType(TaskType{Name: "http", Validate: validateHTTPCheckTask, Run: runHTTPCheckTask})
+}
+
+func validateScriptTask(t *ScheduledTask) error {
+	cfg := t.Script
+	if cfg == nil || strings.TrimSpace(cfg.Script) == "" {
+		return errors.New("脚本内容不能为空")
+	}
+	if cfg.Shell == "" {
+		cfg.Shell = "/bin/sh"
+	}
+	if !filepath.IsAbs(cfg.Shell) {
+		return errors.New("解释器必须使用绝对路径")
+	}
+	if cfg.WorkDir != "" {
+		if err := checkPathPolicy(cfg.WorkDir); err != nil {
+			return err
+		}
+	}
+	for _, env := range cfg.Env {
+		if key, _, ok := strings.Cut(env, "="); !ok || key == "" {
+			return fmt.Errorf("无效的环境变量: %s", env)
+		}
+	}
+	return nil
+}
+
+func runScriptTask(ctx context.Context, t *ScheduledTask, out io.Writer) (int, error) {
+	cfg := t.Script
+	cmd := exec.CommandContext(ctx, cfg.Shell, "-c", cfg.Script)
+	cmd.Dir = cfg.WorkDir
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// 超时时结束整个进程组，避免子进程残留
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+func validateBackupTask(t *ScheduledTask) error {
+	cfg := t.Backup
+	if cfg == nil || len(cfg.Sources) == 0 {
+		return errors.New("请至少指定一个备份来源")
+	}
+	if err := checkPathPolicy(cfg.Dest); err != nil {
+		return err
+	}
+	cfg.Dest = filepath.Clean(cfg.Dest)
+	for i, src := range cfg.Sources {
+		if err := checkPathPolicy(src); err != nil {
+			return err
+		}
+		cfg.Sources[i] = filepath.Clean(src)
+		if isSubPath(cfg.Dest, cfg.Sources[i]) {
+			return fmt.Errorf("备份目录不能位于备份来源中: %s", src)
+		}
+	}
+	for _, pattern := range cfg.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("无效的排除规则: %s", pattern)
+		}
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "backup"
+	}
+	if !backupPrefixPattern.MatchString(cfg.Prefix) {
+		return errors.New("文件名前缀只能包含字母、数字、点、下划线和横线")
+	}
+	if cfg.Keep == 0 {
+		cfg.Keep = defaultBackupKeep
+	}
+	if cfg.Keep < 0 || cfg.Keep > maxBackupKeep {
+		return fmt.Errorf("保留份数必须在 1 到 %d 之间", maxBackupKeep)
+	}
+	return nil
+}
+
+func backupExcluded(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 将一个文件或目录写入归档，返回写入的文件数；单个文件读取失败时记录后继续
+func addToBackup(ctx context.Context, tw *tar.Writer, root string, exclude []string, out io.Writer) (int, int, error) {
+	files, failures := 0, 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintf(out, "跳过 %s: %v\n", path, err)
+			failures++
+			return nil
+		}
+		if path != root && backupExcluded(exclude, d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			fmt.Fprintf(out, "跳过 %s: %v\n", path, err)
+			failures++
+			return nil
+		}
+		link := ""
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				fmt.Fprintf(out, "跳过 %s: %v\n", path, err)
+				failures++
+				return nil
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			// 跳过设备、管道和套接字
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = strings.TrimPrefix(filepath.ToSlash(path), "/")
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if !info.Mode().IsRegular() {
+			return tw.WriteHeader(hdr)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(out, "跳过 %s: %v\n", path, err)
+			failures++
+			return nil
+		}
+		defer f.Close()
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// 文件在打包期间变小时补齐长度，保证归档结构完整
+		n, err := io.CopyN(tw, f, hdr.Size)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n < hdr.Size {
+			fmt.Fprintf(out, "警告 %s: 打包期间文件被修改\n", path)
+			failures++
+			if _, err := io.CopyN(tw, zeroReader{}, hdr.Size-n); err != nil {
+				return err
+			}
+		}
+		files++
+		return nil
+	})
+	return files, failures, err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func runBackupTask(ctx context.Context, t *ScheduledTask, out io.Writer) (int, error) {
+	cfg := t.Backup
+	if err := os.MkdirAll(cfg.Dest, 0700); err != nil {
+		return -1, err
+	}
+	tmp, err := os.CreateTemp(cfg.Dest, "."+cfg.Prefix+"-*.tmp")
+	if err != nil {
+		return -1, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gw := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gw)
+	files, failures := 0, 0
+	for _, src := range cfg.Sources {
+		n, failed, err := addToBackup(ctx, tw, src, cfg.Exclude, out)
+		if err != nil {
+			return -1, fmt.Errorf("打包 %s 失败: %v", src, err)
+		}
+		files += n
+		failures += failed
+	}
+	if err := tw.Close(); err != nil {
+		return -1, err
+	}
+	if err := gw.Close(); err != nil {
+		return -1, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return -1, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return -1, err
+	}
+
+	name := fmt.Sprintf("%s-%s.tar.gz", cfg.Prefix, time.Now().Format("20060102-150405"))
+	target := filepath.Join(cfg.Dest, name)
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return -1, err
+	}
+	fmt.Fprintf(out, "已备份 %d 个文件到 %s（%s）\n", files, target, formatSize(info.Size()))
+
+	// 按文件名中的时间清理旧备份
+	entries, err := os.ReadDir(cfg.Dest)
+	if err != nil {
+		return -1, err
+	}
+	// 只匹配本任务生成的文件名，避免前缀相近的其他任务的备份被误删
+	backupName := regexp.MustCompile(`^` + regexp.QuoteMeta(cfg.Prefix) + `-\d{8}-\d{6}\.tar\.gz$`)
+	var backups []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && backupName.MatchString(e.Name()) {
+			backups = append(backups, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i := cfg.Keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(cfg.Dest, backups[i])); err != nil {
+			fmt.Fprintf(out, "删除旧备份 %s 失败: %v\n", backups[i], err)
+			continue
+		}
+		fmt.Fprintf(out, "已删除旧备份 %s\n", backups[i])
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(out, "有 %d 个文件未能完整备份\n", failures)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func validateCleanupTask(t *ScheduledTask) error {
+	cfg := t.Cleanup
+	if cfg == nil || len(cfg.Paths) == 0 {
+		return errors.New("请至少指定一个清理目录")
+	}
+	for i, p := range cfg.Paths {
+		if err := checkPathPolicy(p); err != nil {
+			return err
+		}
+		cfg.Paths[i] = filepath.Clean(p)
+		if cfg.Paths[i] == "/" {
+			return errors.New("不能清理根目录")
+		}
+	}
+	if cfg.Pattern == "" {
+		cfg.Pattern = "*"
+	}
+	if _, err := filepath.Match(cfg.Pattern, ""); err != nil {
+		return fmt.Errorf("无效的文件名通配符: %s", cfg.Pattern)
+	}
+	if cfg.OlderThan <= 0 {
+		return errors.New("保留天数必须大于 0")
+	}
+	return nil
+}
+
+func runCleanupTask(ctx context.Context, t *ScheduledTask, out io.Writer) (int, error) {
+	cfg := t.Cleanup
+	cutoff := time.Now().AddDate(0, 0, -cfg.OlderThan)
+	removed, failures := 0, 0
+	var freed int64
+
+	for _, root := range cfg.Paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				fmt.Fprintf(out, "跳过 %s: %v\n", path, err)
+				failures++
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && !cfg.Recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// 不跟随符号链接，只处理普通文件
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if ok, _ := filepath.Match(cfg.Pattern, d.Name()); !ok {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || !info.ModTime().Before(cutoff) {
+				return nil
+			}
+
+			if cfg.DryRun {
+				fmt.Fprintf(out, "将删除 %s（%s）\n", path, formatSize(info.Size()))
+			} else if err := os.Remove(path); err != nil {
+				fmt.Fprintf(out, "删除 %s 失败: %v\n", path, err)
+				failures++
+				return nil
+			} else {
+				fmt.Fprintf(out, "已删除 %s（%s）\n", path, formatSize(info.Size()))
+			}
+			removed++
+			freed += info.Size()
+			return nil
+		})
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	action := "已删除"
+	if cfg.DryRun {
+		action = "将删除"
+	}
+	fmt.Fprintf(out, "%s %d 个文件，共 %s\n", action, removed, formatSize(freed))
+	if failures > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func validateHTTPCheckTask(t *ScheduledTask) error {
+	cfg := t.HTTPCheck
+	if cfg == nil {
+		return errors.New("请指定检查的 URL")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL 必须以 http:// 或 https:// 开头")
+	}
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case "":
+		cfg.Method = http.MethodGet
+	case http.MethodGet, http.MethodHead:
+	default:
+		return errors.New("请求方法只能是 GET 或 HEAD")
+	}
+	for _, code := range cfg.ExpectStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("无效的状态码: %d", code)
+		}
+	}
+	return nil
+}
+
+// 健康检查共用的客户端，按是否校验证书区分；每次执行都新建 Transport 会留下无法回收的空闲连接
+var (
+	httpCheckClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		},
+	}
+	httpCheckInsecureClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+)
+
+func runHTTPCheckTask(ctx context.Context, t *ScheduledTask, out io.Writer) (int, error) {
+	cfg := t.HTTPCheck
+	client := httpCheckClient
+	if cfg.Insecure {
+		client = httpCheckInsecureClient
+	}
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, nil)
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("User-Agent", "gegecp-healthcheck")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(out, "请求失败: %v\n", err)
+		return 1, nil
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPCheckBody))
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Fprintf(out, "读取响应失败: %v\n", err)
+		return 1, nil
+	}
+
+	fmt.Fprintf(out, "%s %s -> %s，耗时 %d ms，%d 字节\n", cfg.Method, cfg.URL, resp.Status, elapsed.Milliseconds(), len(body))
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		expires := resp.TLS.PeerCertificates[0].NotAfter
+		fmt.Fprintf(out, "证书到期时间 %s（剩余 %d 天）\n", expires.Local().Format(time.DateTime), int(time.Until(expires).Hours()/24))
+	}
+
+	healthy := resp.StatusCode >= 200 && resp.StatusCode < 400
+	if len(cfg.ExpectStatus) > 0 {
+		healthy = false
+		for _, code := range cfg.ExpectStatus {
+			if resp.StatusCode == code {
+				healthy = true
+			}
+		}
+	}
+	if !healthy {
+		fmt.Fprintf(out, "状态码 %d 不符合预期\n", resp.StatusCode)
+		return 1, nil
+	}
+	if cfg.Contains != "" && !strings.Contains(string(body), cfg.Contains) {
+		fmt.Fprintf(out, "响应内容不包含 %q\n", cfg.Contains)
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
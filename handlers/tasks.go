@@ -0,0 +1,774 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gegecp/config"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+)
+
+// 面板计划任务：与系统 cron 无关，由面板进程按 cron 表达式在 goroutine 中执行，
+// 每次运行的状态、退出码和输出都记录在运行历史中。任务类型通过 RegisterTaskType 注册，
+// 内置类型见 taskrunners.go。
+
+const (
+	taskDataDir = "data/tasks"
+	// 单次运行保存的输出上限，超出部分丢弃
+	maxTaskOutput = 256 * 1024
+	// 排队策略下最多等待的次数，超出时跳过
+	maxTaskQueue = 5
+
+	defaultTaskTimeout     = time.Hour
+	maxTaskTimeout         = 24 * time.Hour
+	defaultTaskHistoryRuns = 100
+	defaultTaskHistoryAge  = 30
+)
+
+const (
+	taskRunQueued  = "queued"
+	taskRunRunning = "running"
+	taskRunSuccess = "success"
+	taskRunFailed  = "failed"
+	taskRunTimeout = "timeout"
+	taskRunSkipped = "skipped"
+	taskRunAborted = "aborted"
+)
+
+// ScheduledTask 面板计划任务，不同类型使用对应的配置字段
+type ScheduledTask struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Schedule string `json:"schedule"`
+	// 超时时间（秒），0 表示使用默认的 1 小时
+	Timeout int `json:"timeout"`
+	// 上次运行未结束时的处理方式：skip 跳过本次，queue 等待上次结束后执行
+	Concurrency string `json:"concurrency"`
+	Enabled     bool   `json:"enabled"`
+
+	Script    *ScriptTaskConfig    `json:"script,omitempty"`
+	Backup    *BackupTaskConfig    `json:"backup,omitempty"`
+	Cleanup   *CleanupTaskConfig   `json:"cleanup,omitempty"`
+	HTTPCheck *HTTPCheckTaskConfig `json:"httpCheck,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TaskRun 任务的一次运行
+type TaskRun struct {
+	ID       string `json:"id"`
+	TaskID   string `json:"taskId"`
+	TaskName string `json:"taskName"`
+	Type     string `json:"type"`
+	// schedule 或 manual
+	Trigger string `json:"trigger"`
+	Status  string `json:"status"`
+	// 未执行或被中止时为 -1
+	ExitCode   int        `json:"exitCode"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+	OutputSize int64      `json:"outputSize"`
+	Truncated  bool       `json:"truncated,omitempty"`
+}
+
+// TaskType 任务类型
+type TaskType struct {
+	Name string
+	// 检查并补全任务配置
+	Validate func(t *ScheduledTask) error
+	// 执行任务，输出写入 out，返回退出码；ctx 在超时或中止时取消
+	Run func(ctx context.Context, t *ScheduledTask, out io.Writer) (int, error)
+}
+
+// 任务的运行状态
+type taskState struct {
+	// 持有期间任务正在运行
+	running sync.Mutex
+	waiting int
+}
+
+var (
+	taskTypes = make(map[string]TaskType)
+
+	tasksMutex   sync.Mutex
+	tasks        []*ScheduledTask
+	taskEntries  = make(map[string]cron.EntryID)
+	taskStates   = make(map[string]*taskState)
+	taskCancels  = make(map[string]context.CancelFunc)
+	taskSchedule = cron.New(cron.WithParser(cronScheduleParser))
+
+	taskHistoryMutex sync.Mutex
+	taskHistory      []*TaskRun
+
+	errTaskRunning = errors.New("任务正在运行")
+)
+
+// RegisterTaskType 注册任务类型
+func RegisterTaskType(t TaskType) {
+	taskTypes[t.Name] = t
+}
+
+func init() {
+	registerBuiltinTaskTypes()
+}
+
+// StartTasks 加载并调度面板计划任务。任务按配置的路径策略校验，需在加载配置之后调用
+func StartTasks() {
+	if err := loadTasks(); err != nil {
+		slog.Error("加载计划任务失败", "error", err)
+	}
+	loadTaskHistory()
+	pruneTaskHistory()
+	taskSchedule.Start()
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			pruneTaskHistory()
+		}
+	}()
+}
+
+func (t *ScheduledTask) normalize() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return errors.New("任务名称不能为空")
+	}
+	if err := singleLine("名称", t.Name); err != nil {
+		return err
+	}
+
+	t.Schedule = strings.Join(strings.Fields(t.Schedule), " ")
+	if t.Schedule == "@reboot" {
+		return errors.New("面板任务不支持 @reboot")
+	}
+	if err := validateCronSchedule(t.Schedule); err != nil {
+		return fmt.Errorf("无效的时间表达式: %v", err)
+	}
+
+	if t.Timeout < 0 || time.Duration(t.Timeout)*time.Second > maxTaskTimeout {
+		return fmt.Errorf("超时时间必须在 0 到 %d 秒之间", int(maxTaskTimeout/time.Second))
+	}
+	switch t.Concurrency {
+	case "":
+		t.Concurrency = "skip"
+	case "skip", "queue":
+	default:
+		return errors.New("并发策略只能是 skip 或 queue")
+	}
+
+	typ, ok := taskTypes[t.Type]
+	if !ok {
+		return fmt.Errorf("不支持的任务类型: %s", t.Type)
+	}
+	return typ.Validate(t)
+}
+
+func (t *ScheduledTask) timeout() time.Duration {
+	if t.Timeout == 0 {
+		return defaultTaskTimeout
+	}
+	return time.Duration(t.Timeout) * time.Second
+}
+
+func loadTasks() error {
+	if err := os.MkdirAll(filepath.Join(taskDataDir, "output"), 0700); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(taskDataDir, "tasks.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var loaded []*ScheduledTask
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	for _, t := range loaded {
+		if err := t.normalize(); err != nil {
+			slog.Warn("忽略无效的计划任务", "task", t.ID, "error", err)
+			continue
+		}
+		tasks = append(tasks, t)
+		scheduleTask(t)
+	}
+	return nil
+}
+
+// 调用方需持有 tasksMutex
+func saveTasks() error {
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(taskDataDir, "tasks.json"), data, 0600)
+}
+
+// 调用方需持有 tasksMutex
+func findTask(id string) int {
+	for i, t := range tasks {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// 按任务当前配置更新调度，调用方需持有 tasksMutex
+func scheduleTask(t *ScheduledTask) {
+	if id, ok := taskEntries[t.ID]; ok {
+		taskSchedule.Remove(id)
+		delete(taskEntries, t.ID)
+	}
+	if !t.Enabled {
+		return
+	}
+
+	taskID := t.ID
+	entry, err := taskSchedule.AddFunc(t.Schedule, func() {
+		if _, err := triggerTask(taskID, "schedule"); err != nil && err != errTaskRunning {
+			slog.Warn("执行计划任务失败", "task", taskID, "error", err)
+		}
+	})
+	if err != nil {
+		slog.Warn("添加任务调度失败", "task", t.ID, "error", err)
+		return
+	}
+	taskEntries[t.ID] = entry
+}
+
+// 调用方需持有 tasksMutex
+func taskNextRun(id string) *time.Time {
+	entry, ok := taskEntries[id]
+	if !ok {
+		return nil
+	}
+	next := taskSchedule.Entry(entry).Next
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// 按并发策略触发一次运行，返回运行记录；被跳过时同样记录
+func triggerTask(id, trigger string) (*TaskRun, error) {
+	tasksMutex.Lock()
+	i := findTask(id)
+	if i < 0 {
+		tasksMutex.Unlock()
+		return nil, errors.New("任务不存在")
+	}
+	// 复制一份，运行期间任务可能被修改
+	task := *tasks[i]
+	state := taskStates[id]
+	if state == nil {
+		state = &taskState{}
+		taskStates[id] = state
+	}
+
+	run := &TaskRun{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		TaskID:    task.ID,
+		TaskName:  task.Name,
+		Type:      task.Type,
+		Trigger:   trigger,
+		Status:    taskRunRunning,
+		ExitCode:  -1,
+		StartedAt: time.Now(),
+	}
+
+	if task.Concurrency == "queue" {
+		if state.waiting >= maxTaskQueue {
+			tasksMutex.Unlock()
+			skipTaskRun(run, "排队的运行过多")
+			return run, errTaskRunning
+		}
+		state.waiting++
+		tasksMutex.Unlock()
+
+		run.Status = taskRunQueued
+		addTaskRun(run)
+		queued := *run
+		go func() {
+			state.running.Lock()
+			tasksMutex.Lock()
+			state.waiting--
+			tasksMutex.Unlock()
+			defer state.running.Unlock()
+			executeTask(&task, run)
+		}()
+		return &queued, nil
+	}
+
+	locked := state.running.TryLock()
+	tasksMutex.Unlock()
+	if !locked {
+		skipTaskRun(run, "上次运行尚未结束")
+		return run, errTaskRunning
+	}
+	addTaskRun(run)
+	started := *run
+	go func() {
+		defer state.running.Unlock()
+		executeTask(&task, run)
+	}()
+	return &started, nil
+}
+
+func skipTaskRun(run *TaskRun, reason string) {
+	now := time.Now()
+	run.Status = taskRunSkipped
+	run.Error = reason
+	run.FinishedAt = &now
+	addTaskRun(run)
+	writeTaskRun(run)
+}
+
+// 限制写入量的输出
+type taskOutput struct {
+	f         *os.File
+	size      int64
+	truncated bool
+}
+
+func (o *taskOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	if remain := maxTaskOutput - o.size; int64(len(p)) > remain {
+		p = p[:remain]
+		o.truncated = true
+	}
+	if len(p) > 0 {
+		if _, err := o.f.Write(p); err != nil {
+			return 0, err
+		}
+		o.size += int64(len(p))
+	}
+	return n, nil
+}
+
+func taskOutputPath(runID string) string {
+	return filepath.Join(taskDataDir, "output", runID+".log")
+}
+
+func executeTask(task *ScheduledTask, run *TaskRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), task.timeout())
+	defer cancel()
+
+	tasksMutex.Lock()
+	taskCancels[run.ID] = cancel
+	tasksMutex.Unlock()
+	defer func() {
+		tasksMutex.Lock()
+		delete(taskCancels, run.ID)
+		tasksMutex.Unlock()
+	}()
+
+	// 排队期间的等待不计入耗时
+	startedAt := time.Now()
+	taskHistoryMutex.Lock()
+	run.Status = taskRunRunning
+	run.StartedAt = startedAt
+	taskHistoryMutex.Unlock()
+
+	var code int
+	var err error
+	f, ferr := os.OpenFile(taskOutputPath(run.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	out := &taskOutput{f: f}
+	if ferr != nil {
+		code, err = -1, ferr
+	} else {
+		code, err = runTask(ctx, task, out)
+		f.Close()
+	}
+
+	finishedAt := time.Now()
+	taskHistoryMutex.Lock()
+	run.FinishedAt = &finishedAt
+	run.DurationMs = finishedAt.Sub(startedAt).Milliseconds()
+	run.ExitCode = code
+	run.OutputSize = out.size
+	run.Truncated = out.truncated
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Status = taskRunTimeout
+		run.Error = fmt.Sprintf("运行超过 %s 被终止", task.timeout())
+	case errors.Is(ctx.Err(), context.Canceled):
+		run.Status = taskRunAborted
+		run.Error = "已被手动中止"
+	case err != nil:
+		run.Status = taskRunFailed
+		run.Error = err.Error()
+	case code != 0:
+		run.Status = taskRunFailed
+		run.Error = fmt.Sprintf("退出码 %d", code)
+	default:
+		run.Status = taskRunSuccess
+	}
+	taskHistoryMutex.Unlock()
+
+	writeTaskRun(run)
+	if run.Status != taskRunSuccess {
+		slog.Warn("计划任务运行失败", "task", task.Name, "run", run.ID, "status", run.Status, "error", run.Error)
+	}
+}
+
+// 执行任务，任务类型中的 panic 视为失败
+func runTask(ctx context.Context, task *ScheduledTask, out io.Writer) (code int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			code, err = -1, fmt.Errorf("任务异常: %v", r)
+		}
+	}()
+	return taskTypes[task.Type].Run(ctx, task, out)
+}
+
+func loadTaskHistory() {
+	f, err := os.Open(filepath.Join(taskDataDir, "runs.jsonl"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	taskHistoryMutex.Lock()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var run TaskRun
+		if json.Unmarshal(scanner.Bytes(), &run) == nil {
+			taskHistory = append(taskHistory, &run)
+		}
+	}
+	taskHistoryMutex.Unlock()
+}
+
+func addTaskRun(run *TaskRun) {
+	taskHistoryMutex.Lock()
+	defer taskHistoryMutex.Unlock()
+	for _, r := range taskHistory {
+		if r == run {
+			return
+		}
+	}
+	taskHistory = append(taskHistory, run)
+}
+
+// 运行结束后追加到历史文件，超出保留数量时清理
+func writeTaskRun(run *TaskRun) {
+	taskHistoryMutex.Lock()
+	line, _ := json.Marshal(run)
+	taskHistoryMutex.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(taskDataDir, "runs.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		slog.Error("写入任务运行记录失败", "error", err)
+		return
+	}
+	f.Write(append(line, '\n'))
+	f.Close()
+
+	pruneTaskHistory()
+}
+
+func taskHistoryLimits() (int, time.Duration) {
+	cfg := config.GlobalConfig.System.Tasks
+	maxRuns, maxAge := cfg.HistoryMaxRuns, cfg.HistoryMaxAge
+	if maxRuns <= 0 {
+		maxRuns = defaultTaskHistoryRuns
+	}
+	if maxAge <= 0 {
+		maxAge = defaultTaskHistoryAge
+	}
+	return maxRuns, time.Duration(maxAge) * 24 * time.Hour
+}
+
+// 按保留策略清理运行记录和输出，有记录被清理时重写历史文件
+func pruneTaskHistory() {
+	maxRuns, maxAge := taskHistoryLimits()
+	cutoff := time.Now().Add(-maxAge)
+
+	taskHistoryMutex.Lock()
+	defer taskHistoryMutex.Unlock()
+
+	counts := make(map[string]int)
+	kept := make([]*TaskRun, 0, len(taskHistory))
+	var removed []*TaskRun
+	// 从新到旧统计每个任务的记录数
+	for i := len(taskHistory) - 1; i >= 0; i-- {
+		r := taskHistory[i]
+		if r.FinishedAt != nil {
+			counts[r.TaskID]++
+			if counts[r.TaskID] > maxRuns || r.StartedAt.Before(cutoff) {
+				removed = append(removed, r)
+				continue
+			}
+		}
+		kept = append(kept, r)
+	}
+	if len(removed) == 0 {
+		return
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	taskHistory = kept
+
+	for _, r := range removed {
+		os.Remove(taskOutputPath(r.ID))
+	}
+	var buf strings.Builder
+	for _, r := range taskHistory {
+		if r.FinishedAt == nil {
+			continue
+		}
+		line, _ := json.Marshal(r)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	path := filepath.Join(taskDataDir, "runs.jsonl")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0600); err == nil {
+		os.Rename(tmp, path)
+	}
+}
+
+// 任务列表中的任务，附带调度状态
+type taskView struct {
+	*ScheduledTask
+	NextRun *time.Time `json:"nextRun,omitempty"`
+	Running bool       `json:"running"`
+	LastRun *TaskRun   `json:"lastRun,omitempty"`
+}
+
+func lastTaskRuns() map[string]TaskRun {
+	taskHistoryMutex.Lock()
+	defer taskHistoryMutex.Unlock()
+	last := make(map[string]TaskRun)
+	for _, r := range taskHistory {
+		if r.Status != taskRunSkipped {
+			last[r.TaskID] = *r
+		}
+	}
+	return last
+}
+
+// 处理面板计划任务列表请求
+func HandleTasksList(c *gin.Context) {
+	last := lastTaskRuns()
+
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+	views := make([]taskView, 0, len(tasks))
+	for _, t := range tasks {
+		v := taskView{ScheduledTask: t, NextRun: taskNextRun(t.ID)}
+		if r, ok := last[t.ID]; ok {
+			v.LastRun = &r
+			v.Running = r.FinishedAt == nil
+		}
+		views = append(views, v)
+	}
+
+	types := make([]string, 0, len(taskTypes))
+	for name := range taskTypes {
+		types = append(types, name)
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": views, "types": types})
+}
+
+// 处理面板计划任务的创建和修改，id 为空时新建
+func HandleTaskSave(c *gin.Context) {
+	var task ScheduledTask
+	if err := c.ShouldBindJSON(&task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if err := task.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	now := time.Now()
+	task.UpdatedAt = now
+	if task.ID == "" {
+		task.ID = strconv.FormatInt(now.UnixNano(), 10)
+		task.CreatedAt = now
+		tasks = append(tasks, &task)
+	} else {
+		i := findTask(task.ID)
+		if i < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+			return
+		}
+		task.CreatedAt = tasks[i].CreatedAt
+		tasks[i] = &task
+	}
+
+	if err := saveTasks(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存计划任务失败"})
+		return
+	}
+	scheduleTask(&task)
+	slog.InfoContext(c.Request.Context(), "面板计划任务已保存", "task", task.ID, "name", task.Name, "schedule", task.Schedule)
+	c.JSON(http.StatusOK, gin.H{"message": "任务已保存", "task": taskView{ScheduledTask: &task, NextRun: taskNextRun(task.ID)}})
+}
+
+// 处理面板计划任务删除请求，运行记录按保留策略自然过期
+func HandleTaskDelete(c *gin.Context) {
+	id := c.Query("id")
+
+	tasksMutex.Lock()
+	defer tasksMutex.Unlock()
+
+	i := findTask(id)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	if entry, ok := taskEntries[id]; ok {
+		taskSchedule.Remove(entry)
+		delete(taskEntries, id)
+	}
+	tasks = append(tasks[:i], tasks[i+1:]...)
+	if err := saveTasks(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存计划任务失败"})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "面板计划任务已删除", "task", id)
+	c.JSON(http.StatusOK, gin.H{"message": "任务已删除"})
+}
+
+// 处理立即运行任务的请求，遵循任务的并发策略
+func HandleTaskRun(c *gin.Context) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	run, err := triggerTask(req.ID, "manual")
+	if err == errTaskRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "run": run})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "任务已开始运行", "run": run})
+}
+
+// 处理中止运行的请求
+func HandleTaskRunAbort(c *gin.Context) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	tasksMutex.Lock()
+	cancel, ok := taskCancels[req.ID]
+	tasksMutex.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该运行不存在或已结束"})
+		return
+	}
+	cancel()
+	c.JSON(http.StatusOK, gin.H{"message": "已发送中止请求"})
+}
+
+// 处理运行历史请求
+//
+// 参数：taskId、status 过滤；since 为开始时间；limit 为返回的条数，默认 100
+func HandleTaskRuns(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数量限制"})
+			return
+		}
+		limit = n
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+			return
+		}
+		since = t
+	}
+	taskID, status := c.Query("taskId"), c.Query("status")
+
+	taskHistoryMutex.Lock()
+	runs := []TaskRun{}
+	for i := len(taskHistory) - 1; i >= 0 && len(runs) < limit; i-- {
+		r := taskHistory[i]
+		if r.StartedAt.Before(since) {
+			continue
+		}
+		if (taskID != "" && r.TaskID != taskID) || (status != "" && r.Status != status) {
+			continue
+		}
+		runs = append(runs, *r)
+	}
+	taskHistoryMutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// 处理单次运行详情请求，包含捕获的输出
+func HandleTaskRunDetail(c *gin.Context) {
+	id := c.Query("id")
+
+	var run *TaskRun
+	taskHistoryMutex.Lock()
+	for _, r := range taskHistory {
+		if r.ID == id {
+			copied := *r
+			run = &copied
+			break
+		}
+	}
+	taskHistoryMutex.Unlock()
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "运行记录不存在"})
+		return
+	}
+
+	output, err := os.ReadFile(taskOutputPath(run.ID))
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"run": run, "output": string(output)})
+}
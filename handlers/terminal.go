@@ -29,6 +29,9 @@ func TerminalWS(c *gin.Context) {
 	}
 	defer conn.Close()
 
+	activeTerminalSessions.Add(1)
+	defer activeTerminalSessions.Add(-1)
+
 	// 获取并验证参数
 	host := c.Query("host")
 	username := c.Query("username")
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	// 在线编辑允许的最大文件大小
+	maxEditableFileSize = 10 * 1024 * 1024
+
+	encodingUTF8    = "UTF-8"
+	encodingUTF8BOM = "UTF-8-BOM"
+	encodingUTF16LE = "UTF-16LE"
+	encodingUTF16BE = "UTF-16BE"
+	encodingGBK     = "GBK"
+
+	lineEndingLF    = "LF"
+	lineEndingCRLF  = "CRLF"
+	lineEndingCR    = "CR"
+	lineEndingMixed = "Mixed"
+)
+
+var errUnsupportedEncoding = errors.New("不支持的文件编码")
+
+// 文本文件的解码结果
+type textFile struct {
+	Content    string
+	Encoding   string
+	LineEnding string
+	Hash       string
+}
+
+// 计算文件内容的哈希，用于保存时的并发修改检查
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 判断内容是否为二进制
+func isBinaryContent(data []byte) bool {
+	// UTF-16 文本中包含大量 NUL，需要先根据 BOM 排除
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		return false
+	}
+	head := data
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+
+	// 控制字符占比过高时同样视为二进制
+	control := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' && b != '\b' && b != 0x1B {
+			control++
+		}
+	}
+	return len(head) > 0 && control*10 > len(head)
+}
+
+// 检测文本编码
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return encodingUTF8BOM
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return encodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return encodingUTF16BE
+	case utf8.Valid(data):
+		return encodingUTF8
+	}
+
+	// 非 UTF-8 时尝试按 GBK 解码，能完整解码则认为是 GBK
+	// 解码器遇到非法字节会替换为 U+FFFD 而不是返回错误
+	if decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data); err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+		return encodingGBK
+	}
+	return ""
+}
+
+// 检测换行符风格
+func detectLineEnding(content string) string {
+	crlf := strings.Count(content, "\r\n")
+	lf := strings.Count(content, "\n") - crlf
+	cr := strings.Count(content, "\r") - crlf
+
+	kinds := 0
+	result := lineEndingLF
+	if lf > 0 {
+		kinds++
+	}
+	if crlf > 0 {
+		kinds++
+		result = lineEndingCRLF
+	}
+	if cr > 0 {
+		kinds++
+		result = lineEndingCR
+	}
+	if kinds > 1 {
+		return lineEndingMixed
+	}
+	return result
+}
+
+// 按名称获取编码器，UTF-8 返回 nil
+func textEncoding(name string) (encoding.Encoding, error) {
+	switch name {
+	case encodingUTF8, encodingUTF8BOM:
+		return nil, nil
+	case encodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), nil
+	case encodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), nil
+	case encodingGBK:
+		return simplifiedchinese.GBK, nil
+	}
+	return nil, errUnsupportedEncoding
+}
+
+// 解码文本文件内容
+func decodeTextFile(data []byte) (*textFile, error) {
+	name := detectEncoding(data)
+	if name == "" {
+		return nil, errUnsupportedEncoding
+	}
+
+	content := string(data)
+	enc, _ := textEncoding(name)
+	switch {
+	case name == encodingUTF8BOM:
+		content = string(data[3:])
+	case enc != nil:
+		decoded, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, err
+		}
+		content = string(decoded)
+	}
+
+	return &textFile{
+		Content:    content,
+		Encoding:   name,
+		LineEnding: detectLineEnding(content),
+		Hash:       contentHash(data),
+	}, nil
+}
+
+// 按指定换行符和编码将编辑器内容转换为文件字节
+func encodeTextFile(content, encodingName, lineEnding string) ([]byte, error) {
+	switch lineEnding {
+	case lineEndingLF, lineEndingCRLF, lineEndingCR:
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		content = strings.ReplaceAll(content, "\r", "\n")
+		if lineEnding == lineEndingCRLF {
+			content = strings.ReplaceAll(content, "\n", "\r\n")
+		} else if lineEnding == lineEndingCR {
+			content = strings.ReplaceAll(content, "\n", "\r")
+		}
+	}
+
+	enc, err := textEncoding(encodingName)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		if encodingName == encodingUTF8BOM {
+			return append([]byte{0xEF, 0xBB, 0xBF}, content...), nil
+		}
+		return []byte(content), nil
+	}
+	return enc.NewEncoder().Bytes([]byte(content))
+}
+
+// 原子写入文件：写临时文件后重命名，并保留原文件的权限和属主
+func writeFileAtomic(path string, data []byte, original os.FileInfo) error {
+	mode := os.FileMode(0644)
+	if original != nil {
+		mode = original.Mode().Perm() | original.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// 先修改属主再修改权限，chown 会清除 setuid/setgid 位
+	if original != nil {
+		if stat, ok := original.Sys().(*syscall.Stat_t); ok {
+			if err := os.Lchown(tmpPath, int(stat.Uid), int(stat.Gid)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
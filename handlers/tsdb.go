@@ -0,0 +1,550 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 时序数据存储
+//
+// 每个精度（1m/5m/1h）一个目录，按天切分为只追加的段文件 YYYYMMDD.seg。
+// 每条记录的格式为：
+//
+//	int64  Unix 秒（小端）
+//	uint16 值的个数 n
+//	n × (uint16 序列ID, float32 值)
+//
+// 序列名称到ID的映射保存在 series.json 中。写入中断会在段文件末尾留下残缺的记录，
+// 打开存储时将段文件截断到最后一条完整的记录，避免之后追加的记录无法解析。
+
+const (
+	metricsDataDir = "data/metrics"
+	// 单次查询最多返回的时间点数
+	maxQueryPoints = 5000
+)
+
+// 用作无上限的结束时间
+var farFuture = time.Unix(1<<40, 0)
+
+type metricTier struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+	// 最后写入的数据点时间
+	last time.Time
+}
+
+// 默认的存储精度，后一级由前一级汇总而来
+var defaultMetricTiers = []*metricTier{
+	{Name: "1m", Step: time.Minute, Retention: 7 * 24 * time.Hour},
+	{Name: "5m", Step: 5 * time.Minute, Retention: 90 * 24 * time.Hour},
+	{Name: "1h", Step: time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+}
+
+// MetricPoint 某一时刻的一组序列值
+type MetricPoint struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// MetricStore 磁盘上的时序存储
+type MetricStore struct {
+	mu        sync.Mutex
+	dir       string
+	tiers     []*metricTier
+	seriesIDs map[string]uint16
+	names     []string
+	lastPrune time.Time
+}
+
+// 打开（或新建）时序存储
+func openMetricStore(dir string) (*MetricStore, error) {
+	s := &MetricStore{
+		dir:       dir,
+		seriesIDs: make(map[string]uint16),
+	}
+	for _, t := range defaultMetricTiers {
+		tier := *t
+		s.tiers = append(s.tiers, &tier)
+		if err := os.MkdirAll(filepath.Join(dir, tier.Name), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "series.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &s.names); err != nil {
+			return nil, fmt.Errorf("解析序列索引失败: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	for i, name := range s.names {
+		s.seriesIDs[name] = uint16(i)
+	}
+
+	for _, tier := range s.tiers {
+		files, _ := filepath.Glob(filepath.Join(dir, tier.Name, "*.seg"))
+		for _, f := range files {
+			if err := repairSegment(f); err != nil {
+				return nil, fmt.Errorf("修复段文件 %s 失败: %v", f, err)
+			}
+		}
+		tier.last = s.lastPointTime(tier)
+	}
+	return s, nil
+}
+
+// 返回段数据中最后一条完整记录的结束位置
+func completeRecordsEnd(data []byte) int {
+	end := 0
+	for len(data)-end >= 10 {
+		n := int(binary.LittleEndian.Uint16(data[end+8:]))
+		size := 10 + n*6
+		if len(data)-end < size {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+// 截断段文件末尾的残缺记录
+func repairSegment(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if end := completeRecordsEnd(data); end < len(data) {
+		slog.Warn("截断时序数据段文件中的残缺记录", "path", path, "bytes", len(data)-end)
+		return os.Truncate(path, int64(end))
+	}
+	return nil
+}
+
+// 获取序列ID，新序列会写入索引
+func (s *MetricStore) seriesID(name string) (uint16, error) {
+	if id, ok := s.seriesIDs[name]; ok {
+		return id, nil
+	}
+	if len(s.names) >= math.MaxUint16 {
+		return 0, errors.New("序列数量超出上限")
+	}
+
+	id := uint16(len(s.names))
+	s.names = append(s.names, name)
+	s.seriesIDs[name] = id
+
+	data, err := json.Marshal(s.names)
+	if err != nil {
+		return 0, err
+	}
+	tmp := filepath.Join(s.dir, "series.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return 0, err
+	}
+	return id, os.Rename(tmp, filepath.Join(s.dir, "series.json"))
+}
+
+func (s *MetricStore) segmentPath(tier *metricTier, day time.Time) string {
+	return filepath.Join(s.dir, tier.Name, day.UTC().Format("20060102")+".seg")
+}
+
+// 编码一条记录
+func (s *MetricStore) encodePoint(t time.Time, values map[string]float64) ([]byte, error) {
+	// 按名称排序，保证相同输入得到相同输出
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, t.Unix())
+	binary.Write(&buf, binary.LittleEndian, uint16(len(names)))
+	for _, name := range names {
+		id, err := s.seriesID(name)
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.LittleEndian, id)
+		binary.Write(&buf, binary.LittleEndian, float32(values[name]))
+	}
+	return buf.Bytes(), nil
+}
+
+// 写入一个数据点到指定精度
+func (s *MetricStore) appendTier(tier *metricTier, t time.Time, values map[string]float64) error {
+	if len(values) == 0 {
+		return nil
+	}
+	record, err := s.encodePoint(t, values)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.segmentPath(tier, t), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(record); err != nil {
+		// 磁盘已满等情况下可能只写入了一部分，截断以免影响之后的记录
+		f.Truncate(info.Size())
+		return err
+	}
+	if t.After(tier.last) {
+		tier.last = t
+	}
+	return nil
+}
+
+// 读取一个段文件中 [start, end) 范围内的数据点
+func (s *MetricStore) readSegment(path string, start, end time.Time, filter func(string) bool) ([]MetricPoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var points []MetricPoint
+	r := bytes.NewReader(data)
+	for {
+		var ts int64
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &ts); err != nil {
+			break
+		}
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			break
+		}
+		if r.Len() < int(n)*6 {
+			// 尚未修复的残缺记录
+			break
+		}
+
+		t := time.Unix(ts, 0)
+		inRange := !t.Before(start) && t.Before(end)
+		if !inRange {
+			r.Seek(int64(n)*6, io.SeekCurrent)
+			continue
+		}
+
+		point := MetricPoint{Time: t, Values: make(map[string]float64, n)}
+		for i := 0; i < int(n); i++ {
+			var id uint16
+			var v float32
+			binary.Read(r, binary.LittleEndian, &id)
+			binary.Read(r, binary.LittleEndian, &v)
+			if int(id) >= len(s.names) {
+				continue
+			}
+			name := s.names[id]
+			if filter == nil || filter(name) {
+				point.Values[name] = float64(v)
+			}
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// 读取指定精度在 [start, end) 范围内的数据点
+func (s *MetricStore) readRange(tier *metricTier, start, end time.Time, filter func(string) bool) ([]MetricPoint, error) {
+	// 超出保留期限或未来的段文件不存在，不必逐天查找
+	if oldest := time.Now().Add(-tier.Retention - 24*time.Hour); start.Before(oldest) {
+		start = oldest
+	}
+	if latest := time.Now().Add(24 * time.Hour); end.After(latest) {
+		end = latest
+	}
+	var points []MetricPoint
+	day := time.Date(start.UTC().Year(), start.UTC().Month(), start.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		segment, err := s.readSegment(s.segmentPath(tier, day), start, end, filter)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, segment...)
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	return points, nil
+}
+
+// 查找某个精度最后一个数据点的时间
+func (s *MetricStore) lastPointTime(tier *metricTier) time.Time {
+	files, _ := filepath.Glob(filepath.Join(s.dir, tier.Name, "*.seg"))
+	sort.Strings(files)
+	for i := len(files) - 1; i >= 0; i-- {
+		points, err := s.readSegment(files[i], time.Unix(0, 0), farFuture, func(string) bool { return false })
+		if err == nil && len(points) > 0 {
+			last := points[0].Time
+			for _, p := range points {
+				if p.Time.After(last) {
+					last = p.Time
+				}
+			}
+			return last
+		}
+	}
+	return time.Time{}
+}
+
+// 对一组数据点按序列取平均值
+func averagePoints(points []MetricPoint) map[string]float64 {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, p := range points {
+		for name, v := range p.Values {
+			sums[name] += v
+			counts[name]++
+		}
+	}
+	for name := range sums {
+		sums[name] /= float64(counts[name])
+	}
+	return sums
+}
+
+// 将上一级精度中已完整的时间段汇总写入下一级
+func (s *MetricStore) rollup(index int, until time.Time) error {
+	tier := s.tiers[index]
+	source := s.tiers[index-1]
+
+	// 只汇总已结束的时间段
+	end := until.Truncate(tier.Step)
+	start := tier.last.Add(tier.Step)
+	if tier.last.IsZero() {
+		// 新建的存储从源数据的第一个完整时间段开始
+		start = end.Add(-source.Retention).Truncate(tier.Step)
+	}
+	if !start.Before(end) {
+		return nil
+	}
+
+	points, err := s.readRange(source, start, end, nil)
+	if err != nil {
+		return err
+	}
+
+	var bucket []MetricPoint
+	bucketStart := time.Time{}
+	flush := func() error {
+		if len(bucket) == 0 {
+			return nil
+		}
+		err := s.appendTier(tier, bucketStart, averagePoints(bucket))
+		bucket = bucket[:0]
+		return err
+	}
+	for _, p := range points {
+		b := p.Time.Truncate(tier.Step)
+		if !b.Equal(bucketStart) {
+			if err := flush(); err != nil {
+				return err
+			}
+			bucketStart = b
+		}
+		bucket = append(bucket, p)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// 即使没有数据也推进进度，避免重复扫描
+	if last := end.Add(-tier.Step); last.After(tier.last) {
+		tier.last = last
+	}
+	return nil
+}
+
+// 删除超过保留期限的段文件
+func (s *MetricStore) prune(now time.Time) {
+	for _, tier := range s.tiers {
+		cutoff := now.Add(-tier.Retention).UTC().Format("20060102")
+		files, _ := filepath.Glob(filepath.Join(s.dir, tier.Name, "*.seg"))
+		for _, f := range files {
+			if strings.TrimSuffix(filepath.Base(f), ".seg") < cutoff {
+				os.Remove(f)
+			}
+		}
+	}
+}
+
+// Append 写入一个原始数据点，并更新各级汇总
+func (s *MetricStore) Append(t time.Time, values map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendTier(s.tiers[0], t, values); err != nil {
+		return err
+	}
+	for i := 1; i < len(s.tiers); i++ {
+		if err := s.rollup(i, t); err != nil {
+			return err
+		}
+	}
+
+	if time.Since(s.lastPrune) > time.Hour {
+		s.prune(t)
+		s.lastPrune = time.Now()
+	}
+	return nil
+}
+
+// Import 批量导入原始数据点（用于迁移旧数据）
+func (s *MetricStore) Import(points []MetricPoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	for _, p := range points {
+		if !p.Time.After(s.tiers[0].last) {
+			continue
+		}
+		if err := s.appendTier(s.tiers[0], p.Time, p.Values); err != nil {
+			return err
+		}
+	}
+	for i := 1; i < len(s.tiers); i++ {
+		if err := s.rollup(i, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeriesNames 返回所有已知的序列名称
+func (s *MetricStore) SeriesNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := append([]string(nil), s.names...)
+	sort.Strings(names)
+	return names
+}
+
+// MetricQueryResult 查询结果，按 step 对齐，缺失的值为 null
+type MetricQueryResult struct {
+	Tier       string                `json:"tier"`
+	Step       int64                 `json:"step"` // 秒
+	Start      int64                 `json:"start"`
+	End        int64                 `json:"end"`
+	Timestamps []int64               `json:"timestamps"` // Unix 毫秒
+	Series     map[string][]*float64 `json:"series"`
+}
+
+// 构造序列过滤器，以 * 结尾的名称按前缀匹配
+func seriesFilter(patterns []string) func(string) bool {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return func(name string) bool {
+		for _, p := range patterns {
+			if strings.HasSuffix(p, "*") {
+				if strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+					return true
+				}
+			} else if name == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Query 查询 [start, end) 范围内的序列，按 step 取平均值
+func (s *MetricStore) Query(start, end time.Time, step time.Duration, patterns []string) (*MetricQueryResult, error) {
+	if !start.Before(end) {
+		return nil, errors.New("结束时间必须晚于开始时间")
+	}
+	// 早于最长保留期限的数据已被删除，也不会有未来的数据，同时避免时间跨度溢出
+	if oldest := time.Now().Add(-s.tiers[len(s.tiers)-1].Retention); start.Before(oldest) {
+		start = oldest
+	}
+	if latest := time.Now().Add(24 * time.Hour); end.After(latest) {
+		end = latest
+	}
+	if !start.Before(end) {
+		return nil, errors.New("查询的时间范围超出数据保留期限")
+	}
+	if step <= 0 {
+		step = end.Sub(start) / 300
+	}
+	if minStep := end.Sub(start) / maxQueryPoints; step < minStep {
+		step = minStep
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 选择不超过 step 的最粗精度；更细的精度已不覆盖开始时间时也改用更粗的精度
+	tier := s.tiers[0]
+	for _, t := range s.tiers[1:] {
+		if t.Step <= step || time.Since(start) > tier.Retention {
+			tier = t
+		}
+	}
+	if step < tier.Step {
+		step = tier.Step
+	}
+	step = step.Round(tier.Step)
+
+	start = start.Truncate(step)
+	points, err := s.readRange(tier, start, end, seriesFilter(patterns))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MetricQueryResult{
+		Tier:   tier.Name,
+		Step:   int64(step / time.Second),
+		Start:  start.Unix(),
+		End:    end.Unix(),
+		Series: make(map[string][]*float64),
+	}
+	buckets := int((end.Sub(start) + step - 1) / step)
+	for i := 0; i < buckets; i++ {
+		result.Timestamps = append(result.Timestamps, start.Add(time.Duration(i)*step).UnixMilli())
+	}
+
+	// 按时间段分组求平均
+	grouped := make([][]MetricPoint, buckets)
+	for _, p := range points {
+		i := int(p.Time.Sub(start) / step)
+		if i >= 0 && i < buckets {
+			grouped[i] = append(grouped[i], p)
+		}
+	}
+	for i, group := range grouped {
+		for name, v := range averagePoints(group) {
+			values, ok := result.Series[name]
+			if !ok {
+				values = make([]*float64, buckets)
+				result.Series[name] = values
+			}
+			v := v
+			values[i] = &v
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,626 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 面板创建的单元文件和 drop-in 的安装目录
+	systemdUnitDir = "/etc/systemd/system"
+	// 保存单元构建参数，用于再次编辑
+	unitSpecDir = "data/units"
+	// drop-in 文件的最大长度
+	maxDropInSize = 64 * 1024
+)
+
+var (
+	// 依赖中允许引用的单元名
+	unitRefPattern     = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+\.(service|target|socket|mount|path|timer|device|slice|scope|swap|automount)$`)
+	dropInNamePattern  = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	envKeyPattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	accountNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+	memoryLimitPattern = regexp.MustCompile(`^(\d+[KMGT]?|\d+%|infinity)$`)
+	cpuQuotaPattern    = regexp.MustCompile(`^\d+%$`)
+	rlimitPattern      = regexp.MustCompile(`^(\d+|infinity)(:(\d+|infinity))?$`)
+	tasksMaxPattern    = regexp.MustCompile(`^(\d+%?|infinity)$`)
+	sectionPattern     = regexp.MustCompile(`^\[[A-Za-z]+\]$`)
+	directivePattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*\s*=`)
+)
+
+var serviceTypes = map[string]bool{
+	"simple": true, "exec": true, "forking": true, "oneshot": true, "notify": true, "idle": true,
+}
+
+var restartPolicies = map[string]bool{
+	"no": true, "always": true, "on-success": true, "on-failure": true,
+	"on-abnormal": true, "on-abort": true, "on-watchdog": true,
+}
+
+// UnitSpec 单元构建参数
+type UnitSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// [Unit] 依赖
+	After    []string `json:"after,omitempty"`
+	Wants    []string `json:"wants,omitempty"`
+	Requires []string `json:"requires,omitempty"`
+
+	// [Service]
+	Type             string            `json:"type,omitempty"` // 默认 simple
+	ExecStart        string            `json:"execStart"`
+	ExecStartPre     []string          `json:"execStartPre,omitempty"`
+	ExecReload       string            `json:"execReload,omitempty"`
+	ExecStop         string            `json:"execStop,omitempty"`
+	User             string            `json:"user,omitempty"`
+	Group            string            `json:"group,omitempty"`
+	WorkingDirectory string            `json:"workingDirectory,omitempty"`
+	Environment      map[string]string `json:"environment,omitempty"`
+	EnvironmentFile  string            `json:"environmentFile,omitempty"`
+	Restart          string            `json:"restart,omitempty"`    // 默认 on-failure
+	RestartSec       int               `json:"restartSec,omitempty"` // 秒
+	MemoryMax        string            `json:"memoryMax,omitempty"`  // 如 512M、50%
+	CPUQuota         string            `json:"cpuQuota,omitempty"`   // 如 150%
+	LimitNOFILE      string            `json:"limitNofile,omitempty"`
+	TasksMax         string            `json:"tasksMax,omitempty"`
+
+	// [Install]，默认 multi-user.target
+	WantedBy []string `json:"wantedBy,omitempty"`
+}
+
+// 单行值中不允许出现换行，否则可以注入额外的配置项
+func singleLine(field, value string) error {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("%s 不能包含换行", field)
+	}
+	return nil
+}
+
+// 命令必须以绝对路径开头，允许 systemd 的 -、@、+ 等前缀
+func validateExecLine(field, line string) error {
+	if err := singleLine(field, line); err != nil {
+		return err
+	}
+	cmd := strings.TrimLeft(strings.TrimSpace(line), "-@:+!")
+	if cmd == "" {
+		return fmt.Errorf("%s 不能为空", field)
+	}
+	if !strings.HasPrefix(cmd, "/") {
+		return fmt.Errorf("%s 必须以可执行文件的绝对路径开头", field)
+	}
+	return nil
+}
+
+// 校验并补全默认值
+func (s *UnitSpec) normalize() error {
+	name, ok := normalizeServiceName(s.Name)
+	if !ok || strings.Contains(name, "@.") {
+		return errors.New("无效的服务名")
+	}
+	s.Name = name
+
+	if s.Type == "" {
+		s.Type = "simple"
+	}
+	if !serviceTypes[s.Type] {
+		return errors.New("无效的服务类型")
+	}
+	if s.Restart == "" {
+		s.Restart = "on-failure"
+	}
+	if !restartPolicies[s.Restart] {
+		return errors.New("无效的重启策略")
+	}
+	if s.RestartSec < 0 || s.RestartSec > 3600 {
+		return errors.New("重启间隔必须在0到3600秒之间")
+	}
+	if s.Description == "" {
+		s.Description = strings.TrimSuffix(s.Name, ".service")
+	}
+	if len(s.WantedBy) == 0 {
+		s.WantedBy = []string{"multi-user.target"}
+	}
+
+	if err := singleLine("Description", s.Description); err != nil {
+		return err
+	}
+	if err := validateExecLine("ExecStart", s.ExecStart); err != nil {
+		return err
+	}
+	for _, line := range s.ExecStartPre {
+		if err := validateExecLine("ExecStartPre", line); err != nil {
+			return err
+		}
+	}
+	if s.ExecReload != "" {
+		if err := validateExecLine("ExecReload", s.ExecReload); err != nil {
+			return err
+		}
+	}
+	if s.ExecStop != "" {
+		if err := validateExecLine("ExecStop", s.ExecStop); err != nil {
+			return err
+		}
+	}
+
+	for field, value := range map[string]string{"User": s.User, "Group": s.Group} {
+		if value != "" && !accountNamePattern.MatchString(value) {
+			return fmt.Errorf("无效的 %s", field)
+		}
+	}
+	for field, value := range map[string]string{"WorkingDirectory": s.WorkingDirectory, "EnvironmentFile": s.EnvironmentFile} {
+		if value == "" {
+			continue
+		}
+		if err := singleLine(field, value); err != nil {
+			return err
+		}
+		if !filepath.IsAbs(strings.TrimPrefix(value, "-")) {
+			return fmt.Errorf("%s 必须是绝对路径", field)
+		}
+	}
+	for key, value := range s.Environment {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("无效的环境变量名: %s", key)
+		}
+		if err := singleLine("Environment", value); err != nil {
+			return err
+		}
+	}
+
+	limits := []struct {
+		field, value string
+		pattern      *regexp.Regexp
+	}{
+		{"MemoryMax", s.MemoryMax, memoryLimitPattern},
+		{"CPUQuota", s.CPUQuota, cpuQuotaPattern},
+		{"LimitNOFILE", s.LimitNOFILE, rlimitPattern},
+		{"TasksMax", s.TasksMax, tasksMaxPattern},
+	}
+	for _, l := range limits {
+		if l.value != "" && !l.pattern.MatchString(l.value) {
+			return fmt.Errorf("无效的 %s: %s", l.field, l.value)
+		}
+	}
+
+	for field, units := range map[string][]string{
+		"After": s.After, "Wants": s.Wants, "Requires": s.Requires, "WantedBy": s.WantedBy,
+	} {
+		for _, u := range units {
+			if !unitRefPattern.MatchString(u) {
+				return fmt.Errorf("%s 中的单元名无效: %s", field, u)
+			}
+		}
+	}
+	return nil
+}
+
+// 环境变量值需要加引号，并转义引号和反斜杠；% 说明符在写入时统一转义
+func quoteUnitEnvironment(key, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(key+"="+value) + `"`
+}
+
+// 生成单元文件内容。所有值中的 % 都转义为 %%，避免被 systemd 当作说明符展开
+func (s *UnitSpec) render() []byte {
+	var b strings.Builder
+	line := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s=%s\n", key, strings.ReplaceAll(value, "%", "%%"))
+		}
+	}
+
+	b.WriteString("# 由面板生成，手动修改后再次通过面板保存会被覆盖\n")
+	b.WriteString("[Unit]\n")
+	line("Description", s.Description)
+	line("After", strings.Join(s.After, " "))
+	line("Wants", strings.Join(s.Wants, " "))
+	line("Requires", strings.Join(s.Requires, " "))
+
+	b.WriteString("\n[Service]\n")
+	line("Type", s.Type)
+	line("User", s.User)
+	line("Group", s.Group)
+	line("WorkingDirectory", s.WorkingDirectory)
+	keys := make([]string, 0, len(s.Environment))
+	for key := range s.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line("Environment", quoteUnitEnvironment(key, s.Environment[key]))
+	}
+	line("EnvironmentFile", s.EnvironmentFile)
+	for _, pre := range s.ExecStartPre {
+		line("ExecStartPre", pre)
+	}
+	line("ExecStart", s.ExecStart)
+	line("ExecReload", s.ExecReload)
+	line("ExecStop", s.ExecStop)
+	line("Restart", s.Restart)
+	if s.RestartSec > 0 {
+		line("RestartSec", fmt.Sprintf("%d", s.RestartSec))
+	}
+	line("MemoryMax", s.MemoryMax)
+	line("CPUQuota", s.CPUQuota)
+	line("LimitNOFILE", s.LimitNOFILE)
+	line("TasksMax", s.TasksMax)
+
+	b.WriteString("\n[Install]\n")
+	line("WantedBy", strings.Join(s.WantedBy, " "))
+	return []byte(b.String())
+}
+
+func unitSpecPath(name string) string {
+	return filepath.Join(unitSpecDir, name+".json")
+}
+
+// 读取面板保存的构建参数，单元不是由面板创建时返回 nil
+func loadUnitSpec(name string) *UnitSpec {
+	data, err := os.ReadFile(unitSpecPath(name))
+	if err != nil {
+		return nil
+	}
+	var spec UnitSpec
+	if json.Unmarshal(data, &spec) != nil {
+		return nil
+	}
+	return &spec
+}
+
+func saveUnitSpec(spec *UnitSpec) error {
+	if err := os.MkdirAll(unitSpecDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(unitSpecPath(spec.Name), data, 0600)
+}
+
+// 写入单元文件或 drop-in，覆盖前保存历史版本
+func installUnitFile(path string, data []byte) error {
+	original, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if original != nil {
+		if _, err := snapshotFile(path, "面板更新单元前自动备份"); err != nil {
+			slog.Warn("保存历史版本失败", "path", path, "error", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, original)
+}
+
+// 处理单元文件读取请求，参数 name 为服务名
+//
+// 返回单元文件内容、面板保存的构建参数（如有）以及 /etc/systemd/system 下的 drop-in 列表。
+func HandleServiceUnitGet(c *gin.Context) {
+	name, ok := normalizeServiceName(c.Query("name"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务名"})
+		return
+	}
+
+	path := filepath.Join(systemdUnitDir, name)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), systemdCallTimeout)
+	defer cancel()
+	if conn, err := systemdConnection(ctx); err == nil {
+		if props, err := conn.GetUnitPropertiesContext(ctx, name); err == nil {
+			if fragment := propString(props, "FragmentPath"); fragment != "" {
+				path = fragment
+			}
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil && loadUnitSpec(name) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "服务不存在"})
+		return
+	}
+
+	dropIns := []gin.H{}
+	files, _ := filepath.Glob(filepath.Join(systemdUnitDir, name+".d", "*.conf"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		dropIns = append(dropIns, gin.H{
+			"name":    strings.TrimSuffix(filepath.Base(f), ".conf"),
+			"path":    f,
+			"content": string(data),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":    name,
+		"path":    path,
+		"content": string(content),
+		"spec":    loadUnitSpec(name),
+		"dropIns": dropIns,
+	})
+}
+
+// 处理单元构建请求
+//
+// 请求体：spec 为构建参数；dryRun 为 true 时只生成并校验内容；
+// overwrite 为 true 时允许覆盖 /etc/systemd/system 下已有的同名单元；
+// enable、start 为 true 时安装后启用、启动服务，服务已在运行时改为重启。
+// 已存在于其他目录（如软件包提供）的服务不能覆盖，请改用 drop-in。
+func HandleServiceUnitSave(c *gin.Context) {
+	var req struct {
+		Spec      UnitSpec `json:"spec"`
+		DryRun    bool     `json:"dryRun"`
+		Overwrite bool     `json:"overwrite"`
+		Enable    bool     `json:"enable"`
+		Start     bool     `json:"start"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	spec := &req.Spec
+	if err := spec.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	path := filepath.Join(systemdUnitDir, spec.Name)
+	data := spec.render()
+	validation, err := validateFileContent(path, data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "单元文件校验失败: " + err.Error(),
+			"content":    string(data),
+			"validation": validation,
+		})
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"path": path, "content": string(data), "validation": validation})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), serviceJobTimeout+systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+
+	// 检查同名单元
+	existing, err := serviceUnitStatus(ctx, conn, spec.Name)
+	if err != nil && err != errServiceNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if existing != nil && existing.FragmentPath != "" && existing.FragmentPath != path {
+		c.JSON(http.StatusConflict, gin.H{"error": "已存在同名服务: " + existing.FragmentPath + "，请使用 drop-in 修改"})
+		return
+	}
+	if _, err := os.Stat(path); err == nil && !req.Overwrite {
+		c.JSON(http.StatusConflict, gin.H{"error": "单元文件已存在: " + path})
+		return
+	}
+
+	if err := installUnitFile(path, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入单元文件失败: " + err.Error()})
+		return
+	}
+	if err := saveUnitSpec(spec); err != nil {
+		slog.WarnContext(ctx, "保存单元参数失败", "unit", spec.Name, "error", err)
+	}
+	if err := conn.ReloadContext(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新加载 systemd 配置失败: " + err.Error()})
+		return
+	}
+
+	result := ""
+	if req.Enable {
+		if err := changeServiceUnitFile(ctx, conn, spec.Name, "enable"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "启用服务失败: " + err.Error()})
+			return
+		}
+	}
+	if req.Start {
+		action := "start"
+		if existing != nil && existing.ActiveState == "active" {
+			action = "restart"
+		}
+		result, err = runServiceJob(ctx, conn, spec.Name, action)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "启动服务失败: " + err.Error()})
+			return
+		}
+	}
+
+	unit, _ := serviceUnitStatus(ctx, conn, spec.Name)
+	if result != "" && result != "done" && result != "running" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  fmt.Sprintf("单元已安装，但启动失败（%s），请查看服务日志", result),
+			"path":   path,
+			"result": result,
+			"unit":   unit,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "单元已安装",
+		"path":       path,
+		"content":    string(data),
+		"validation": validation,
+		"result":     result,
+		"unit":       unit,
+	})
+}
+
+// 基本的语法检查：每行必须是注释、段名或 键=值，且至少包含一个段
+func validateDropIn(content string) error {
+	if len(content) > maxDropInSize {
+		return errors.New("内容过长")
+	}
+	if strings.ContainsRune(content, 0) {
+		return errors.New("内容包含无效字符")
+	}
+	hasSection := false
+	continued := false
+	for i, raw := range strings.Split(content, "\n") {
+		line := strings.TrimSpace(raw)
+		if continued {
+			continued = strings.HasSuffix(line, `\`)
+			continue
+		}
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case sectionPattern.MatchString(line):
+			hasSection = true
+		case directivePattern.MatchString(line):
+			if !hasSection {
+				return fmt.Errorf("第 %d 行：配置项必须位于段内", i+1)
+			}
+			continued = strings.HasSuffix(line, `\`)
+		default:
+			return fmt.Errorf("第 %d 行：无法解析", i+1)
+		}
+	}
+	if !hasSection {
+		return errors.New("缺少段名，如 [Service]")
+	}
+	return nil
+}
+
+// 处理 drop-in 保存请求
+//
+// 请求体：name 为服务名；dropIn 为文件名（不含 .conf），默认 override；content 为内容；
+// restart 为 true 时保存后重启服务（服务未运行时不启动）。
+func HandleServiceDropInSave(c *gin.Context) {
+	var req struct {
+		Name    string `json:"name"`
+		DropIn  string `json:"dropIn"`
+		Content string `json:"content"`
+		Restart bool   `json:"restart"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	name, ok := normalizeServiceName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务名"})
+		return
+	}
+	if req.DropIn == "" {
+		req.DropIn = "override"
+	}
+	if !dropInNamePattern.MatchString(req.DropIn) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 drop-in 名称"})
+		return
+	}
+	if err := validateDropIn(req.Content); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "drop-in 校验失败: " + err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), serviceJobTimeout+systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+	unit, err := serviceUnitStatus(ctx, conn, name)
+	if err == errServiceNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	content := req.Content
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	path := filepath.Join(systemdUnitDir, name+".d", req.DropIn+".conf")
+	if err := installUnitFile(path, []byte(content)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入 drop-in 失败: " + err.Error()})
+		return
+	}
+	if err := conn.ReloadContext(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新加载 systemd 配置失败: " + err.Error()})
+		return
+	}
+
+	result := ""
+	if req.Restart && unit.ActiveState == "active" {
+		if result, err = runServiceJob(ctx, conn, name, "restart"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "重启服务失败: " + err.Error()})
+			return
+		}
+	}
+	unit, _ = serviceUnitStatus(ctx, conn, name)
+	c.JSON(http.StatusOK, gin.H{"message": "drop-in 已保存", "path": path, "result": result, "unit": unit})
+}
+
+// 处理 drop-in 删除请求，参数 name 为服务名，dropIn 为文件名（不含 .conf）
+func HandleServiceDropInDelete(c *gin.Context) {
+	name, ok := normalizeServiceName(c.Query("name"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务名"})
+		return
+	}
+	dropIn := c.Query("dropIn")
+	if !dropInNamePattern.MatchString(dropIn) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 drop-in 名称"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), systemdCallTimeout)
+	defer cancel()
+	conn, ok := systemdFromRequest(c, ctx)
+	if !ok {
+		return
+	}
+
+	path := filepath.Join(systemdUnitDir, name+".d", dropIn+".conf")
+	if _, err := snapshotFile(path, "删除 drop-in 前自动备份"); err != nil && !os.IsNotExist(err) {
+		slog.Warn("保存历史版本失败", "path", path, "error", err)
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "drop-in 不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 目录为空时一并删除
+	os.Remove(filepath.Dir(path))
+
+	if err := conn.ReloadContext(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重新加载 systemd 配置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "drop-in 已删除"})
+}
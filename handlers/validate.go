@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v2"
+)
+
+// 单个校验器的最长执行时间
+const validatorTimeout = 30 * time.Second
+
+// 校验所需的外部命令不存在时返回该错误，此时跳过校验
+var errValidatorUnavailable = errors.New("校验工具不可用")
+
+// FileValidator 配置文件校验器
+type FileValidator struct {
+	Name string
+	// 匹配的路径模式：包含 / 时匹配完整路径，否则只匹配文件名
+	Patterns []string
+	// 校验待保存的内容，返回校验输出；校验不通过时返回错误
+	Validate func(ctx context.Context, path string, data []byte) (string, error)
+}
+
+// ValidationResult 校验结果
+type ValidationResult struct {
+	Validator string `json:"validator"`
+	Passed    bool   `json:"passed"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Output    string `json:"output,omitempty"`
+}
+
+var fileValidators []FileValidator
+
+// RegisterFileValidator 注册配置文件校验器
+func RegisterFileValidator(v FileValidator) {
+	fileValidators = append(fileValidators, v)
+}
+
+func init() {
+	RegisterFileValidator(FileValidator{
+		Name:     "nginx",
+		Patterns: []string{"/etc/nginx/nginx.conf", "/usr/local/nginx/conf/nginx.conf"},
+		Validate: validateNginxMain,
+	})
+	RegisterFileValidator(FileValidator{
+		Name: "nginx-include",
+		Patterns: []string{
+			"/etc/nginx/conf.d/*.conf",
+			"/etc/nginx/sites-available/*",
+			"/etc/nginx/sites-enabled/*",
+		},
+		Validate: validateNginxInclude,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "sshd",
+		Patterns: []string{"/etc/ssh/sshd_config", "/etc/ssh/sshd_config.d/*.conf"},
+		Validate: validateSSHD,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "sudoers",
+		Patterns: []string{"/etc/sudoers", "/etc/sudoers.d/*"},
+		Validate: validateSudoers,
+	})
+	RegisterFileValidator(FileValidator{
+		Name: "systemd",
+		Patterns: []string{
+			"/etc/systemd/system/*.service", "/etc/systemd/system/*.timer",
+			"/etc/systemd/system/*.socket", "/etc/systemd/system/*.mount",
+			"/etc/systemd/system/*.path", "/etc/systemd/system/*.target",
+			"/lib/systemd/system/*.service", "/usr/lib/systemd/system/*.service",
+		},
+		Validate: validateSystemdUnit,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "crontab",
+		Patterns: []string{"/etc/crontab", "/etc/cron.d/*"},
+		Validate: validateSystemCrontab,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "json",
+		Patterns: []string{"*.json"},
+		Validate: validateJSON,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "yaml",
+		Patterns: []string{"*.yaml", "*.yml"},
+		Validate: validateYAML,
+	})
+	RegisterFileValidator(FileValidator{
+		Name:     "toml",
+		Patterns: []string{"*.toml"},
+		Validate: validateTOML,
+	})
+}
+
+// 判断路径是否匹配校验器
+func (v *FileValidator) matches(path string) bool {
+	path = filepath.Clean(path)
+	for _, pattern := range v.Patterns {
+		target := path
+		if !strings.Contains(pattern, "/") {
+			target = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 对待保存的内容执行所有匹配的校验器，任意校验失败时返回错误
+func validateFileContent(path string, data []byte) ([]ValidationResult, error) {
+	var results []ValidationResult
+	for i := range fileValidators {
+		v := &fileValidators[i]
+		if !v.matches(path) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), validatorTimeout)
+		output, err := v.Validate(ctx, path, data)
+		cancel()
+
+		result := ValidationResult{Validator: v.Name, Output: strings.TrimSpace(output)}
+		switch {
+		case err == nil:
+			result.Passed = true
+		case errors.Is(err, errValidatorUnavailable):
+			result.Skipped = true
+			result.Passed = true
+			if result.Output == "" {
+				result.Output = err.Error()
+			}
+		default:
+			if result.Output == "" {
+				result.Output = err.Error()
+			}
+			results = append(results, result)
+			return results, fmt.Errorf("%s 校验失败", v.Name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// 在 dir 中写入临时副本，返回其路径
+func writeValidationCopy(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// 检查外部校验命令是否存在
+func requireValidatorCommand(name string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%w: 未找到 %s", errValidatorUnavailable, name)
+	}
+	return nil
+}
+
+// 执行外部校验命令
+func runValidatorCommand(ctx context.Context, name string, args ...string) (string, error) {
+	if err := requireValidatorCommand(name); err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return string(output), fmt.Errorf("校验超时")
+	}
+	return string(output), err
+}
+
+// 校验 nginx 主配置，临时副本放在原目录以保证相对路径的 include 可用
+func validateNginxMain(ctx context.Context, path string, data []byte) (string, error) {
+	if err := requireValidatorCommand("nginx"); err != nil {
+		return "", err
+	}
+	tmp, err := writeValidationCopy(filepath.Dir(path), ".gegecp-validate-*.conf", data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	return runValidatorCommand(ctx, "nginx", "-t", "-q", "-c", tmp)
+}
+
+// nginx 配置目录，include 片段的校验器只匹配该目录下的文件
+const nginxConfDir = "/etc/nginx"
+
+// 校验被 include 的片段：将配置目录镜像到临时目录并替换为待保存的内容，再用真实的主配置执行 nginx -t，
+// 这样片段中引用的 upstream、map、变量或相对路径的 include 都能正常解析
+func validateNginxInclude(ctx context.Context, path string, data []byte) (string, error) {
+	if err := requireValidatorCommand("nginx"); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(nginxConfDir, "nginx.conf")); err != nil {
+		return "", fmt.Errorf("%w: 未找到 %s", errValidatorUnavailable, filepath.Join(nginxConfDir, "nginx.conf"))
+	}
+	dir, err := os.MkdirTemp("", "gegecp-nginx-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := mirrorNginxConfig(dir, filepath.Clean(path), data); err != nil {
+		return "", err
+	}
+	return runValidatorCommand(ctx, "nginx", "-t", "-q", "-c", filepath.Join(dir, "nginx.conf"))
+}
+
+// 将 nginx 配置目录镜像到 dir：引用了配置目录绝对路径的文件复制并改写为镜像中的路径，
+// 其他文件和目录链接到原位置；candidate 的内容替换为 data
+func mirrorNginxConfig(dir, candidate string, data []byte) error {
+	candidateReal := resolvePath(candidate)
+	prefix := []byte(nginxConfDir + "/")
+	rewrite := func(content []byte) []byte {
+		return bytes.ReplaceAll(content, prefix, []byte(dir+"/"))
+	}
+	written, linked := false, false
+
+	err := filepath.WalkDir(nginxConfDir, func(src string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(nginxConfDir, src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0700)
+		}
+
+		real := src
+		if d.Type()&fs.ModeSymlink != 0 {
+			if real, err = filepath.EvalSymlinks(src); err != nil {
+				// 失效的链接原样保留，由 nginx 报告
+				target, _ := os.Readlink(src)
+				return os.Symlink(target, dst)
+			}
+			if info, err := os.Stat(real); err == nil && info.IsDir() {
+				return os.Symlink(real, dst)
+			}
+		}
+
+		if real == candidateReal {
+			written = true
+			linked = linked || real != src || isSubPath(src, filepath.Join(nginxConfDir, "sites-enabled"))
+			return os.WriteFile(dst, rewrite(data), 0600)
+		}
+		content, err := os.ReadFile(real)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(content, prefix) {
+			return os.Symlink(real, dst)
+		}
+		return os.WriteFile(dst, rewrite(content), 0600)
+	})
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(nginxConfDir, candidate)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s 不在 %s 中", candidate, nginxConfDir)
+	}
+	if !written {
+		if err := os.WriteFile(filepath.Join(dir, rel), rewrite(data), 0600); err != nil {
+			return err
+		}
+	}
+	// 未启用的站点配置按启用后的效果校验
+	if !linked && isSubPath(candidate, filepath.Join(nginxConfDir, "sites-available")) {
+		enabled := filepath.Join(dir, "sites-enabled")
+		if _, err := os.Stat(enabled); err == nil {
+			return os.WriteFile(filepath.Join(enabled, "gegecp-validate-"+filepath.Base(candidate)), rewrite(data), 0600)
+		}
+	}
+	return nil
+}
+
+func validateSSHD(ctx context.Context, path string, data []byte) (string, error) {
+	if err := requireValidatorCommand("sshd"); err != nil {
+		return "", err
+	}
+	tmp, err := writeValidationCopy("", "gegecp-sshd-*", data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	return runValidatorCommand(ctx, "sshd", "-t", "-f", tmp)
+}
+
+func validateSudoers(ctx context.Context, path string, data []byte) (string, error) {
+	if err := requireValidatorCommand("visudo"); err != nil {
+		return "", err
+	}
+	tmp, err := writeValidationCopy("", "gegecp-sudoers-*", data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	return runValidatorCommand(ctx, "visudo", "-c", "-q", "-f", tmp)
+}
+
+// systemd 根据文件名判断单元类型，临时副本需要保持原文件名
+func validateSystemdUnit(ctx context.Context, path string, data []byte) (string, error) {
+	if err := requireValidatorCommand("systemd-analyze"); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "gegecp-unit-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	unit := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(unit, data, 0644); err != nil {
+		return "", err
+	}
+
+	output, err := runValidatorCommand(ctx, "systemd-analyze", "verify", unit)
+	if err != nil {
+		return output, err
+	}
+	// 某些版本的 systemd-analyze 遇到错误时仍返回 0，只有针对该单元文件本身的错误级别输出才视为失败；
+	// 引用的其他单元的问题和警告随结果返回
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, unit+":") && isSystemdErrorLine(line) {
+			return output, errors.New("单元文件存在错误")
+		}
+	}
+	return output, nil
+}
+
+// systemd-analyze verify 的错误级别输出
+var systemdErrorMarkers = []string{
+	"failed to", "error:", "bad unit file setting", "bad-setting", "is not executable",
+}
+
+func isSystemdErrorLine(line string) bool {
+	line = strings.ToLower(line)
+	for _, marker := range systemdErrorMarkers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// crontab 中允许的 @ 描述符
+var cronDescriptors = map[string]bool{
+	"@reboot": true, "@yearly": true, "@annually": true, "@monthly": true,
+	"@weekly": true, "@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// cron 时间表达式解析器，星期字段兼容 cron 中表示周日的 7
+type cronSpecParser struct {
+	cron.Parser
+}
+
+func (p cronSpecParser) Parse(spec string) (cron.Schedule, error) {
+	return p.Parser.Parse(normalizeCronSpec(spec))
+}
+
+var cronScheduleParser = cronSpecParser{cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)}
+
+// 将星期字段中的 7 转换为 0，robfig/cron 只接受 0-6
+func normalizeCronSpec(spec string) string {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return spec
+	}
+	parts := strings.Split(fields[4], ",")
+	for i, part := range parts {
+		base, step, hasStep := strings.Cut(part, "/")
+		if base == "7" {
+			parts[i] = "0"
+			continue
+		}
+		lo, hi, isRange := strings.Cut(base, "-")
+		if !isRange || hi != "7" {
+			continue
+		}
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			continue
+		}
+		if start == 7 {
+			parts[i] = "0"
+			continue
+		}
+		n := 1
+		if hasStep {
+			if n, err = strconv.Atoi(step); err != nil || n < 1 {
+				continue
+			}
+		}
+		parts[i] = lo + "-6"
+		if hasStep {
+			parts[i] += "/" + step
+		}
+		if (7-start)%n == 0 {
+			parts[i] += ",0"
+		}
+	}
+	fields[4] = strings.Join(parts, ",")
+	return strings.Join(fields, " ")
+}
+
+// 校验 cron 时间表达式
+func validateCronSchedule(schedule string) error {
+	if schedule == "@reboot" {
+		return nil
+	}
+	if strings.HasPrefix(schedule, "@") && !cronDescriptors[schedule] {
+		return fmt.Errorf("未知的时间描述符: %s", schedule)
+	}
+	_, err := cronScheduleParser.Parse(schedule)
+	return err
+}
+
+// 校验系统 crontab 格式（包含用户字段）
+func validateSystemCrontab(ctx context.Context, path string, data []byte) (string, error) {
+	return validateCrontab(data, true)
+}
+
+// 校验 crontab 内容，userField 表示任务行是否包含用户字段
+func validateCrontab(data []byte, userField bool) (string, error) {
+	var problems []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		// 环境变量赋值
+		if strings.Contains(fields[0], "=") || (len(fields) > 1 && strings.HasPrefix(fields[1], "=")) {
+			continue
+		}
+
+		scheduleFields := 5
+		if strings.HasPrefix(fields[0], "@") {
+			scheduleFields = 1
+		}
+		if userField && len(fields) < scheduleFields+2 {
+			problems = append(problems, fmt.Sprintf("第 %d 行: 字段不足，需要时间、用户和命令", i+1))
+			continue
+		}
+		if len(fields) < scheduleFields+1 {
+			problems = append(problems, fmt.Sprintf("第 %d 行: 字段不足，需要时间和命令", i+1))
+			continue
+		}
+		schedule := strings.Join(fields[:scheduleFields], " ")
+		if err := validateCronSchedule(schedule); err != nil {
+			problems = append(problems, fmt.Sprintf("第 %d 行: %v", i+1, err))
+		}
+	}
+
+	// cron 要求文件以换行结尾，否则最后一行会被忽略
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		problems = append(problems, "文件必须以换行符结尾")
+	}
+
+	if len(problems) > 0 {
+		return strings.Join(problems, "\n"), errors.New("crontab 格式错误")
+	}
+	return "", nil
+}
+
+func validateJSON(ctx context.Context, path string, data []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return fmt.Sprintf("第 %d 行: %v", line, err), err
+		}
+		return err.Error(), err
+	}
+	return "", nil
+}
+
+func validateYAML(ctx context.Context, path string, data []byte) (string, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return err.Error(), err
+	}
+	return "", nil
+}
+
+func validateTOML(ctx context.Context, path string, data []byte) (string, error) {
+	var v interface{}
+	if err := toml.Unmarshal(data, &v); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			return decodeErr.String(), err
+		}
+		return err.Error(), err
+	}
+	return "", nil
+}
+
+// 处理配置校验请求，只校验不保存
+func HandleFileValidate(c *gin.Context) {
+	var req struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件路径不能为空"})
+		return
+	}
+
+	results, err := validateFileContent(req.Path, []byte(req.Content))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      err.Error(),
+			"validation": results,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "校验通过",
+		"validation": results,
+	})
+}
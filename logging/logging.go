@@ -0,0 +1,247 @@
+// Package logging 面板自身的结构化日志
+//
+// 日志通过 log/slog 输出，由 config.yaml 中的 system.log 配置级别、格式和轮转策略。
+// 敏感字段（密码、token 等）在输出前统一脱敏，请求相关的日志带有请求ID。
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gegecp/config"
+)
+
+const (
+	// 脱敏后的取值
+	Redacted = "******"
+
+	defaultLogDir        = "./log"
+	defaultLogMaxSize    = 100 // MB
+	defaultLogMaxBackups = 10
+	defaultLogMaxAge     = 30 // 天
+)
+
+// 键名包含这些词的字段会被脱敏
+var sensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "authorization", "cookie",
+	"apikey", "api_key", "private_key", "privatekey", "credential",
+}
+
+// 出现在任意字符串中的 Bearer token
+var bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+
+var (
+	mu       sync.Mutex
+	writer   *RotatingWriter
+	filePath string
+)
+
+type requestIDKey struct{}
+
+// WithRequestID 在 context 中记录请求ID，使用该 context 输出的日志会带上 request_id 字段
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 返回 context 中的请求ID
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// IsSensitiveKey 判断字段名是否需要脱敏
+func IsSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString 隐藏字符串中的 Bearer token
+func RedactString(s string) string {
+	return bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+}
+
+// RedactQuery 隐藏查询字符串中的敏感参数
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && IsSensitiveKey(name) {
+			pairs[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// 输出前脱敏
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		return a
+	}
+	if IsSensitiveKey(a.Key) {
+		if a.Value.Kind() == slog.KindString && a.Value.String() == "" {
+			return a
+		}
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		if s := a.Value.String(); strings.Contains(strings.ToLower(s), "bearer") {
+			return slog.String(a.Key, RedactString(s))
+		}
+	}
+	return a
+}
+
+// 为带有请求ID的 context 输出的日志添加 request_id 字段
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	// 消息本身也可能包含 token
+	if strings.Contains(strings.ToLower(r.Message), "bearer") {
+		redacted := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+		r.Attrs(func(a slog.Attr) bool {
+			redacted.AddAttrs(a)
+			return true
+		})
+		r = redacted
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if strings.EqualFold(s, "warning") {
+		return slog.LevelWarn, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Setup 根据配置初始化默认日志记录器，标准库 log 的输出也会转到该记录器
+func Setup(cfg config.LogConfig) error {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("无效的日志级别: %s", cfg.Level)
+	}
+
+	var interval time.Duration
+	if cfg.RotateInterval != "" {
+		if interval, err = time.ParseDuration(cfg.RotateInterval); err != nil || interval < time.Minute {
+			return fmt.Errorf("无效的轮转间隔: %s", cfg.RotateInterval)
+		}
+	}
+	maxSize, maxBackups, maxAge := cfg.MaxSize, cfg.MaxBackups, cfg.MaxAge
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultLogMaxBackups
+	}
+	if maxAge <= 0 {
+		maxAge = defaultLogMaxAge
+	}
+
+	dir := cfg.Path
+	if dir == "" {
+		dir = defaultLogDir
+	}
+	path, err := filepath.Abs(filepath.Join(dir, "panel.log"))
+	if err != nil {
+		return err
+	}
+	w, err := NewRotatingWriter(path, int64(maxSize)*1024*1024, maxBackups,
+		time.Duration(maxAge)*24*time.Hour, interval, cfg.Compress)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = w
+	if cfg.Stdout {
+		out = io.MultiWriter(w, os.Stdout)
+	}
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		AddSource:   level <= slog.LevelDebug,
+		ReplaceAttr: redactAttr,
+	}
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(out, opts)
+	} else {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+
+	mu.Lock()
+	old := writer
+	writer, filePath = w, path
+	mu.Unlock()
+
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// FilePath 返回当前日志文件的路径，未初始化时返回默认路径
+func FilePath() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if filePath != "" {
+		return filePath
+	}
+	path, _ := filepath.Abs(filepath.Join(defaultLogDir, "panel.log"))
+	return path
+}
+
+// 将按行写入的文本转为日志记录，用于 gin 等只接受 io.Writer 的组件
+type lineWriter struct {
+	level slog.Level
+}
+
+// Writer 返回按行写入指定级别日志的 io.Writer
+func Writer(level slog.Level) io.Writer {
+	return lineWriter{level: level}
+}
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			slog.Log(context.Background(), w.level, string(line))
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,198 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 轮转文件名中的时间格式，如 panel.log.20240102150405
+const rotateTimeFormat = "20060102150405"
+
+// RotatingWriter 按大小和时间轮转的日志文件
+//
+// 轮转时将当前文件重命名为 文件名.时间戳，可选压缩为 .gz，并按数量和保留天数清理旧文件。
+type RotatingWriter struct {
+	mu sync.Mutex
+
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	interval   time.Duration
+	compress   bool
+
+	file     *os.File
+	size     int64
+	rotateAt time.Time
+}
+
+// NewRotatingWriter 创建轮转日志文件；maxSize 为字节数，interval 为 0 时只按大小轮转
+func NewRotatingWriter(path string, maxSize int64, maxBackups int, maxAge, interval time.Duration, compress bool) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		maxAge:     maxAge,
+		interval:   interval,
+		compress:   compress,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// 调用方需持有 mu
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	if w.interval > 0 {
+		// 按本地时间对齐，按天轮转时在零点切换
+		now := time.Now()
+		_, offset := now.Zone()
+		shift := time.Duration(offset) * time.Second
+		w.rotateAt = now.Add(shift).Truncate(w.interval).Add(w.interval).Add(-shift)
+	}
+	return nil
+}
+
+// Write 写入日志，超过大小或到达轮转时间时先轮转
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if (w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize) ||
+		(w.interval > 0 && !time.Now().Before(w.rotateAt)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close 关闭日志文件
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// 调用方需持有 mu
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	backup := w.path + "." + time.Now().Format(rotateTimeFormat)
+	// 同一秒内多次轮转时避免覆盖
+	for i := 1; ; i++ {
+		_, err := os.Stat(backup)
+		_, gzErr := os.Stat(backup + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			break
+		}
+		backup = w.path + "." + time.Now().Format(rotateTimeFormat) + strings.Repeat("0", i)
+	}
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	go w.cleanup(backup)
+	return nil
+}
+
+// 压缩刚轮转的文件并清理过期的旧文件
+func (w *RotatingWriter) cleanup(backup string) {
+	if w.compress {
+		if err := compressFile(backup); err == nil {
+			os.Remove(backup)
+		}
+	}
+
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(w.path)) + `\.\d{14,}(\.gz)?$`)
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && pattern.MatchString(e.Name()) {
+			backups = append(backups, e.Name())
+		}
+	}
+	// 文件名中的时间戳保证了字典序即时间顺序，从新到旧排列
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	cutoff := time.Now().Add(-w.maxAge)
+	for i, name := range backups {
+		path := filepath.Join(filepath.Dir(w.path), name)
+		expired := w.maxBackups > 0 && i >= w.maxBackups
+		if !expired && w.maxAge > 0 {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+				expired = true
+			}
+		}
+		if expired {
+			os.Remove(path)
+		}
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	return dst.Close()
+}
@@ -5,13 +5,13 @@ import (
 	"fmt"
 	"gegecp/config"
 	"gegecp/handlers"
+	"gegecp/logging"
 	"gegecp/middleware"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -22,29 +22,6 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-var fileLogger *log.Logger
-
-func init() {
-	// 创建日志目录
-	logDir := "./log"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		// log.Fatal("无法创建日志目录:", err)
-	}
-
-	// 打开日志文件
-	logFile, err := os.OpenFile(filepath.Join(logDir, "panel.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		// log.Fatal("无法打开日志文件:", err)
-	}
-
-	// 初始化文件日志记录器
-	fileLogger = config.GetLogger() // 使用 config 包中的日志记录器
-
-	// 设置gin的日志输出 - 只写入到文件
-	gin.DefaultWriter = logFile
-	gin.DefaultErrorWriter = logFile
-}
-
 // SSHClientConfig SSH客户端配置
 type SSHClientConfig struct {
 	User       string
@@ -402,14 +379,38 @@ func handleLocalTerminal(ws *websocket.Conn) {
 }
 
 func main() {
-	// 初始化路由
-	r := gin.Default()
-
 	// 加载配置文件
 	if err := config.LoadConfig("config/config.yaml"); err != nil {
-		// log.Fatal("加载配置文件失败:", err)
+		slog.Error("加载配置文件失败", "error", err)
 	}
 
+	// 初始化日志，失败时输出到标准错误
+	if err := logging.Setup(config.GlobalConfig.System.Log); err != nil {
+		slog.Error("初始化日志失败", "error", err)
+	}
+	gin.DefaultWriter = logging.Writer(slog.LevelDebug)
+	gin.DefaultErrorWriter = logging.Writer(slog.LevelError)
+
+	// systemd 定时器在面板未能按时回滚防火墙变更时调用
+	if len(os.Args) == 3 && os.Args[1] == "firewall-rollback" {
+		if err := handlers.RollbackPendingFirewall(os.Args[2]); err != nil {
+			slog.Error("回滚防火墙变更失败", "change", os.Args[2], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 启动后台服务，依赖已加载的配置和日志
+	handlers.StartFirewall()
+	handlers.StartAlerts()
+	handlers.StartMetrics()
+	handlers.StartTasks()
+
+	// 初始化路由
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.AccessLog(), gin.Recovery())
+	r.Use(middleware.RequestMetrics())
+
 	// 设置静态文件路由
 	r.Static("/static", "./static")
 	r.LoadHTMLGlob("templates/*")
@@ -421,6 +422,9 @@ func main() {
 		})
 	})
 
+	// Prometheus 指标，使用单独的抓取 token 或IP白名单
+	r.GET("/metrics", handlers.HandlePrometheusMetrics)
+
 	// API路由组
 	api := r.Group("/api")
 	{
@@ -436,20 +440,95 @@ func main() {
 
 			// 系统信息
 			auth.GET("/system/info", handlers.HandleSystemInfo)
+			auth.GET("/system/stream", handlers.HandleSystemStream)
+			auth.GET("/metrics/query", handlers.HandleMetricsQuery)
+			auth.GET("/metrics/series", handlers.HandleMetricsSeries)
+
+			// 告警
+			auth.GET("/alerts", handlers.HandleAlertsList)
+			auth.GET("/alerts/history", handlers.HandleAlertHistory)
+			auth.GET("/alerts/rules", handlers.HandleAlertRulesList)
+			auth.POST("/alerts/rules", handlers.HandleAlertRuleSave)
+			auth.DELETE("/alerts/rules", handlers.HandleAlertRuleDelete)
+			auth.GET("/alerts/silences", handlers.HandleAlertSilencesList)
+			auth.POST("/alerts/silences", handlers.HandleAlertSilenceCreate)
+			auth.DELETE("/alerts/silences", handlers.HandleAlertSilenceDelete)
+			auth.GET("/alerts/channels", handlers.HandleNotifyChannelsList)
+			auth.POST("/alerts/channels", handlers.HandleNotifyChannelSave)
+			auth.DELETE("/alerts/channels", handlers.HandleNotifyChannelDelete)
+			auth.POST("/alerts/channels/test", handlers.HandleNotifyChannelTest)
+
+			// 网络
+			auth.GET("/network/interfaces", handlers.HandleNetworkInterfaces)
+			auth.GET("/network/connections", handlers.HandleNetworkConnections)
 
 			// 进程管理
 			auth.GET("/process/list", handlers.HandleProcessList)
+			auth.GET("/process/detail", handlers.HandleProcessDetail)
+			auth.GET("/process/tree", handlers.HandleProcessTree)
 			auth.POST("/process/kill", handlers.HandleProcessKill)
+			auth.POST("/process/renice", handlers.HandleProcessRenice)
+			auth.POST("/process/ionice", handlers.HandleProcessIonice)
+
+			// 服务管理
+			auth.GET("/services/list", handlers.HandleServiceList)
+			auth.GET("/services/detail", handlers.HandleServiceDetail)
+			auth.POST("/services/control", handlers.HandleServiceControl)
+			auth.GET("/services/unit", handlers.HandleServiceUnitGet)
+			auth.POST("/services/unit", handlers.HandleServiceUnitSave)
+			auth.POST("/services/dropin", handlers.HandleServiceDropInSave)
+			auth.DELETE("/services/dropin", handlers.HandleServiceDropInDelete)
+
+			// 日志
+			auth.GET("/logs/journal", handlers.HandleJournalQuery)
+			auth.GET("/logs/journal/stream", handlers.HandleJournalStream)
+			auth.GET("/logs/sources", handlers.HandleLogSourcesList)
+			auth.POST("/logs/sources", handlers.HandleLogSourceSave)
+			auth.DELETE("/logs/sources", handlers.HandleLogSourceDelete)
+			auth.GET("/logs/file", handlers.HandleLogFileQuery)
+			auth.GET("/logs/file/stream", handlers.HandleLogFileStream)
+
+			// 计划任务
+			auth.GET("/cron/list", handlers.HandleCronList)
+			auth.GET("/cron/job", handlers.HandleCronJobGet)
+			auth.POST("/cron/job", handlers.HandleCronJobSave)
+			auth.POST("/cron/job/toggle", handlers.HandleCronJobToggle)
+			auth.DELETE("/cron/job", handlers.HandleCronJobDelete)
+			auth.GET("/cron/schedule", handlers.HandleCronSchedulePreview)
+
+			// 面板计划任务
+			auth.GET("/tasks", handlers.HandleTasksList)
+			auth.POST("/tasks", handlers.HandleTaskSave)
+			auth.DELETE("/tasks", handlers.HandleTaskDelete)
+			auth.POST("/tasks/run", handlers.HandleTaskRun)
+			auth.POST("/tasks/runs/abort", handlers.HandleTaskRunAbort)
+			auth.GET("/tasks/runs", handlers.HandleTaskRuns)
+			auth.GET("/tasks/runs/detail", handlers.HandleTaskRunDetail)
+
+			// 防火墙
+			auth.GET("/firewall", handlers.HandleFirewallStatus)
+			auth.POST("/firewall/rules", handlers.HandleFirewallRuleAdd)
+			auth.DELETE("/firewall/rules", handlers.HandleFirewallRuleDelete)
+			auth.POST("/firewall/confirm", handlers.HandleFirewallConfirm)
+			auth.POST("/firewall/rollback", handlers.HandleFirewallRollback)
 
 			// 文件管理
 			auth.GET("/files/list", handlers.HandleFilesList)
+			auth.GET("/files/search", handlers.HandleFileSearch)
 			auth.POST("/files/upload", handlers.HandleFileUpload)
 			auth.GET("/files/download", handlers.HandleFileDownload)
 			auth.DELETE("/files/delete", handlers.HandleFileDelete)
 			auth.GET("/files/read", handlers.HandleFileRead)
 			auth.POST("/files/save", handlers.HandleFileSave)
+			auth.POST("/files/validate", handlers.HandleFileValidate)
 			auth.POST("/files/chmod", handlers.HandleFileChmod)
 
+			// 文件历史版本
+			auth.GET("/files/history", handlers.HandleFileHistoryList)
+			auth.GET("/files/history/content", handlers.HandleFileHistoryContent)
+			auth.GET("/files/history/diff", handlers.HandleFileHistoryDiff)
+			auth.POST("/files/history/restore", handlers.HandleFileHistoryRestore)
+
 			// 收藏管理
 			auth.GET("/favorites", handlers.GetFavorites)
 			auth.POST("/favorites", handlers.UpdateFavorites)
@@ -463,6 +542,9 @@ func main() {
 
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%d", config.GlobalConfig.Server.Host, config.GlobalConfig.Server.Port)
-	// fileLogger.Printf("服务器启动在: %s", addr)
-	r.Run(addr)
+	slog.Info("服务器启动", "addr", addr)
+	if err := r.Run(addr); err != nil {
+		slog.Error("服务器启动失败", "error", err)
+		os.Exit(1)
+	}
 }
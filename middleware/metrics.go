@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LatencyBuckets 请求耗时直方图的分桶上限（秒）
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RouteLatency 某个路由的请求统计
+type RouteLatency struct {
+	Method string
+	Route  string
+	// 按状态码统计的请求数
+	Codes map[string]uint64
+	// 各分桶的累计请求数，与 LatencyBuckets 一一对应
+	Buckets []uint64
+	Count   uint64
+	Sum     float64
+}
+
+var (
+	requestStatsMutex sync.Mutex
+	requestStats      = make(map[string]*RouteLatency)
+)
+
+// RequestMetrics 记录每个路由的请求数和耗时，WebSocket 和 SSE 等长连接不计入耗时
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		websocket := c.IsWebsocket()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// 未匹配的路径不单独统计，避免标签数量失控
+			route = "unmatched"
+		}
+		code := strconv.Itoa(c.Writer.Status())
+		streaming := websocket || strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream")
+		elapsed := time.Since(start).Seconds()
+
+		requestStatsMutex.Lock()
+		defer requestStatsMutex.Unlock()
+
+		key := c.Request.Method + " " + route
+		stats := requestStats[key]
+		if stats == nil {
+			stats = &RouteLatency{
+				Method:  c.Request.Method,
+				Route:   route,
+				Codes:   make(map[string]uint64),
+				Buckets: make([]uint64, len(LatencyBuckets)),
+			}
+			requestStats[key] = stats
+		}
+		stats.Codes[code]++
+		if streaming {
+			return
+		}
+		stats.Count++
+		stats.Sum += elapsed
+		for i, le := range LatencyBuckets {
+			if elapsed <= le {
+				stats.Buckets[i]++
+			}
+		}
+	}
+}
+
+// RequestStats 返回所有路由请求统计的副本
+func RequestStats() []RouteLatency {
+	requestStatsMutex.Lock()
+	defer requestStatsMutex.Unlock()
+
+	result := make([]RouteLatency, 0, len(requestStats))
+	for _, s := range requestStats {
+		copied := *s
+		copied.Codes = make(map[string]uint64, len(s.Codes))
+		for k, v := range s.Codes {
+			copied.Codes[k] = v
+		}
+		copied.Buckets = append([]uint64(nil), s.Buckets...)
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Route != result[j].Route {
+			return result[i].Route < result[j].Route
+		}
+		return result[i].Method < result[j].Method
+	})
+	return result
+}
@@ -45,9 +45,15 @@ new Vue({
             timestamps: []
         },
         loadChart: null,
+        systemStream: null,
         processes: [],
         token: localStorage.getItem('token') || '',
         files: [],
+        // 文件列表分页，切换目录时回到第一页
+        filesPage: 1,
+        filesPageSize: 500,
+        filesTotal: 0,
+        filesPagePath: '',
         currentPath: '/',
         isEditing: false,
         currentEditingFile: null,
@@ -103,6 +109,9 @@ new Vue({
         editingPath: '',
     },
     computed: {
+        filesPageCount() {
+            return Math.max(1, Math.ceil(this.filesTotal / this.filesPageSize));
+        },
         pathParts() {
             const parts = this.currentPath.split('/').filter(Boolean);
             const result = [{ name: 'Root', path: '/' }];
@@ -206,6 +215,7 @@ new Vue({
             };
             this.processes = [];
             this.files = [];
+            this.filesTotal = 0;
             this.currentPath = '/';
             this.isEditing = false;
             this.currentEditingFile = null;
@@ -218,6 +228,10 @@ new Vue({
                 this.socket.close();
                 this.socket = null;
             }
+            if (this.systemStream) {
+                this.systemStream.abort();
+                this.systemStream = null;
+            }
             if (this.editor) {
                 this.editor.dispose();
                 this.editor = null;
@@ -228,65 +242,151 @@ new Vue({
         async getSystemInfo() {
             try {
                 const response = await this.request('/system/info');
-                // 计算趋势
-                const oldCpuPercent = Number(this.systemInfo.cpu.percent) || 0;
-                const oldMemoryPercent = this.systemInfo.memory.used / this.systemInfo.memory.total * 100 || 0;
-                const oldDiskPercent = this.systemInfo.disk.used / this.systemInfo.disk.total * 100 || 0;
-                const oldNetworkSpeed = (this.systemInfo.network.sent_speed + this.systemInfo.network.recv_speed) / (1024 * 1024) || 0;
-
-                this.systemInfo = {
-                    cpu: {
-                        percent: Number(response.cpu.percent || 0),
-                        model: response.cpu.model || '',
-                        trend: Number(response.cpu.percent - oldCpuPercent || 0)
-                    },
-                    memory: {
-                        total: Number(response.memory.total || 0),
-                        used: Number(response.memory.used || 0),
-                        free: Number(response.memory.free || 0),
-                        trend: Number((response.memory.used / response.memory.total * 100) - oldMemoryPercent || 0)
-                    },
-                    disk: {
-                        total: Number(response.disk.total || 0),
-                        used: Number(response.disk.used || 0),
-                        free: Number(response.disk.free || 0),
-                        trend: Number((response.disk.used / response.disk.total * 100) - oldDiskPercent || 0)
-                    },
-                    network: {
-                        sent: Number(response.network.sent || 0),
-                        recv: Number(response.network.recv || 0),
-                        sent_speed: Number(response.network.sent_speed || 0),
-                        recv_speed: Number(response.network.recv_speed || 0),
-                        trend: Number(((response.network.sent_speed + response.network.recv_speed) / (1024 * 1024)) - oldNetworkSpeed || 0)
-                    }
-                };
+                this.applySystemInfo(response);
 
                 // 更新历史数据
-                if (response.history) {
-                    this.loadHistory.timestamps = response.history.map(item => {
-                        const date = new Date(item.Timestamp);
-                        return date.getHours().toString().padStart(2, '0') + ':' +
-                               date.getMinutes().toString().padStart(2, '0') + ':' +
-                               date.getSeconds().toString().padStart(2, '0');
-                    });
-                    this.loadHistory.cpu = response.history.map(item => Number(item.CPU).toFixed(1));
-                    this.loadHistory.memory = response.history.map(item => Number(item.Memory).toFixed(1));
-                    this.loadHistory.disk = response.history.map(item => Number(item.Disk).toFixed(1));
-                    this.loadHistory.network = response.history.map(item => Number(item.Network).toFixed(2));
-                }
+                await this.getMetricsHistory();
 
                 // 更新图表
                 this.updateLoadChart();
 
                 // 更新进程列表
-                this.processes = await this.request('/process/list');
+                this.processes = (await this.request('/process/list', { params: { pageSize: 100 } })).items;
 
-                setTimeout(() => this.getSystemInfo(), 5000);
+                // 之后由服务端推送
+                this.startSystemStream();
             } catch (error) {
+                // 面板刚启动时采集器还没有数据，稍后重试
+                if (error.response?.status === 503 && this.isLoggedIn) {
+                    setTimeout(() => this.getSystemInfo(), 1000);
+                    return;
+                }
                 console.error('获取系统信息失败:', error);
+                // 其他数据加载失败时仍然订阅推送，避免页面一直空白
+                this.startSystemStream();
+            }
+        },
+
+        applySystemInfo(response) {
+            // 计算趋势
+            const oldCpuPercent = Number(this.systemInfo.cpu.percent) || 0;
+            const oldMemoryPercent = this.systemInfo.memory.used / this.systemInfo.memory.total * 100 || 0;
+            const oldDiskPercent = this.systemInfo.disk.used / this.systemInfo.disk.total * 100 || 0;
+            const oldNetworkSpeed = (this.systemInfo.network.sent_speed + this.systemInfo.network.recv_speed) / (1024 * 1024) || 0;
+
+            this.systemInfo = {
+                cpu: {
+                    percent: Number(response.cpu.percent || 0),
+                    model: response.cpu.model || '',
+                    trend: Number(response.cpu.percent - oldCpuPercent || 0)
+                },
+                memory: {
+                    total: Number(response.memory.total || 0),
+                    used: Number(response.memory.used || 0),
+                    free: Number(response.memory.free || 0),
+                    trend: Number((response.memory.used / response.memory.total * 100) - oldMemoryPercent || 0)
+                },
+                disk: {
+                    total: Number(response.disk.total || 0),
+                    used: Number(response.disk.used || 0),
+                    free: Number(response.disk.free || 0),
+                    trend: Number((response.disk.used / response.disk.total * 100) - oldDiskPercent || 0)
+                },
+                network: {
+                    sent: Number(response.network.sent || 0),
+                    recv: Number(response.network.recv || 0),
+                    sent_speed: Number(response.network.sent_speed || 0),
+                    recv_speed: Number(response.network.recv_speed || 0),
+                    trend: Number(((response.network.sent_speed + response.network.recv_speed) / (1024 * 1024)) - oldNetworkSpeed || 0)
+                }
+            };
+        },
+
+        // 订阅服务端推送的系统状态（SSE），EventSource 不能携带认证头，这里用 fetch 读取
+        async startSystemStream() {
+            if (this.systemStream) return;
+            const controller = new AbortController();
+            this.systemStream = controller;
+
+            let received = 0;
+            const onEvent = async (event, data) => {
+                if (event !== 'snapshot') return;
+                this.applySystemInfo(data);
+                // 历史数据每分钟才更新一次
+                if (++received % 12 === 0) {
+                    await this.getMetricsHistory();
+                    this.updateLoadChart();
+                    this.processes = (await this.request('/process/list', { params: { pageSize: 100 } })).items;
+                }
+            };
+
+            try {
+                const response = await fetch('/api/system/stream?interval=5', {
+                    headers: { 'Authorization': `Bearer ${this.token}` },
+                    signal: controller.signal
+                });
+                if (response.status === 401) {
+                    this.logout();
+                    return;
+                }
+                if (!response.ok) throw new Error('HTTP ' + response.status);
+
+                const reader = response.body.getReader();
+                const decoder = new TextDecoder();
+                let buffer = '';
+                for (;;) {
+                    const { value, done } = await reader.read();
+                    if (done) break;
+                    buffer += decoder.decode(value, { stream: true });
+                    let index;
+                    while ((index = buffer.indexOf('\n\n')) >= 0) {
+                        const block = buffer.slice(0, index);
+                        buffer = buffer.slice(index + 2);
+                        let event = 'message', data = '';
+                        for (const line of block.split('\n')) {
+                            if (line.startsWith('event:')) event = line.slice(6).trim();
+                            else if (line.startsWith('data:')) data += line.slice(5);
+                        }
+                        if (data) await onEvent(event, JSON.parse(data));
+                    }
+                }
+            } catch (error) {
+                if (controller.signal.aborted) return;
+                console.error('系统状态推送中断:', error);
+            } finally {
+                if (this.systemStream === controller) this.systemStream = null;
+            }
+
+            // 连接断开后重连
+            if (!controller.signal.aborted && this.isLoggedIn) {
+                setTimeout(() => this.startSystemStream(), 5000);
             }
         },
 
+        // 从时序存储加载最近72小时的历史数据
+        async getMetricsHistory() {
+            const end = Math.floor(Date.now() / 1000);
+            const result = await this.request('/metrics/query', {
+                params: {
+                    start: end - 72 * 3600,
+                    end: end,
+                    series: 'cpu,memory,disk,network'
+                }
+            });
+            const series = result.series || {};
+            const format = (values, digits) => (values || []).map(v => v === null ? null : Number(v).toFixed(digits));
+            this.loadHistory.timestamps = result.timestamps.map(ts => {
+                const date = new Date(ts);
+                return (date.getMonth() + 1) + '/' + date.getDate() + ' ' +
+                       date.getHours().toString().padStart(2, '0') + ':' +
+                       date.getMinutes().toString().padStart(2, '0');
+            });
+            this.loadHistory.cpu = format(series.cpu, 1);
+            this.loadHistory.memory = format(series.memory, 1);
+            this.loadHistory.disk = format(series.disk, 1);
+            this.loadHistory.network = format(series.network, 2);
+        },
+
         // 初始化负载图表
         initLoadChart() {
             if (!document.getElementById('loadChart')) return;
@@ -517,11 +617,28 @@ new Vue({
         },
 
         // 文件管理
+        changeFilesPage(page) {
+            if (page < 1 || page > this.filesPageCount || page === this.filesPage) return;
+            this.filesPage = page;
+            this.listFiles();
+        },
         async listFiles() {
+            if (this.filesPagePath !== this.currentPath) {
+                this.filesPage = 1;
+                this.filesPagePath = this.currentPath;
+            }
             try {
-                this.files = await this.request('/files/list', {
-                    params: { path: this.currentPath }
+                // 每次只读取一页，大目录不必一次下载全部条目
+                const response = await this.request('/files/list', {
+                    params: { path: this.currentPath, page: this.filesPage, pageSize: this.filesPageSize }
                 });
+                this.files = response.items || [];
+                this.filesTotal = response.total || 0;
+                // 删除文件后当前页可能已超出范围
+                if (this.files.length === 0 && this.filesPage > 1 && this.filesPage > this.filesPageCount) {
+                    this.filesPage = this.filesPageCount;
+                    return this.listFiles();
+                }
             } catch (error) {
                 console.error('获取文件列表失败:', error);
                 // 添加友好的错误提示
@@ -614,7 +731,10 @@ new Vue({
                 this.currentEditingFile = {
                     name: file.name,
                     path: filePath,
-                    content: response
+                    content: response.content,
+                    hash: response.hash,
+                    encoding: response.encoding,
+                    lineEnding: response.lineEnding
                 };
 
                 this.isEditing = true;
@@ -622,7 +742,7 @@ new Vue({
                     if (!this.editor) {
                         this.initEditor();
                     }
-                    this.editor.setValue(response);
+                    this.editor.setValue(response.content);
                     // 自动检测文件类型
                     const model = this.editor.getModel();
                     if (model) {
@@ -644,14 +764,15 @@ new Vue({
                     method: 'POST',
                     data: {
                         path: this.currentPath + '/' + this.currentEditingFile.name,
-                        content: content
+                        content: content,
+                        expectedHash: this.currentEditingFile.hash
                     }
                 });
                 this.cancelEdit();
                 await this.listFiles();
             } catch (error) {
                 console.error('保存文件失败:', error);
-                alert('保存失败：' + error.message);
+                alert('保存失败：' + (error.response?.data?.error || error.message));
             }
         },
 
@@ -759,11 +880,13 @@ new Vue({
             try {
                 const data = await this.request('/process/list');
                 // 格式化进程数据
-                this.processes = data.map(proc => ({
+                this.processes = data.items.map(proc => ({
                     name: proc.name || '',
                     pid: proc.pid || 0,
-                    cpu: this.formatPercent(proc.cpu_percent || 0),
-                    memory: this.formatBytes(proc.memory || 0),
+                    user: proc.user || '',
+                    cmdline: proc.cmdline || '',
+                    cpu: proc.cpu || 0,
+                    memory: proc.memory || 0,
                     status: proc.status?.toLowerCase() || 'unknown'
                 }));
             } catch (error) {
@@ -778,12 +901,12 @@ new Vue({
             try {
                 await this.request('/process/kill', {
                     method: 'POST',
-                    data: { pid: proc.pid }
+                    data: { pid: proc.pid, signal: 'TERM', escalateAfter: 5 }
                 });
                 await this.listProcesses();
             } catch (error) {
                 console.error('终止进程失败:', error);
-                alert('终止进程失败: ' + error.message);
+                alert('终止进程失败: ' + (error.response?.data?.error || error.message));
             }
         },
 